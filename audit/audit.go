@@ -0,0 +1,168 @@
+// Package audit records who called which tool, with which arguments and with what outcome.
+// Sensitive arguments are redacted before a record reaches a sink
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Outcomes of a tool call
+const (
+	OutcomeSuccess     = "success"
+	OutcomeToolError   = "tool_error"
+	OutcomeError       = "error"
+	OutcomeDenied      = "denied"
+	OutcomeRateLimited = "rate_limited"
+	OutcomeCancelled   = "cancelled"
+	OutcomePanic       = "panic"
+)
+
+type (
+	// Sink receives an audit record for every tool call.
+	// It is called once the call completes and must be safe for concurrent use
+	Sink interface {
+		Record(ctx context.Context, record Record) error
+	}
+
+	// SinkFunc adapts a function to the Sink interface
+	SinkFunc func(ctx context.Context, record Record) error
+
+	// Record describes a tool call
+	Record struct {
+		Time time.Time `json:"time"`
+		Tool string    `json:"tool"`
+		// RequestID is the id of the request as sent by the client, a string or an int
+		RequestID any    `json:"requestId"`
+		SessionID string `json:"sessionId,omitempty"`
+		// Subject identifies the authenticated caller, empty for anonymous callers
+		Subject string `json:"subject,omitempty"`
+		Client  string `json:"client,omitempty"`
+		// Arguments are the redacted arguments of the call,
+		// they are omitted for calls of unknown tools
+		Arguments map[string]any `json:"arguments,omitempty"`
+		// Destructive is set for tools that may perform destructive updates
+		Destructive bool    `json:"destructive"`
+		Outcome     string  `json:"outcome"`
+		ErrorCode   int     `json:"errorCode,omitempty"`
+		Error       string  `json:"error,omitempty"`
+		DurationMs  float64 `json:"durationMs"`
+	}
+
+	// JSONLinesSink appends every record as a line of JSON to a writer
+	JSONLinesSink struct {
+		mu sync.Mutex
+		w  io.Writer
+	}
+
+	// SlogSink logs every record with a logger
+	SlogSink struct {
+		logger *slog.Logger
+		level  slog.Level
+	}
+)
+
+func (f SinkFunc) Record(ctx context.Context, record Record) error {
+	return f(ctx, record)
+}
+
+// NewJSONLinesSink creates a sink writing to w
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+// OpenFile opens the file at path for appending, creating it if needed,
+// and returns a sink writing to it. The file is closed by Close
+func OpenFile(path string) (*JSONLinesSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return NewJSONLinesSink(f), nil
+}
+
+// Record writes the record as a single line
+func (s *JSONLinesSink) Record(_ context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close syncs and closes the underlying writer if it is a file or an io.Closer
+func (s *JSONLinesSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.w.(*os.File); ok {
+		return errors.Join(f.Sync(), f.Close())
+	}
+
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// NewSlogSink creates a sink logging the records at the info level.
+// A nil logger falls back to slog.Default()
+func NewSlogSink(logger *slog.Logger) *SlogSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &SlogSink{logger: logger, level: slog.LevelInfo}
+}
+
+// WithLevel sets the level records are logged at
+func (s *SlogSink) WithLevel(level slog.Level) *SlogSink {
+	s.level = level
+	return s
+}
+
+// Record logs the record with its fields as attributes
+func (s *SlogSink) Record(ctx context.Context, record Record) error {
+	attrs := []slog.Attr{
+		slog.String("tool", record.Tool),
+		slog.Any("request", record.RequestID),
+		slog.String("outcome", record.Outcome),
+		slog.Bool("destructive", record.Destructive),
+		slog.Float64("durationMs", record.DurationMs),
+	}
+
+	if record.SessionID != "" {
+		attrs = append(attrs, slog.String("session", record.SessionID))
+	}
+	if record.Subject != "" {
+		attrs = append(attrs, slog.String("subject", record.Subject))
+	}
+	if record.Client != "" {
+		attrs = append(attrs, slog.String("client", record.Client))
+	}
+	if record.Arguments != nil {
+		attrs = append(attrs, slog.Any("arguments", record.Arguments))
+	}
+	if record.ErrorCode != 0 {
+		attrs = append(attrs, slog.Int("errorCode", record.ErrorCode))
+	}
+	if record.Error != "" {
+		attrs = append(attrs, slog.String("error", record.Error))
+	}
+
+	s.logger.LogAttrs(ctx, s.level, "tool call audited", attrs...)
+	return nil
+}
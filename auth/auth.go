@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token is expired")
+)
+
+// WellKnownPath is the path of the protected resource metadata document (RFC 9728)
+const WellKnownPath = "/.well-known/oauth-protected-resource"
+
+type (
+	// TokenVerifier validates bearer tokens presented to the server.
+	// Implementations return an error wrapping ErrInvalidToken or ErrExpiredToken
+	// if the token must be rejected. Accepted tokens have a non-empty Subject
+	TokenVerifier interface {
+		VerifyToken(ctx context.Context, token string) (*TokenInfo, error)
+	}
+
+	// TokenVerifierFunc adapts a function to the TokenVerifier interface
+	TokenVerifierFunc func(ctx context.Context, token string) (*TokenInfo, error)
+
+	// TokenInfo describes the caller identified by a verified token
+	TokenInfo struct {
+		Subject   string
+		Issuer    string
+		Audience  []string
+		Scopes    []string
+		ExpiresAt time.Time
+		// Claims holds all claims of the token
+		Claims map[string]any
+	}
+
+	// ProtectedResourceMetadata is the OAuth 2.0 protected resource metadata document (RFC 9728)
+	// advertising the authorization servers the MCP server accepts tokens from
+	ProtectedResourceMetadata struct {
+		Resource               string   `json:"resource"`
+		AuthorizationServers   []string `json:"authorization_servers"`
+		ScopesSupported        []string `json:"scopes_supported,omitempty"`
+		BearerMethodsSupported []string `json:"bearer_methods_supported,omitempty"`
+		ResourceName           string   `json:"resource_name,omitempty"`
+		ResourceDocumentation  string   `json:"resource_documentation,omitempty"`
+	}
+
+	contextKey struct{}
+)
+
+func (f TokenVerifierFunc) VerifyToken(ctx context.Context, token string) (*TokenInfo, error) {
+	return f(ctx, token)
+}
+
+// HasScope reports whether the token grants the scope
+func (t *TokenInfo) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// HasScopes reports whether the token grants all of the scopes
+func (t *TokenInfo) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !t.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying the verified token
+func NewContext(ctx context.Context, info *TokenInfo) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the verified token of the caller, if the request was authorized
+func FromContext(ctx context.Context) (*TokenInfo, bool) {
+	info, ok := ctx.Value(contextKey{}).(*TokenInfo)
+	return info, ok
+}
+
+// BearerToken extracts the token from an Authorization header value
+func BearerToken(header string) (string, error) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrMissingToken
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", ErrMissingToken
+	}
+	return token, nil
+}
+
+// MetadataURL builds the URL of the metadata document of a resource
+// by inserting the well-known path between the host and the path of the resource identifier,
+// as defined by RFC 9728
+func MetadataURL(resource string) (string, error) {
+	u, err := url.Parse(resource)
+	if err != nil {
+		return "", fmt.Errorf("invalid resource identifier: %w", err)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("resource identifier must be an absolute URL: %s", resource)
+	}
+
+	u.Path = WellKnownPath + strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	return u.String(), nil
+}
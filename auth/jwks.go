@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+type (
+	// JWKS is a parsed JSON Web Key Set (RFC 7517)
+	JWKS struct {
+		Keys []JWK
+	}
+
+	// JWK is a single public key of a key set
+	JWK struct {
+		KeyID     string
+		Algorithm string
+		Use       string
+		Key       crypto.PublicKey
+	}
+
+	rawJWK struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		Use string `json:"use"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+)
+
+// LoadJWKSFile reads and parses a JSON Web Key Set from a local file
+func LoadJWKSFile(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks file: %w", err)
+	}
+
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses a JSON Web Key Set. RSA, EC (P-256, P-384, P-521)
+// and OKP (Ed25519) public keys are supported, other keys are skipped
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var set struct {
+		Keys []rawJWK `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	jwks := &JWKS{Keys: make([]JWK, 0, len(set.Keys))}
+	for _, raw := range set.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+
+		key, err := raw.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key '%s': %w", raw.Kid, err)
+		}
+
+		if key == nil {
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, JWK{
+			KeyID:     raw.Kid,
+			Algorithm: raw.Alg,
+			Use:       raw.Use,
+			Key:       key,
+		})
+	}
+
+	if len(jwks.Keys) == 0 {
+		return nil, fmt.Errorf("jwks contains no usable signing keys")
+	}
+
+	return jwks, nil
+}
+
+// lookup returns the keys a token signed with kid may have been signed with.
+// Without a kid every key is a candidate
+func (s *JWKS) lookup(kid string) []JWK {
+	if kid == "" {
+		return s.Keys
+	}
+
+	for _, key := range s.Keys {
+		if key.KeyID == kid {
+			return []JWK{key}
+		}
+	}
+	return nil
+}
+
+func (r rawJWK) publicKey() (crypto.PublicKey, error) {
+	switch r.Kty {
+	case "RSA":
+		n, err := decodeBigInt(r.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+
+		e, err := decodeBigInt(r.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+
+		if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("unsupported exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var (
+			curve     elliptic.Curve
+			ecdhCurve ecdh.Curve
+		)
+
+		switch r.Crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", r.Crv)
+		}
+
+		x, err := decodeBigInt(r.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+
+		y, err := decodeBigInt(r.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x.Bytes()) > size || len(y.Bytes()) > size {
+			return nil, fmt.Errorf("coordinates exceed the curve size")
+		}
+
+		point := make([]byte, 1+2*size)
+		point[0] = 4 // uncompressed
+		x.FillBytes(point[1 : 1+size])
+		y.FillBytes(point[1+size:])
+
+		// ecdh rejects points that are not on the curve
+		if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("point is not on the curve: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if r.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve: %s", r.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(r.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		// unknown key types are ignored
+		return nil, nil
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
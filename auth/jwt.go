@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+type (
+	// JWTConfig configures the validation of JWT access tokens
+	JWTConfig struct {
+		// JWKS holds the keys of the authorization server, see ParseJWKS and LoadJWKSFile
+		JWKS *JWKS
+		// Issuer is the expected "iss" claim, it is not checked if empty
+		Issuer string
+		// Audience is the expected "aud" claim, the resource identifier of the MCP server
+		// as in its protected resource metadata. It is required, as the server must reject
+		// tokens that were not issued for it
+		Audience string
+		// Algorithms restricts the accepted signing algorithms.
+		// All supported asymmetric algorithms are accepted if empty
+		Algorithms []string
+		// Leeway is the tolerated clock skew when checking "exp", "nbf" and "iat"
+		Leeway time.Duration
+	}
+
+	// JWTVerifier is a TokenVerifier for JWT access tokens (RFC 9068)
+	// signed with a key from a local JWKS
+	JWTVerifier struct {
+		config JWTConfig
+		now    func() time.Time
+	}
+
+	jwtHeader struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+		Typ string `json:"typ"`
+	}
+)
+
+var supportedAlgorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"PS256": crypto.SHA256,
+	"PS384": crypto.SHA384,
+	"PS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+	"EdDSA": 0,
+}
+
+// NewJWTVerifier creates a verifier for tokens signed with the keys of config.JWKS
+func NewJWTVerifier(config JWTConfig) (*JWTVerifier, error) {
+	if config.JWKS == nil || len(config.JWKS.Keys) == 0 {
+		return nil, fmt.Errorf("jwt verifier requires a jwks")
+	}
+
+	if config.Audience == "" {
+		return nil, fmt.Errorf("jwt verifier requires an audience")
+	}
+
+	for _, alg := range config.Algorithms {
+		if _, ok := supportedAlgorithms[alg]; !ok {
+			return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+		}
+	}
+
+	return &JWTVerifier{
+		config: config,
+		now:    time.Now,
+	}, nil
+}
+
+// VerifyToken checks the signature, expiry, issuer and audience of the token
+// and returns the identity and scopes it carries
+func (v *JWTVerifier) VerifyToken(_ context.Context, token string) (*TokenInfo, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed jwt", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header: %s", ErrInvalidToken, err)
+	}
+
+	if err := v.checkAlgorithm(header.Alg); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding", ErrInvalidToken)
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	if !v.verifySignature(header, signingInput, signature) {
+		return nil, fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims: %s", ErrInvalidToken, err)
+	}
+
+	return v.validateClaims(claims)
+}
+
+func (v *JWTVerifier) checkAlgorithm(alg string) error {
+	if _, ok := supportedAlgorithms[alg]; !ok {
+		return fmt.Errorf("%w: unsupported signing algorithm '%s'", ErrInvalidToken, alg)
+	}
+
+	if len(v.config.Algorithms) > 0 && !slices.Contains(v.config.Algorithms, alg) {
+		return fmt.Errorf("%w: signing algorithm '%s' is not allowed", ErrInvalidToken, alg)
+	}
+	return nil
+}
+
+func (v *JWTVerifier) verifySignature(header jwtHeader, signingInput, signature []byte) bool {
+	hash := supportedAlgorithms[header.Alg]
+
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(signingInput)
+		digest = h.Sum(nil)
+	}
+
+	for _, key := range v.config.JWKS.lookup(header.Kid) {
+		if key.Algorithm != "" && key.Algorithm != header.Alg {
+			continue
+		}
+
+		if verifyWithKey(header.Alg, hash, key.Key, signingInput, digest, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyWithKey(alg string, hash crypto.Hash, key crypto.PublicKey, signingInput, digest, signature []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+		case "PS":
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+			return rsa.VerifyPSS(k, hash, digest, signature, opts) == nil
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" || k.Curve.Params().BitSize != ecdsaCurveBits(alg) {
+			return false
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	case ed25519.PublicKey:
+		return alg == "EdDSA" && ed25519.Verify(k, signingInput, signature)
+	}
+
+	return false
+}
+
+func ecdsaCurveBits(alg string) int {
+	switch alg {
+	case "ES256":
+		return 256
+	case "ES384":
+		return 384
+	case "ES512":
+		return 521
+	}
+	return 0
+}
+
+func (v *JWTVerifier) validateClaims(claims map[string]any) (*TokenInfo, error) {
+	now := v.now()
+	leeway := v.config.Leeway
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return nil, fmt.Errorf("%w: missing 'exp' claim", ErrInvalidToken)
+	}
+
+	if now.After(exp.Add(leeway)) {
+		return nil, ErrExpiredToken
+	}
+
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(leeway).Before(nbf) {
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	}
+
+	if iat, ok := numericDate(claims["iat"]); ok && now.Add(leeway).Before(iat) {
+		return nil, fmt.Errorf("%w: token is issued in the future", ErrInvalidToken)
+	}
+
+	issuer, _ := claims["iss"].(string)
+	if v.config.Issuer != "" && issuer != v.config.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer '%s'", ErrInvalidToken, issuer)
+	}
+
+	audience := stringList(claims["aud"])
+	if !slices.Contains(audience, v.config.Audience) {
+		return nil, fmt.Errorf("%w: token is not intended for '%s'", ErrInvalidToken, v.config.Audience)
+	}
+
+	subject, _ := claims["sub"].(string)
+
+	return &TokenInfo{
+		Subject:   subject,
+		Issuer:    issuer,
+		Audience:  audience,
+		Scopes:    scopes(claims),
+		ExpiresAt: exp,
+		Claims:    claims,
+	}, nil
+}
+
+// scopes reads the granted scopes from the space-delimited "scope" claim (RFC 9068)
+// or, as used by some authorization servers, from the "scp" claim
+func scopes(claims map[string]any) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+
+	switch scp := claims["scp"].(type) {
+	case string:
+		return strings.Fields(scp)
+	case []any:
+		return stringList(scp)
+	}
+
+	return nil
+}
+
+func stringList(v any) []string {
+	switch value := v.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+
+	return nil
+}
+
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	seconds, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))), true
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
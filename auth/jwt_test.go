@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testAudience = "https://mcp.example.com/mcp"
+
+type testSigner struct {
+	key  ed25519.PrivateKey
+	jwks *JWKS
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	jwks, err := ParseJWKS([]byte(`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"k1","x":"` + base64.RawURLEncoding.EncodeToString(public) + `"}]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return &testSigner{key: private, jwks: jwks}
+}
+
+func (s *testSigner) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]any{"alg": "EdDSA", "kid": "k1", "typ": "at+jwt"})
+	payload, _ := json.Marshal(claims)
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return input + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(s.key, []byte(input)))
+}
+
+func TestNewJWTVerifierRequiresAudience(t *testing.T) {
+	signer := newTestSigner(t)
+
+	if _, err := NewJWTVerifier(JWTConfig{JWKS: signer.jwks}); err == nil {
+		t.Error("NewJWTVerifier without an audience succeeded, want an error")
+	}
+	if _, err := NewJWTVerifier(JWTConfig{JWKS: signer.jwks, Audience: testAudience}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestJWTVerifierAudience(t *testing.T) {
+	signer := newTestSigner(t)
+	verifier, err := NewJWTVerifier(JWTConfig{JWKS: signer.jwks, Audience: testAudience})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name    string
+		aud     any
+		wantErr bool
+	}{
+		{"matching", testAudience, false},
+		{"one of several", []any{"https://other.example.com", testAudience}, false},
+		{"other resource", "https://other.example.com", true},
+		{"several others", []any{"https://a.example.com", "https://b.example.com"}, true},
+		{"missing", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := map[string]any{"sub": "alice", "exp": exp}
+			if tt.aud != nil {
+				claims["aud"] = tt.aud
+			}
+
+			info, err := verifier.VerifyToken(context.Background(), signer.sign(claims))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("err = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if info.Subject != "alice" {
+				t.Errorf("subject = %q, want alice", info.Subject)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/makarski/mcp-robot/io"
 	"github.com/makarski/mcp-robot/spec"
 )
@@ -11,6 +13,15 @@ type (
 	}
 
 	MCPHandlerFunc func(w io.RPCResponseWriter, req *spec.Request[int])
+
+	// Middleware wraps the handling of every request, e.g. to add tracing or metrics.
+	// The wrapped handler resolves the request method and answers
+	// with a JSON-RPC error if the request can't be served
+	Middleware func(next MCPHandler) MCPHandler
+
+	// NotificationHandlerFunc handles a client notification.
+	// Notifications are never answered, so the handler has no response writer
+	NotificationHandlerFunc func(ctx context.Context, notification *spec.Notification)
 )
 
 func (f MCPHandlerFunc) ServeRPC(w io.RPCResponseWriter, req *spec.Request[int]) {
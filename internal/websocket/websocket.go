@@ -0,0 +1,480 @@
+// Package websocket implements the server side of the WebSocket protocol (RFC 6455)
+// to the extent needed by the MCP WebSocket transport: the opening handshake with
+// subprotocol negotiation, fragmented messages, control frames and closing codes.
+// Extensions, like compression, are not supported
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Close codes, see RFC 6455 section 7.4.1
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+)
+
+// Opcodes of the frames
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// acceptGUID is appended to the client key to compute Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxControlPayload is the largest payload allowed in a control frame
+const maxControlPayload = 125
+
+type (
+	// Conn is an established WebSocket connection.
+	// Reads must not be concurrent, writes are serialized by the connection
+	Conn struct {
+		conn        net.Conn
+		br          *bufio.Reader
+		subprotocol string
+
+		// MaxMessageSize limits the size of a reassembled message, zero means no limit
+		MaxMessageSize int64
+		// OnPong is called with the payload of every pong frame received
+		OnPong func(payload []byte)
+
+		writeMu      sync.Mutex
+		writeTimeout time.Duration
+		closeSent    bool
+	}
+
+	// HandshakeError is returned by Upgrade when the request is not a valid
+	// opening handshake. Status is the HTTP status to answer with,
+	// the connection is not hijacked yet
+	HandshakeError struct {
+		Status  int
+		Message string
+	}
+
+	// CloseError is returned by ReadMessage when the connection has been or needs to be closed.
+	// Code is either the code of the close frame sent by the peer,
+	// or the code the connection has to be closed with because of a protocol violation
+	CloseError struct {
+		Code   int
+		Reason string
+		// Remote reports whether the peer initiated the closing handshake
+		Remote bool
+	}
+)
+
+func (e *HandshakeError) Error() string {
+	return e.Message
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// IsUpgrade reports whether the request asks for a WebSocket connection
+func IsUpgrade(req *http.Request) bool {
+	return headerContainsToken(req.Header, "Connection", "upgrade") &&
+		headerContainsToken(req.Header, "Upgrade", "websocket")
+}
+
+// Upgrade performs the opening handshake and hijacks the connection.
+// If the client offers subprotocols, one of them has to be subprotocol,
+// which is then selected. writeTimeout bounds every write, zero means no timeout
+func Upgrade(w http.ResponseWriter, req *http.Request, subprotocol string, writeTimeout time.Duration) (*Conn, error) {
+	if req.Method != http.MethodGet {
+		return nil, &HandshakeError{Status: http.StatusMethodNotAllowed, Message: "websocket handshake requires GET"}
+	}
+
+	if !IsUpgrade(req) {
+		return nil, &HandshakeError{Status: http.StatusUpgradeRequired, Message: "websocket upgrade required"}
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, &HandshakeError{Status: http.StatusUpgradeRequired, Message: "unsupported websocket version"}
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, &HandshakeError{Status: http.StatusBadRequest, Message: "invalid Sec-WebSocket-Key"}
+	}
+
+	var selected string
+	if offered := headerTokens(req.Header, "Sec-WebSocket-Protocol"); len(offered) > 0 {
+		for _, protocol := range offered {
+			if protocol == subprotocol {
+				selected = protocol
+			}
+		}
+
+		if selected == "" {
+			return nil, &HandshakeError{Status: http.StatusBadRequest, Message: fmt.Sprintf("unsupported subprotocol, expected %q", subprotocol)}
+		}
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, &HandshakeError{Status: http.StatusInternalServerError, Message: "connection can't be hijacked"}
+	}
+
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hijack connection: %w", err)
+	}
+
+	// clear the deadlines the http.Server may have set for the request
+	netConn.SetDeadline(time.Time{})
+
+	if rw.Reader.Buffered() > 0 {
+		// the client must wait for the handshake response before sending frames
+		netConn.Close()
+		return nil, errors.New("client sent data before the handshake completed")
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n"
+	if selected != "" {
+		response += "Sec-WebSocket-Protocol: " + selected + "\r\n"
+	}
+	response += "\r\n"
+
+	if writeTimeout > 0 {
+		netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	}
+
+	if _, err := netConn.Write([]byte(response)); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("failed to write handshake response: %w", err)
+	}
+
+	return &Conn{
+		conn:         netConn,
+		br:           rw.Reader,
+		subprotocol:  selected,
+		writeTimeout: writeTimeout,
+	}, nil
+}
+
+// Subprotocol returns the negotiated subprotocol, empty if the client offered none
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// SetReadDeadline sets the deadline for reading the next frame
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// ReadMessage returns the next data message, with its opcode OpText or OpBinary.
+// Pings are answered and pongs are passed to OnPong while waiting.
+// Any error ends the connection, a *CloseError tells the code to close it with
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		opcode  int
+		message []byte
+		started bool
+	)
+
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case OpPing:
+			if err := c.writeFrame(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			if c.OnPong != nil {
+				c.OnPong(payload)
+			}
+			continue
+		case OpClose:
+			return 0, nil, parseClose(payload)
+		case OpText, OpBinary:
+			if started {
+				return 0, nil, &CloseError{Code: CloseProtocolError, Reason: "expected continuation frame"}
+			}
+			started = true
+			opcode = op
+		case OpContinuation:
+			if !started {
+				return 0, nil, &CloseError{Code: CloseProtocolError, Reason: "unexpected continuation frame"}
+			}
+		default:
+			return 0, nil, &CloseError{Code: CloseProtocolError, Reason: fmt.Sprintf("unknown opcode %d", op)}
+		}
+
+		if c.MaxMessageSize > 0 && int64(len(message)+len(payload)) > c.MaxMessageSize {
+			return 0, nil, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+		}
+		message = append(message, payload...)
+
+		if fin {
+			if opcode == OpText && !utf8.Valid(message) {
+				return 0, nil, &CloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8"}
+			}
+			return opcode, message, nil
+		}
+	}
+}
+
+// WriteMessage writes a data message in a single frame
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	return c.writeFrame(opcode, data)
+}
+
+// WritePing writes a ping frame, the peer answers it with a pong
+func (c *Conn) WritePing(payload []byte) error {
+	return c.writeFrame(OpPing, payload)
+}
+
+// WriteClose starts or completes the closing handshake.
+// Only the first close frame is written, later calls are no-ops
+func (c *Conn) WriteClose(code int, reason string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+
+	return c.writeFrameLocked(OpClose, payload)
+}
+
+// Close closes the underlying connection without a closing handshake
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "reserved bits set"}
+	}
+
+	if !masked {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "client frames must be masked"}
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	isControl := opcode&0x8 != 0
+	if isControl && (!fin || length > maxControlPayload) {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "invalid control frame"}
+	}
+
+	// checked before allocating, a single frame must not exceed the message limit either
+	if c.MaxMessageSize > 0 && length > uint64(c.MaxMessageSize) {
+		return false, 0, nil, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// WriteFragmented writes a message in fragments. fragments passes the fragments to send
+// and returns the final one. Other frames wait until the message is complete.
+// If fragments fails after the first fragment has been sent, the message is terminated
+// with an empty final fragment, so that the connection remains usable
+func (c *Conn) WriteFragmented(opcode int, fragments func(send func(fragment []byte) error) ([]byte, error)) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return errors.New("websocket close already sent")
+	}
+
+	started := false
+	send := func(fragment []byte) error {
+		op := OpContinuation
+		if !started {
+			op, started = opcode, true
+		}
+		return c.writeFrameHeaderLocked(false, op, fragment)
+	}
+
+	final, err := fragments(send)
+	if err != nil {
+		if started {
+			c.writeFrameHeaderLocked(true, OpContinuation, nil)
+		}
+		return err
+	}
+
+	if started {
+		opcode = OpContinuation
+	}
+	return c.writeFrameHeaderLocked(true, opcode, final)
+}
+
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return errors.New("websocket close already sent")
+	}
+
+	return c.writeFrameLocked(opcode, payload)
+}
+
+// writeFrameLocked writes a final, unmasked frame, the caller holds writeMu
+func (c *Conn) writeFrameLocked(opcode int, payload []byte) error {
+	return c.writeFrameHeaderLocked(true, opcode, payload)
+}
+
+// writeFrameHeaderLocked writes an unmasked frame, fin marks the last fragment of a message.
+// The caller holds writeMu
+func (c *Conn) writeFrameHeaderLocked(fin bool, opcode int, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = byte(opcode)
+	if fin {
+		header[0] |= 0x80
+	}
+
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+
+	buffers := net.Buffers{header, payload}
+	_, err := buffers.WriteTo(c.conn)
+	return err
+}
+
+func parseClose(payload []byte) *CloseError {
+	switch {
+	case len(payload) == 0:
+		return &CloseError{Code: CloseNoStatusReceived, Remote: true}
+	case len(payload) == 1:
+		return &CloseError{Code: CloseProtocolError, Reason: "invalid close payload"}
+	}
+
+	code := int(binary.BigEndian.Uint16(payload))
+	reason := payload[2:]
+	if !validCloseCode(code) || !utf8.Valid(reason) {
+		return &CloseError{Code: CloseProtocolError, Reason: "invalid close payload"}
+	}
+
+	return &CloseError{Code: code, Reason: string(reason), Remote: true}
+}
+
+// validCloseCode reports whether the code may be sent in a close frame
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerTokens(header http.Header, name string) []string {
+	var tokens []string
+	for _, value := range header.Values(name) {
+		for token := range strings.SplitSeq(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
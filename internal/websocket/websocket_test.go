@@ -0,0 +1,486 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testKey and testAccept are the example key and accept value of RFC 6455 section 1.3
+const (
+	testKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	testAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+type (
+	// hijackRecorder hands out the server end of a net.Pipe when hijacked
+	hijackRecorder struct {
+		*httptest.ResponseRecorder
+		conn net.Conn
+	}
+
+	// pipeClient is the client end of a connection upgraded over net.Pipe
+	pipeClient struct {
+		conn   net.Conn
+		frames chan frame
+	}
+
+	frame struct {
+		fin     bool
+		opcode  int
+		payload []byte
+	}
+)
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return r.conn, bufio.NewReadWriter(bufio.NewReader(r.conn), bufio.NewWriter(r.conn)), nil
+}
+
+func newHandshakeRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", testKey)
+	return req
+}
+
+// upgradePipe upgrades a connection over net.Pipe. The frames sent by the server
+// are collected in the frames channel of the client
+func upgradePipe(t *testing.T, req *http.Request) (*Conn, *pipeClient) {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		serverConn.Close()
+		clientConn.Close()
+	})
+
+	type upgraded struct {
+		conn *Conn
+		err  error
+	}
+	done := make(chan upgraded, 1)
+	go func() {
+		conn, err := Upgrade(&hijackRecorder{httptest.NewRecorder(), serverConn}, req, "mcp", time.Second)
+		done <- upgraded{conn, err}
+	}()
+
+	br := bufio.NewReader(clientConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("failed to read the handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != testAccept {
+		t.Fatalf("handshake response = %d %v", resp.StatusCode, resp.Header)
+	}
+
+	u := <-done
+	if u.err != nil {
+		t.Fatalf("upgrade failed: %v", u.err)
+	}
+
+	client := &pipeClient{conn: clientConn, frames: make(chan frame, 16)}
+	go client.readFrames(br)
+
+	return u.conn, client
+}
+
+func (c *pipeClient) readFrames(br *bufio.Reader) {
+	defer close(c.frames)
+
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return
+		}
+
+		length := uint64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(br, ext[:]); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(br, ext[:]); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return
+		}
+
+		c.frames <- frame{fin: header[0]&0x80 != 0, opcode: int(header[0] & 0x0F), payload: payload}
+	}
+}
+
+// send writes the frames in the background, net.Pipe blocks until they are read
+func (c *pipeClient) send(frames ...[]byte) {
+	go func() {
+		for _, f := range frames {
+			if _, err := c.conn.Write(f); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func (c *pipeClient) next(t *testing.T) frame {
+	t.Helper()
+
+	select {
+	case f, ok := <-c.frames:
+		if !ok {
+			t.Fatal("connection closed")
+		}
+		return f
+	case <-time.After(time.Second):
+		t.Fatal("no frame received")
+	}
+	return frame{}
+}
+
+// clientFrame encodes a frame as sent by a client, masked unless unmasked is set
+func clientFrame(fin bool, opcode int, payload []byte, unmasked bool) []byte {
+	b := []byte{byte(opcode), 0}
+	if fin {
+		b[0] |= 0x80
+	}
+
+	switch length := len(payload); {
+	case length <= 125:
+		b[1] = byte(length)
+	case length <= 0xFFFF:
+		b[1] = 126
+		b = binary.BigEndian.AppendUint16(b, uint16(length))
+	default:
+		b[1] = 127
+		b = binary.BigEndian.AppendUint64(b, uint64(length))
+	}
+
+	if unmasked {
+		return append(b, payload...)
+	}
+
+	b[1] |= 0x80
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	b = append(b, mask[:]...)
+	for i, c := range payload {
+		b = append(b, c^mask[i%4])
+	}
+	return b
+}
+
+func TestUpgradeRejectsInvalidHandshakes(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(req *http.Request)
+		status int
+	}{
+		{"not GET", func(req *http.Request) { req.Method = http.MethodPost }, http.StatusMethodNotAllowed},
+		{"no upgrade", func(req *http.Request) { req.Header.Del("Upgrade") }, http.StatusUpgradeRequired},
+		{"bad version", func(req *http.Request) { req.Header.Set("Sec-WebSocket-Version", "8") }, http.StatusUpgradeRequired},
+		{"missing key", func(req *http.Request) { req.Header.Del("Sec-WebSocket-Key") }, http.StatusBadRequest},
+		{"key not base64", func(req *http.Request) { req.Header.Set("Sec-WebSocket-Key", "not a key!") }, http.StatusBadRequest},
+		{"short key", func(req *http.Request) { req.Header.Set("Sec-WebSocket-Key", "c2hvcnQ=") }, http.StatusBadRequest},
+		{"other subprotocol", func(req *http.Request) { req.Header.Set("Sec-WebSocket-Protocol", "chat") }, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newHandshakeRequest()
+			tt.modify(req)
+
+			_, err := Upgrade(httptest.NewRecorder(), req, "mcp", 0)
+
+			var handshakeErr *HandshakeError
+			if !errors.As(err, &handshakeErr) || handshakeErr.Status != tt.status {
+				t.Errorf("err = %v, want a handshake error with status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestUpgradeNegotiatesSubprotocol(t *testing.T) {
+	req := newHandshakeRequest()
+	req.Header.Set("Sec-WebSocket-Protocol", "chat, mcp")
+
+	conn, _ := upgradePipe(t, req)
+	if conn.Subprotocol() != "mcp" {
+		t.Errorf("subprotocol = %q, want mcp", conn.Subprotocol())
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	text := []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+
+	tests := []struct {
+		name    string
+		frames  [][]byte
+		opcode  int
+		message []byte
+		code    int
+	}{
+		{
+			name:    "text",
+			frames:  [][]byte{clientFrame(true, OpText, text, false)},
+			opcode:  OpText,
+			message: text,
+		},
+		{
+			name:    "binary",
+			frames:  [][]byte{clientFrame(true, OpBinary, []byte{0, 1, 2}, false)},
+			opcode:  OpBinary,
+			message: []byte{0, 1, 2},
+		},
+		{
+			name: "fragmented text",
+			frames: [][]byte{
+				clientFrame(false, OpText, text[:10], false),
+				clientFrame(false, OpContinuation, text[10:20], false),
+				clientFrame(true, OpContinuation, text[20:], false),
+			},
+			opcode:  OpText,
+			message: text,
+		},
+		{
+			name: "pong between fragments",
+			frames: [][]byte{
+				clientFrame(false, OpText, text[:10], false),
+				clientFrame(true, OpPong, nil, false),
+				clientFrame(true, OpContinuation, text[10:], false),
+			},
+			opcode:  OpText,
+			message: text,
+		},
+		{
+			name:   "unmasked",
+			frames: [][]byte{clientFrame(true, OpText, text, true)},
+			code:   CloseProtocolError,
+		},
+		{
+			name:   "oversize frame",
+			frames: [][]byte{clientFrame(true, OpText, bytes.Repeat([]byte("a"), 65), false)},
+			code:   CloseMessageTooBig,
+		},
+		{
+			name: "oversize fragments",
+			frames: [][]byte{
+				clientFrame(false, OpText, bytes.Repeat([]byte("a"), 40), false),
+				clientFrame(true, OpContinuation, bytes.Repeat([]byte("a"), 40), false),
+			},
+			code: CloseMessageTooBig,
+		},
+		{
+			name:   "invalid UTF-8",
+			frames: [][]byte{clientFrame(true, OpText, []byte{0xff, 0xfe}, false)},
+			code:   CloseInvalidPayload,
+		},
+		{
+			name:   "unexpected continuation",
+			frames: [][]byte{clientFrame(true, OpContinuation, text, false)},
+			code:   CloseProtocolError,
+		},
+		{
+			name: "interleaved data frames",
+			frames: [][]byte{
+				clientFrame(false, OpText, text[:10], false),
+				clientFrame(true, OpText, text[10:], false),
+			},
+			code: CloseProtocolError,
+		},
+		{
+			name:   "fragmented control frame",
+			frames: [][]byte{clientFrame(false, OpPing, nil, false)},
+			code:   CloseProtocolError,
+		},
+		{
+			name:   "unknown opcode",
+			frames: [][]byte{clientFrame(true, 0x3, nil, false)},
+			code:   CloseProtocolError,
+		},
+		{
+			name:   "invalid close code",
+			frames: [][]byte{clientFrame(true, OpClose, []byte{0x03, 0xe7}, false)},
+			code:   CloseProtocolError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, client := upgradePipe(t, newHandshakeRequest())
+			conn.MaxMessageSize = 64
+
+			client.send(tt.frames...)
+			opcode, message, err := conn.ReadMessage()
+
+			if tt.code != 0 {
+				var closeErr *CloseError
+				if !errors.As(err, &closeErr) || closeErr.Code != tt.code || closeErr.Remote {
+					t.Errorf("err = %v, want close code %d", err, tt.code)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if opcode != tt.opcode || !bytes.Equal(message, tt.message) {
+				t.Errorf("message = %d %q, want %d %q", opcode, message, tt.opcode, tt.message)
+			}
+		})
+	}
+}
+
+func TestReadMessageAnswersPings(t *testing.T) {
+	conn, client := upgradePipe(t, newHandshakeRequest())
+
+	var pongs [][]byte
+	conn.OnPong = func(payload []byte) { pongs = append(pongs, payload) }
+
+	client.send(
+		clientFrame(true, OpPing, []byte("keepalive"), false),
+		clientFrame(true, OpPong, []byte("p1"), false),
+		clientFrame(true, OpText, []byte("{}"), false),
+	)
+
+	if _, message, err := conn.ReadMessage(); err != nil || string(message) != "{}" {
+		t.Fatalf("message = %q, %v, want {}", message, err)
+	}
+
+	if f := client.next(t); f.opcode != OpPong || string(f.payload) != "keepalive" {
+		t.Errorf("frame = %d %q, want a pong echoing the ping", f.opcode, f.payload)
+	}
+	if len(pongs) != 1 || string(pongs[0]) != "p1" {
+		t.Errorf("pongs = %q, want p1", pongs)
+	}
+}
+
+func TestReadMessageClose(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		code    int
+		reason  string
+	}{
+		{"with code", append([]byte{0x03, 0xe8}, "bye"...), CloseNormalClosure, "bye"},
+		{"without code", nil, CloseNoStatusReceived, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, client := upgradePipe(t, newHandshakeRequest())
+			client.send(clientFrame(true, OpClose, tt.payload, false))
+
+			_, _, err := conn.ReadMessage()
+
+			var closeErr *CloseError
+			if !errors.As(err, &closeErr) || !closeErr.Remote || closeErr.Code != tt.code || closeErr.Reason != tt.reason {
+				t.Errorf("err = %v, want a remote close %d %q", err, tt.code, tt.reason)
+			}
+		})
+	}
+}
+
+func TestWriteFragmented(t *testing.T) {
+	conn, client := upgradePipe(t, newHandshakeRequest())
+
+	err := conn.WriteFragmented(OpText, func(send func([]byte) error) ([]byte, error) {
+		if err := send([]byte("one ")); err != nil {
+			return nil, err
+		}
+		if err := send([]byte("two ")); err != nil {
+			return nil, err
+		}
+		return []byte("three"), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []frame{
+		{false, OpText, []byte("one ")},
+		{false, OpContinuation, []byte("two ")},
+		{true, OpContinuation, []byte("three")},
+	}
+	for _, w := range want {
+		if f := client.next(t); f.fin != w.fin || f.opcode != w.opcode || !bytes.Equal(f.payload, w.payload) {
+			t.Errorf("frame = %v %d %q, want %v %d %q", f.fin, f.opcode, f.payload, w.fin, w.opcode, w.payload)
+		}
+	}
+}
+
+func TestWriteFragmentedWithoutFragments(t *testing.T) {
+	conn, client := upgradePipe(t, newHandshakeRequest())
+
+	err := conn.WriteFragmented(OpText, func(func([]byte) error) ([]byte, error) {
+		return []byte("whole"), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if f := client.next(t); !f.fin || f.opcode != OpText || string(f.payload) != "whole" {
+		t.Errorf("frame = %v %d %q, want a single text frame", f.fin, f.opcode, f.payload)
+	}
+}
+
+func TestWriteFragmentedFailureTerminatesMessage(t *testing.T) {
+	conn, client := upgradePipe(t, newHandshakeRequest())
+
+	failure := errors.New("source failed")
+	err := conn.WriteFragmented(OpText, func(send func([]byte) error) ([]byte, error) {
+		if err := send([]byte("partial")); err != nil {
+			return nil, err
+		}
+		return nil, failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+
+	client.next(t)
+	if f := client.next(t); !f.fin || f.opcode != OpContinuation || len(f.payload) != 0 {
+		t.Errorf("frame = %v %d %q, want an empty final fragment", f.fin, f.opcode, f.payload)
+	}
+
+	// the connection remains usable
+	if err := conn.WriteMessage(OpText, []byte("next")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f := client.next(t); !f.fin || f.opcode != OpText || string(f.payload) != "next" {
+		t.Errorf("frame = %v %d %q, want the next message", f.fin, f.opcode, f.payload)
+	}
+}
+
+func TestWriteClose(t *testing.T) {
+	conn, client := upgradePipe(t, newHandshakeRequest())
+
+	if err := conn.WriteClose(CloseMessageTooBig, "message too big"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// only the first close frame is written
+	conn.WriteClose(CloseNormalClosure, "")
+
+	f := client.next(t)
+	if f.opcode != OpClose || binary.BigEndian.Uint16(f.payload) != CloseMessageTooBig || string(f.payload[2:]) != "message too big" {
+		t.Errorf("frame = %d %q, want close 1009", f.opcode, f.payload)
+	}
+
+	if err := conn.WriteMessage(OpText, []byte("late")); err == nil {
+		t.Error("want writes after the close frame to fail")
+	}
+}
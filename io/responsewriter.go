@@ -1,48 +1,195 @@
 package io
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	stdio "io"
+	"strconv"
 
 	"github.com/makarski/mcp-robot/spec"
 )
 
+// ErrIncompleteResponse is returned when a streamed response fails after parts of it have
+// been passed to the transport. No other response can be written for the request
+var ErrIncompleteResponse = errors.New("response written incompletely")
+
 type (
 	ResponseWriter struct {
 		w  RPCResponseWriter
-		id int // to do chnage to generic ID type as in request
+		id *int // to do chnage to generic ID type as in request
 	}
 
 	RPCResponseWriter interface {
 		Write(b []byte) (int, error)
 	}
+
+	// ResultStreamWriter is implemented by RPCResponseWriters passing a successful response
+	// on to the client in chunks, without holding the whole message in memory.
+	// Other messages of the transport wait until the stream is complete
+	ResultStreamWriter interface {
+		// WriteResultStream calls write with a writer for the chunks of one response,
+		// the message is complete when write returns
+		WriteResultStream(write func(w stdio.Writer) error) error
+	}
 )
 
 func NewResponseWriter(w RPCResponseWriter, id int) *ResponseWriter {
 	return &ResponseWriter{
 		w:  w,
-		id: id,
+		id: &id,
+	}
+}
+
+// NewNullIDResponseWriter creates a writer for errors of requests
+// whose id could not be determined, e.g. parse errors.
+// The id of the written responses is null
+func NewNullIDResponseWriter(w RPCResponseWriter) *ResponseWriter {
+	return &ResponseWriter{
+		w: w,
 	}
 }
 
 func (rw *ResponseWriter) WriteResult(result map[string]any) error {
+	var id int
+	if rw.id != nil {
+		id = *rw.id
+	}
+
 	response := spec.Response[int]{
 		Jsonrpc: spec.JsonRPC,
-		ID:      rw.id,
+		ID:      id,
 		Result:  result,
 	}
 
 	return json.NewEncoder(rw.w).Encode(response)
 }
 
+// WriteResultFunc writes a successful response whose result is encoded into w by encode,
+// e.g. to stream large values into the response. The response is streamed if the underlying
+// writer is a ResultStreamWriter, see WriteResultStream. A failure of encode after the first
+// chunk has been passed on is reported as ErrIncompleteResponse
+func (rw *ResponseWriter) WriteResultFunc(encode func(w stdio.Writer) error) error {
+	var id int
+	if rw.id != nil {
+		id = *rw.id
+	}
+
+	prefix := `{"jsonrpc":"` + spec.JsonRPC + `","id":` + strconv.Itoa(id) + `,"result":`
+
+	return WriteResultStream(rw.w, func(w stdio.Writer) error {
+		if _, err := stdio.WriteString(w, prefix); err != nil {
+			return err
+		}
+
+		if err := encode(w); err != nil {
+			return err
+		}
+
+		_, err := stdio.WriteString(w, "}\n")
+		return err
+	})
+}
+
+// WriteResultStream streams the response written by write into w if it is a ResultStreamWriter.
+// Otherwise the response is collected and passed to w in one Write, like WriteResult does
+func WriteResultStream(w RPCResponseWriter, write func(w stdio.Writer) error) error {
+	if sw, ok := w.(ResultStreamWriter); ok {
+		return sw.WriteResultStream(write)
+	}
+
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ChunkWriter passes the chunks of a streamed response to the transport, collecting
+// small writes, like the prefix of the response, into chunks of at least ChunkSize bytes.
+// It is a helper for implementations of ResultStreamWriter
+type ChunkWriter struct {
+	buf   []byte
+	flush func(chunk []byte) error
+	// Started reports whether a chunk has been passed on
+	Started bool
+}
+
+// ChunkSize is the size of the chunks a ChunkWriter passes on
+const ChunkSize = 32 << 10
+
+// NewChunkWriter returns a writer passing chunks to flush
+func NewChunkWriter(flush func(chunk []byte) error) *ChunkWriter {
+	return &ChunkWriter{
+		buf:   make([]byte, 0, ChunkSize),
+		flush: flush,
+	}
+}
+
+func (cw *ChunkWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := min(len(b), ChunkSize-len(cw.buf))
+		cw.buf = append(cw.buf, b[:n]...)
+		b = b[n:]
+		written += n
+
+		if len(cw.buf) == ChunkSize {
+			if err := cw.Flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Flush passes the collected bytes on
+func (cw *ChunkWriter) Flush() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	cw.Started = true
+	err := cw.flush(cw.buf)
+	cw.buf = cw.buf[:0]
+	return err
+}
+
+// Rest returns the collected bytes not passed on yet
+func (cw *ChunkWriter) Rest() []byte {
+	return cw.buf
+}
+
+// StreamError returns err as ErrIncompleteResponse if chunks have been passed on
+func (cw *ChunkWriter) StreamError(err error) error {
+	if err == nil || !cw.Started {
+		return err
+	}
+	return errors.Join(ErrIncompleteResponse, err)
+}
+
 func (rw *ResponseWriter) WriteError(code int, message string) error {
-	errorResponse := spec.Response[int]{
+	return rw.WriteErrorData(code, message, nil)
+}
+
+// WriteErrorData writes an error response carrying structured detail in its data member
+func (rw *ResponseWriter) WriteErrorData(code int, message string, data any) error {
+	errorResponse := spec.ErrorResponse[int]{
 		Jsonrpc: spec.JsonRPC,
 		ID:      rw.id,
 		Error: &spec.Error{
 			Code:    code,
 			Message: message,
+			Data:    data,
 		},
 	}
 
 	return json.NewEncoder(rw.w).Encode(errorResponse)
 }
+
+// WriteProtocolError writes the protocol error as an error response
+func (rw *ResponseWriter) WriteProtocolError(err *spec.ProtocolError) error {
+	return rw.WriteErrorData(err.Code, err.Message, err.Data)
+}
@@ -0,0 +1,359 @@
+// Package metrics is a dependency-free registry of counters, gauges and histograms
+// exposed in the Prometheus text format:
+//
+//	registry := metrics.NewRegistry()
+//	calls := registry.Counter("weather_lookups_total", "Number of weather lookups", "city")
+//	calls.Inc("Berlin")
+//
+//	http.Handle("/metrics", registry.Handler())
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of latency histograms
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+type (
+	// Registry holds the metrics of an application. It is safe for concurrent use
+	Registry struct {
+		mu       sync.Mutex
+		families map[string]*family
+		names    []string
+	}
+
+	// Counter is a monotonically increasing metric
+	Counter struct {
+		f *family
+	}
+
+	// Gauge is a metric that can go up and down
+	Gauge struct {
+		f *family
+	}
+
+	// Histogram counts observations in buckets
+	Histogram struct {
+		f *family
+	}
+
+	// family is a metric with all its label combinations
+	family struct {
+		name    string
+		help    string
+		kind    string
+		labels  []string
+		buckets []float64
+
+		mu     sync.Mutex
+		series map[string]*series
+		// fn computes the value of a gauge without labels when it is written
+		fn func() float64
+	}
+
+	series struct {
+		labelValues []string
+		value       float64
+
+		// counts holds the observations per bucket, the last one is +Inf
+		counts []uint64
+		count  uint64
+		sum    float64
+	}
+)
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Counter registers a counter with the given label names, or returns the counter
+// registered under the name before. It panics if the name is used by another kind
+// of metric or with other labels
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, kindCounter, labels, nil)}
+}
+
+// Gauge registers a gauge with the given label names, see Counter
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, kindGauge, labels, nil)}
+}
+
+// GaugeFunc registers a gauge without labels whose value is computed by fn
+// every time the metrics are written. Registering the name again replaces fn
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	f := r.register(name, help, kindGauge, nil, nil)
+
+	f.mu.Lock()
+	f.fn = fn
+	f.mu.Unlock()
+}
+
+// Histogram registers a histogram with the given upper bounds and label names, see Counter.
+// Nil buckets fall back to DefaultBuckets
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Histogram{r.register(name, help, kindHistogram, labels, buckets)}
+}
+
+// WriteTo writes all metrics in the Prometheus text format, ordered by registration
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.names))
+	for _, name := range r.names {
+		families = append(families, r.families[name])
+	}
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(cw)
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// Handler returns the handler serving the metrics to Prometheus scrapers
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		if req.Method == http.MethodHead {
+			return
+		}
+
+		r.WriteTo(w)
+	})
+}
+
+// Inc increments the counter of the label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter of the label values, it panics if v is negative
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't be decreased", c.f.name))
+	}
+
+	c.f.update(labelValues, func(s *series) { s.value += v })
+}
+
+// Set sets the gauge of the label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *series) { s.value = v })
+}
+
+// Add adds v, which may be negative, to the gauge of the label values
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *series) { s.value += v })
+}
+
+// Inc increments the gauge of the label values by one
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec decrements the gauge of the label values by one
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Observe records a value in the histogram of the label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.update(labelValues, func(s *series) {
+		i := sort.SearchFloat64s(h.f.buckets, v)
+		s.counts[i]++
+		s.count++
+		s.sum += v
+	})
+}
+
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.kind != kind || !slices.Equal(f.labels, labels) {
+			panic(fmt.Sprintf("metrics: %s is already registered as a %s with labels %v", name, f.kind, f.labels))
+		}
+		return f
+	}
+
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  append([]string(nil), labels...),
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+
+	r.families[name] = f
+	r.names = append(r.names, name)
+	return f
+}
+
+// update applies fn to the series of the label values, creating it on first use
+func (f *family) update(labelValues []string, fn func(*series)) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+
+	fn(s)
+}
+
+func (f *family) write(w *countingWriter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.fn == nil && len(f.series) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, helpEscaper.Replace(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	if f.fn != nil {
+		fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+		return
+	}
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		labels := formatLabels(f.labels, s.labelValues)
+
+		if f.kind != kindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labels, formatFloat(s.value))
+			continue
+		}
+
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+
+			le := math.Inf(1)
+			if i < len(f.buckets) {
+				le = f.buckets[i]
+			}
+
+			bucketLabels := formatLabels(slices.Concat(f.labels, []string{"le"}), slices.Concat(s.labelValues, []string{formatFloat(le)}))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, bucketLabels, cumulative)
+		}
+
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, labels, s.count)
+	}
+}
+
+// countingWriter keeps the first error, so that writing can go on unchecked
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
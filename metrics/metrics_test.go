@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	registry := NewRegistry()
+
+	calls := registry.Counter("calls_total", "Number of calls", "city")
+	calls.Inc("Berlin")
+	calls.Add(2, "Berlin")
+	calls.Inc(`Say "hi"` + "\n")
+
+	open := registry.Gauge("open_streams", "Open streams", "kind")
+	open.Inc("sse")
+	open.Inc("sse")
+	open.Dec("sse")
+	open.Set(5, "ws")
+
+	registry.GaugeFunc("sessions", "Active sessions", func() float64 { return 3 })
+
+	latency := registry.Histogram("latency_seconds", "Latency", []float64{1, 0.1}, "method")
+	latency.Observe(0.05, "ping")
+	latency.Observe(0.5, "ping")
+	latency.Observe(2, "ping")
+
+	// registered but never updated
+	registry.Counter("unused_total", "Unused")
+
+	var b strings.Builder
+	if _, err := registry.WriteTo(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `# HELP calls_total Number of calls
+# TYPE calls_total counter
+calls_total{city="Berlin"} 3
+calls_total{city="Say \"hi\"\n"} 1
+# HELP open_streams Open streams
+# TYPE open_streams gauge
+open_streams{kind="sse"} 1
+open_streams{kind="ws"} 5
+# HELP sessions Active sessions
+# TYPE sessions gauge
+sessions 3
+# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="ping",le="0.1"} 1
+latency_seconds_bucket{method="ping",le="1"} 2
+latency_seconds_bucket{method="ping",le="+Inf"} 3
+latency_seconds_sum{method="ping"} 2.55
+latency_seconds_count{method="ping"} 3
+`
+	if b.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(r *Registry)
+	}{
+		{"other kind", func(r *Registry) {
+			r.Counter("m", "help")
+			r.Gauge("m", "help")
+		}},
+		{"other labels", func(r *Registry) {
+			r.Counter("m", "help", "a")
+			r.Counter("m", "help", "b")
+		}},
+		{"missing label value", func(r *Registry) {
+			r.Counter("m", "help", "a", "b").Inc("x")
+		}},
+		{"negative counter", func(r *Registry) {
+			r.Counter("m", "help").Add(-1)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("want a panic")
+				}
+			}()
+			tt.fn(NewRegistry())
+		})
+	}
+}
+
+func TestRegistryReturnsRegisteredMetric(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("calls_total", "Number of calls", "city").Inc("Berlin")
+	registry.Counter("calls_total", "Number of calls", "city").Inc("Berlin")
+
+	var b strings.Builder
+	registry.WriteTo(&b)
+
+	if !strings.Contains(b.String(), `calls_total{city="Berlin"} 2`) {
+		t.Errorf("output = %s, want both increments on the same series", b.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("calls_total", "Number of calls").Inc()
+
+	tests := []struct {
+		method string
+		status int
+		body   bool
+	}{
+		{http.MethodGet, http.StatusOK, true},
+		{http.MethodHead, http.StatusOK, false},
+		{http.MethodPost, http.StatusMethodNotAllowed, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			registry.Handler().ServeHTTP(rec, httptest.NewRequest(tt.method, "/metrics", nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && rec.Header().Get("Content-Type") != ContentType {
+				t.Errorf("content type = %q, want %q", rec.Header().Get("Content-Type"), ContentType)
+			}
+			if hasBody := strings.Contains(rec.Body.String(), "calls_total 1"); hasBody != tt.body {
+				t.Errorf("body = %q, want the metrics %v", rec.Body, tt.body)
+			}
+		})
+	}
+}
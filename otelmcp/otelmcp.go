@@ -0,0 +1,324 @@
+// Package otelmcp instruments MCP servers with OpenTelemetry tracing and metrics.
+// It is a module of its own, so that the core of mcp-robot stays free of dependencies.
+//
+// The middleware creates a span per JSON-RPC request and records the request metrics:
+//
+//	mw, err := otelmcp.Middleware(otelmcp.Config{})
+//	srv := server.NewServerBuilder("weather-server", "1.0.0").Use(mw)
+//
+// Trace context is taken from the _meta.traceparent request parameter or,
+// with HTTPHandler, from the headers of the HTTP request.
+//
+// Metric attributes are bounded: methods the server doesn't serve are recorded as "other"
+// and tool names only if Config.HasTool reports them as registered:
+//
+//	srv := server.NewServerBuilder("weather-server", "1.0.0")
+//	mw, err := otelmcp.Middleware(otelmcp.Config{HasTool: srv.HasTool})
+package otelmcp
+
+import (
+	"context"
+	"encoding/json"
+	stdio "io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/makarski/mcp-robot/handler"
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// ScopeName is the instrumentation scope of the tracer and the meter
+const ScopeName = "github.com/makarski/mcp-robot/otelmcp"
+
+// OtherMethod is the method attribute of metrics of requests of unknown methods
+const OtherMethod = "other"
+
+// knownMethods are the methods recorded as is in metric attributes
+var knownMethods = map[string]bool{
+	spec.MethodInitialize: true,
+	spec.MethodPing:       true,
+	spec.MethodToolsList:  true,
+	spec.MethodToolsCall:  true,
+}
+
+// Attribute keys of the spans and metrics
+const (
+	AttrMethod          = attribute.Key("mcp.method.name")
+	AttrToolName        = attribute.Key("mcp.tool.name")
+	AttrSessionID       = attribute.Key("mcp.session.id")
+	AttrProtocolVersion = attribute.Key("mcp.protocol.version")
+	AttrRequestID       = attribute.Key("jsonrpc.request.id")
+	AttrErrorCode       = attribute.Key("rpc.jsonrpc.error_code")
+	AttrToolError       = attribute.Key("mcp.tool.is_error")
+)
+
+type (
+	// Config selects the providers used by the instrumentation.
+	// Nil providers fall back to the global providers of the otel package,
+	// the propagator defaults to W3C trace context
+	Config struct {
+		TracerProvider trace.TracerProvider
+		MeterProvider  metric.MeterProvider
+		Propagator     propagation.TextMapPropagator
+		// HasTool reports whether a tool is registered, like the HasTool method of the server.
+		// Tool names are recorded in metrics only if it is set and reports the tool,
+		// as they are sent by the client. Spans always carry the tool name
+		HasTool func(name string) bool
+	}
+
+	instruments struct {
+		tracer     trace.Tracer
+		propagator propagation.TextMapPropagator
+		hasTool    func(name string) bool
+
+		requests           metric.Int64Counter
+		duration           metric.Float64Histogram
+		inFlight           metric.Int64UpDownCounter
+		validationFailures metric.Int64Counter
+	}
+
+	// outcome is the part of the response the instrumentation records
+	outcome struct {
+		Error  *outcomeError `json:"error"`
+		Result *struct {
+			IsError bool `json:"isError"`
+		} `json:"result"`
+	}
+
+	outcomeError struct {
+		Code int `json:"code"`
+	}
+
+	// recordingWriter keeps the outcome of the response written by the handler
+	recordingWriter struct {
+		w       io.RPCResponseWriter
+		outcome outcome
+		written bool
+	}
+
+	// metaCarrier exposes the _meta request parameter to the propagator
+	metaCarrier map[string]any
+)
+
+// Middleware returns the middleware tracing and measuring every request.
+// The error reports instruments that could not be created
+func Middleware(config Config) (handler.Middleware, error) {
+	inst, err := newInstruments(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next handler.MCPHandler) handler.MCPHandler {
+		return handler.MCPHandlerFunc(func(w io.RPCResponseWriter, req *spec.Request[int]) {
+			inst.serve(next, w, req)
+		})
+	}, nil
+}
+
+// HTTPHandler extracts the W3C trace context of the HTTP request headers,
+// so that the spans of the requests become children of the caller's span:
+//
+//	http.ListenAndServe(":8080", otelmcp.HTTPHandler(srv.Handler(), otelmcp.Config{}))
+func HTTPHandler(next http.Handler, config Config) http.Handler {
+	propagator := config.propagator()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+func newInstruments(config Config) (*instruments, error) {
+	tracerProvider := config.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+
+	meterProvider := config.MeterProvider
+	if meterProvider == nil {
+		meterProvider = otel.GetMeterProvider()
+	}
+
+	meter := meterProvider.Meter(ScopeName)
+	inst := &instruments{
+		tracer:     tracerProvider.Tracer(ScopeName),
+		propagator: config.propagator(),
+		hasTool:    config.HasTool,
+	}
+
+	var err error
+	if inst.requests, err = meter.Int64Counter(
+		"mcp.server.requests",
+		metric.WithDescription("Number of JSON-RPC requests served"),
+		metric.WithUnit("{request}"),
+	); err != nil {
+		return nil, err
+	}
+
+	if inst.duration, err = meter.Float64Histogram(
+		"mcp.server.request.duration",
+		metric.WithDescription("Duration of JSON-RPC requests"),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, err
+	}
+
+	if inst.inFlight, err = meter.Int64UpDownCounter(
+		"mcp.server.requests.in_flight",
+		metric.WithDescription("Number of JSON-RPC requests in progress"),
+		metric.WithUnit("{request}"),
+	); err != nil {
+		return nil, err
+	}
+
+	if inst.validationFailures, err = meter.Int64Counter(
+		"mcp.server.validation.failures",
+		metric.WithDescription("Number of requests rejected because of invalid parameters"),
+		metric.WithUnit("{request}"),
+	); err != nil {
+		return nil, err
+	}
+
+	return inst, nil
+}
+
+func (inst *instruments) serve(next handler.MCPHandler, w io.RPCResponseWriter, req *spec.Request[int]) {
+	ctx := req.Context()
+
+	// the trace context of the request parameters is the most specific one
+	if meta, ok := req.Params["_meta"].(map[string]any); ok {
+		ctx = inst.propagator.Extract(ctx, metaCarrier(meta))
+	}
+
+	// the method and the tool name are sent by the client, the metrics only record
+	// known values to bound their cardinality. The spans get the ids and raw names as well
+	method := req.Method
+	if !knownMethods[method] {
+		method = OtherMethod
+	}
+
+	attrs := []attribute.KeyValue{AttrMethod.String(method)}
+	idAttr := AttrRequestID.Int(req.ID)
+	if id, ok := req.RequestID().(string); ok {
+		idAttr = AttrRequestID.String(id)
+	}
+	spanAttrs := []attribute.KeyValue{idAttr, AttrMethod.String(req.Method)}
+	spanName := req.Method
+
+	if req.Method == spec.MethodToolsCall {
+		if tool, ok := req.Params["name"].(string); ok {
+			if inst.hasTool != nil && inst.hasTool(tool) {
+				attrs = append(attrs, AttrToolName.String(tool))
+			}
+			spanAttrs = append(spanAttrs, AttrToolName.String(tool))
+			spanName += " " + tool
+		}
+	}
+
+	if sess, ok := session.FromContext(ctx); ok {
+		spanAttrs = append(spanAttrs,
+			AttrSessionID.String(sess.ID()),
+			AttrProtocolVersion.String(sess.ProtocolVersion()),
+		)
+	}
+
+	ctx, span := inst.tracer.Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(spanAttrs...),
+	)
+	defer span.End()
+
+	inFlightAttrs := metric.WithAttributes(attrs...)
+	inst.inFlight.Add(ctx, 1, inFlightAttrs)
+	start := time.Now()
+
+	rw := &recordingWriter{w: w}
+
+	// recorded in a defer, so that a panic of the handler is recorded as well.
+	// The panic is recovered by the server, which answers with an internal error
+	panicked := true
+	defer func() {
+		inst.inFlight.Add(ctx, -1, inFlightAttrs)
+
+		if panicked && rw.outcome.Error == nil {
+			rw.outcome.Error = &outcomeError{Code: spec.ErrorCodeInternalError}
+		}
+		inst.record(ctx, span, rw.outcome, attrs, start)
+	}()
+
+	next.ServeRPC(rw, req.WithContext(ctx))
+	panicked = false
+}
+
+// record adds the outcome of a request to the span and the request metrics
+func (inst *instruments) record(ctx context.Context, span trace.Span, outcome outcome, attrs []attribute.KeyValue, start time.Time) {
+	switch {
+	case outcome.Error != nil:
+		code := outcome.Error.Code
+		span.SetAttributes(AttrErrorCode.Int(code))
+		span.SetStatus(codes.Error, "JSON-RPC error "+strconv.Itoa(code))
+
+		if code == spec.ErrorCodeInvalidParams {
+			inst.validationFailures.Add(ctx, 1, metric.WithAttributes(attrs...))
+		}
+		attrs = append(attrs, AttrErrorCode.Int(code))
+	case outcome.Result != nil && outcome.Result.IsError:
+		span.SetAttributes(AttrToolError.Bool(true))
+		span.SetStatus(codes.Error, "tool error")
+		attrs = append(attrs, AttrToolError.Bool(true))
+	}
+
+	resultAttrs := metric.WithAttributes(attrs...)
+	inst.requests.Add(ctx, 1, resultAttrs)
+	inst.duration.Record(ctx, time.Since(start).Seconds(), resultAttrs)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if !rw.written {
+		rw.written = true
+		// a response that can't be decoded is recorded as successful
+		json.Unmarshal(b, &rw.outcome)
+	}
+	return rw.w.Write(b)
+}
+
+// WriteResultStream records the streamed response as successful, only results are streamed
+func (rw *recordingWriter) WriteResultStream(write func(w stdio.Writer) error) error {
+	rw.written = true
+	return io.WriteResultStream(rw.w, write)
+}
+
+func (c metaCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+// Set is not used, the carrier is only extracted from
+func (c metaCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c metaCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (c Config) propagator() propagation.TextMapPropagator {
+	if c.Propagator != nil {
+		return c.Propagator
+	}
+	return propagation.TraceContext{}
+}
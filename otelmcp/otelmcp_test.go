@@ -0,0 +1,204 @@
+package otelmcp
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/makarski/mcp-robot/handler"
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+type testTelemetry struct {
+	spans  *tracetest.InMemoryExporter
+	reader *sdkmetric.ManualReader
+	mw     handler.Middleware
+}
+
+func newTestTelemetry(t *testing.T, hasTool func(string) bool) *testTelemetry {
+	t.Helper()
+
+	spans := tracetest.NewInMemoryExporter()
+	reader := sdkmetric.NewManualReader()
+
+	mw, err := Middleware(Config{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		HasTool:        hasTool,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return &testTelemetry{spans: spans, reader: reader, mw: mw}
+}
+
+// serve runs the request through the middleware, the handler answers with the error code if not zero
+func (tt *testTelemetry) serve(method string, params map[string]any, code int) {
+	next := handler.MCPHandlerFunc(func(w io.RPCResponseWriter, req *spec.Request[int]) {
+		rw := io.NewResponseWriter(w, req.ID)
+		if code != 0 {
+			rw.WriteError(code, "failed")
+			return
+		}
+		rw.WriteResult(map[string]any{"isError": false})
+	})
+
+	req := &spec.Request[int]{Jsonrpc: spec.JsonRPC, ID: 7, Method: method, Params: params}
+	tt.mw(next).ServeRPC(&bytes.Buffer{}, req)
+}
+
+// dataPoints returns the data points of the sum metric with the given name
+func (tt *testTelemetry) dataPoints(t *testing.T, name string) []metricdata.DataPoint[int64] {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := tt.reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var points []metricdata.DataPoint[int64]
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				points = append(points, m.Data.(metricdata.Sum[int64]).DataPoints...)
+			}
+		}
+	}
+	return points
+}
+
+// requestAttributes returns the attribute sets of the mcp.server.requests data points
+func (tt *testTelemetry) requestAttributes(t *testing.T) []attribute.Set {
+	t.Helper()
+
+	var sets []attribute.Set
+	for _, dp := range tt.dataPoints(t, "mcp.server.requests") {
+		sets = append(sets, dp.Attributes)
+	}
+	return sets
+}
+
+func TestSpans(t *testing.T) {
+	tt := newTestTelemetry(t, func(name string) bool { return name == "weather" })
+
+	tt.serve(spec.MethodToolsCall, map[string]any{"name": "weather"}, 0)
+	tt.serve(spec.MethodToolsList, nil, spec.ErrorCodeInvalidParams)
+
+	spans := tt.spans.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+
+	call := spans[0]
+	if call.Name != "tools/call weather" {
+		t.Errorf("name = %q, want %q", call.Name, "tools/call weather")
+	}
+	if !hasAttribute(call.Attributes, AttrRequestID.Int(7)) || !hasAttribute(call.Attributes, AttrToolName.String("weather")) {
+		t.Errorf("attributes = %v, want the request id and the tool name", call.Attributes)
+	}
+
+	failed := spans[1]
+	if failed.Status.Code != codes.Error || !hasAttribute(failed.Attributes, AttrErrorCode.Int(spec.ErrorCodeInvalidParams)) {
+		t.Errorf("status = %v, attributes = %v, want the error code", failed.Status, failed.Attributes)
+	}
+}
+
+func TestMetricAttributesAreBounded(t *testing.T) {
+	tt := newTestTelemetry(t, func(name string) bool { return name == "weather" })
+
+	tt.serve(spec.MethodToolsCall, map[string]any{"name": "weather"}, 0)
+	for _, name := range []string{"random-1", "random-2", "random-3"} {
+		tt.serve(spec.MethodToolsCall, map[string]any{"name": name}, spec.ErrorCodeInvalidParams)
+	}
+	for _, method := range []string{"x/1", "x/2"} {
+		tt.serve(method, nil, spec.ErrorCodeMethodNotFound)
+	}
+
+	for _, set := range tt.requestAttributes(t) {
+		method, _ := set.Value(AttrMethod)
+		if m := method.AsString(); m != spec.MethodToolsCall && m != OtherMethod {
+			t.Errorf("method attribute = %q, want unknown methods recorded as %q", m, OtherMethod)
+		}
+
+		if tool, ok := set.Value(AttrToolName); ok && tool.AsString() != "weather" {
+			t.Errorf("tool attribute = %q, want only registered tools", tool.AsString())
+		}
+
+		if set.HasValue(AttrRequestID) || set.HasValue(AttrSessionID) {
+			t.Errorf("attributes = %v, want no ids in metrics", set.ToSlice())
+		}
+	}
+
+	// the spans keep the raw names
+	spans := tt.spans.GetSpans()
+	if !hasAttribute(spans[1].Attributes, AttrToolName.String("random-1")) {
+		t.Errorf("attributes = %v, want the tool name on the span", spans[1].Attributes)
+	}
+	if !hasAttribute(spans[4].Attributes, AttrMethod.String("x/1")) {
+		t.Errorf("attributes = %v, want the method on the span", spans[4].Attributes)
+	}
+}
+
+func TestMetricsWithoutHasToolOmitTools(t *testing.T) {
+	tt := newTestTelemetry(t, nil)
+
+	tt.serve(spec.MethodToolsCall, map[string]any{"name": "weather"}, 0)
+
+	for _, set := range tt.requestAttributes(t) {
+		if set.HasValue(AttrToolName) {
+			t.Errorf("attributes = %v, want no tool name without HasTool", set.ToSlice())
+		}
+	}
+}
+
+func TestPanickingHandlerIsRecorded(t *testing.T) {
+	tt := newTestTelemetry(t, nil)
+
+	next := handler.MCPHandlerFunc(func(io.RPCResponseWriter, *spec.Request[int]) {
+		panic("boom")
+	})
+
+	// the server recovers the panic outside of the middlewares
+	func() {
+		defer func() { recover() }()
+		req := &spec.Request[int]{Jsonrpc: spec.JsonRPC, ID: 7, Method: spec.MethodToolsList}
+		tt.mw(next).ServeRPC(&bytes.Buffer{}, req)
+	}()
+
+	for _, dp := range tt.dataPoints(t, "mcp.server.requests.in_flight") {
+		if dp.Value != 0 {
+			t.Errorf("in flight = %d, want the request no longer in flight", dp.Value)
+		}
+	}
+
+	requests := tt.dataPoints(t, "mcp.server.requests")
+	if len(requests) != 1 || requests[0].Value != 1 || !requests[0].Attributes.HasValue(AttrErrorCode) {
+		t.Fatalf("requests = %v, want the failed request counted", requests)
+	}
+	if code, _ := requests[0].Attributes.Value(AttrErrorCode); code.AsInt64() != spec.ErrorCodeInternalError {
+		t.Errorf("error code = %d, want %d", code.AsInt64(), spec.ErrorCodeInternalError)
+	}
+
+	spans := tt.spans.GetSpans()
+	if len(spans) != 1 || spans[0].Status.Code != codes.Error {
+		t.Errorf("spans = %v, want an ended span with an error status", spans)
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+// Package ratelimit provides the token bucket and concurrency limits
+// the server applies to tool calls globally, per caller and per tool
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reasons of a LimitError
+const (
+	ReasonRate        = "rate"
+	ReasonConcurrency = "concurrency"
+)
+
+// concurrencyRetryAfter is the retry hint for calls rejected because of
+// the concurrency limit, when the call slots free up can't be known
+const concurrencyRetryAfter = time.Second
+
+type (
+	// Limit configures a Limiter, zero fields disable the respective check
+	Limit struct {
+		// Rate is the number of calls per second sustained by the token bucket
+		Rate float64
+		// Burst is the size of the token bucket, defaults to Rate rounded up
+		Burst int
+		// MaxConcurrent is the number of calls allowed to run at the same time
+		MaxConcurrent int
+		// QueueTimeout is how long a call over the limit waits for capacity
+		// before it is rejected, zero rejects it immediately
+		QueueTimeout time.Duration
+	}
+
+	// Limiter enforces a Limit. It is safe for concurrent use
+	Limiter struct {
+		limit Limit
+
+		mu     sync.Mutex
+		tokens float64
+		last   time.Time
+
+		slots chan struct{}
+
+		allowed  atomic.Uint64
+		rejected atomic.Uint64
+		queued   atomic.Uint64
+		inFlight atomic.Int64
+	}
+
+	// Permit is a call admitted by a Limiter
+	Permit struct {
+		limiter *Limiter
+		once    sync.Once
+	}
+
+	// LimitError is returned for calls over the limit
+	LimitError struct {
+		Reason     string
+		RetryAfter time.Duration
+	}
+
+	// Stats are the counters of a Limiter
+	Stats struct {
+		// Allowed is the number of admitted calls
+		Allowed uint64
+		// Rejected is the number of calls rejected over the limit
+		Rejected uint64
+		// Queued is the number of calls that waited for capacity
+		Queued uint64
+		// InFlight is the number of admitted calls not released yet
+		InFlight int64
+	}
+)
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded, retry after %s", e.Reason, e.RetryAfter.Round(time.Millisecond))
+}
+
+// IsZero reports whether the limit has no checks enabled
+func (l Limit) IsZero() bool {
+	return l.Rate <= 0 && l.MaxConcurrent <= 0
+}
+
+// NewLimiter creates a limiter with a full token bucket
+func NewLimiter(limit Limit) *Limiter {
+	if limit.Rate > 0 && limit.Burst <= 0 {
+		limit.Burst = int(math.Ceil(limit.Rate))
+	}
+
+	l := &Limiter{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+
+	if limit.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+
+	return l
+}
+
+// Acquire admits a call, waiting up to the queue timeout for capacity.
+// Calls over the limit get a *LimitError, a done ctx its error.
+// The permit has to be released once the call completes
+func (l *Limiter) Acquire(ctx context.Context) (*Permit, error) {
+	deadline := time.Now().Add(l.limit.QueueTimeout)
+	waited := false
+
+	if l.limit.Rate > 0 {
+		for {
+			wait, ok := l.takeToken()
+			if ok {
+				break
+			}
+
+			if time.Now().Add(wait).After(deadline) {
+				return nil, l.reject(ReasonRate, wait)
+			}
+
+			waited = true
+			if err := sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				l.returnToken()
+				return nil, l.reject(ReasonConcurrency, concurrencyRetryAfter)
+			}
+
+			waited = true
+			timer := time.NewTimer(remaining)
+			defer timer.Stop()
+
+			select {
+			case l.slots <- struct{}{}:
+			case <-timer.C:
+				l.returnToken()
+				return nil, l.reject(ReasonConcurrency, concurrencyRetryAfter)
+			case <-ctx.Done():
+				l.returnToken()
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	if waited {
+		l.queued.Add(1)
+	}
+	l.allowed.Add(1)
+	l.inFlight.Add(1)
+
+	return &Permit{limiter: l}, nil
+}
+
+// Stats returns a snapshot of the counters
+func (l *Limiter) Stats() Stats {
+	return Stats{
+		Allowed:  l.allowed.Load(),
+		Rejected: l.rejected.Load(),
+		Queued:   l.queued.Load(),
+		InFlight: l.inFlight.Load(),
+	}
+}
+
+// Idle reports whether no call is in flight and the token bucket is full,
+// so that the limiter can be replaced by a new one without any caller noticing
+func (l *Limiter) Idle() bool {
+	if l.inFlight.Load() > 0 {
+		return false
+	}
+
+	if l.limit.Rate <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tokens := l.tokens + time.Since(l.last).Seconds()*l.limit.Rate
+	return tokens >= float64(l.limit.Burst)
+}
+
+// Release frees the concurrency slot of the call, calling it again has no effect
+func (p *Permit) Release() {
+	p.once.Do(func() {
+		if p.limiter.slots != nil {
+			<-p.limiter.slots
+		}
+		p.limiter.inFlight.Add(-1)
+	})
+}
+
+// Cancel releases the permit of a call that didn't run, e.g. because
+// another limit rejected it, and returns its token to the bucket
+func (p *Permit) Cancel() {
+	p.once.Do(func() {
+		if p.limiter.slots != nil {
+			<-p.limiter.slots
+		}
+		p.limiter.inFlight.Add(-1)
+		p.limiter.allowed.Add(^uint64(0))
+		p.limiter.returnToken()
+	})
+}
+
+// Add returns the sum of the counters
+func (s Stats) Add(other Stats) Stats {
+	return Stats{
+		Allowed:  s.Allowed + other.Allowed,
+		Rejected: s.Rejected + other.Rejected,
+		Queued:   s.Queued + other.Queued,
+		InFlight: s.InFlight + other.InFlight,
+	}
+}
+
+// takeToken takes a token from the bucket,
+// or returns how long it takes until one is available
+func (l *Limiter) takeToken() (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limit.Rate)
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+
+	return time.Duration((1 - l.tokens) / l.limit.Rate * float64(time.Second)), false
+}
+
+func (l *Limiter) returnToken() {
+	if l.limit.Rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(float64(l.limit.Burst), l.tokens+1)
+}
+
+func (l *Limiter) reject(reason string, retryAfter time.Duration) *LimitError {
+	l.rejected.Add(1)
+	return &LimitError{Reason: reason, RetryAfter: retryAfter}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterIdle(t *testing.T) {
+	limiter := NewLimiter(Limit{Rate: 1000, Burst: 2, MaxConcurrent: 2})
+	if !limiter.Idle() {
+		t.Fatal("want a new limiter idle")
+	}
+
+	permit, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limiter.Idle() {
+		t.Error("want a limiter with a call in flight busy")
+	}
+
+	permit.Release()
+	time.Sleep(5 * time.Millisecond)
+	if !limiter.Idle() {
+		t.Error("want the limiter idle once the bucket has refilled")
+	}
+}
+
+func TestLimiterIdleWithEmptyBucket(t *testing.T) {
+	limiter := NewLimiter(Limit{Rate: 0.001, Burst: 1})
+
+	permit, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	permit.Release()
+
+	if limiter.Idle() {
+		t.Error("want a limiter with an empty bucket busy")
+	}
+}
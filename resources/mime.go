@@ -0,0 +1,142 @@
+package resources
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// SniffLen is the number of bytes DetectMimeType looks at
+const SniffLen = 512
+
+// defaultMimeType is the MIME type of binary data of unknown type
+const defaultMimeType = "application/octet-stream"
+
+// extensionMimeTypes completes the MIME types known to the mime package,
+// which depend on the system, with types common in resources
+var extensionMimeTypes = map[string]string{
+	".txt":  "text/plain; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".html": "text/html; charset=utf-8",
+	".css":  "text/css; charset=utf-8",
+	".js":   "text/javascript; charset=utf-8",
+	".json": "application/json",
+	".xml":  "application/xml",
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".toml": "application/toml",
+	".pdf":  "application/pdf",
+	".zip":  "application/zip",
+	".gz":   "application/gzip",
+	".tar":  "application/x-tar",
+	".wasm": "application/wasm",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".bmp":  "image/bmp",
+	".ico":  "image/x-icon",
+	".svg":  "image/svg+xml",
+	".avif": "image/avif",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+}
+
+// sniffedImageTypes are the image types http.DetectContentType recognises.
+// Images of other types, like SVG, can't be checked against their data
+var sniffedImageTypes = map[string]bool{
+	"image/png":    true,
+	"image/jpeg":   true,
+	"image/gif":    true,
+	"image/webp":   true,
+	"image/bmp":    true,
+	"image/x-icon": true,
+}
+
+// DetectMimeType returns the MIME type of a resource from the extension of the first
+// of its names or URIs having a known one, falling back to sniffing
+// the first SniffLen bytes of its data with http.DetectContentType
+func DetectMimeType(data []byte, names ...string) string {
+	if mimeType := MimeTypeByExtension(names...); mimeType != "" {
+		return mimeType
+	}
+
+	if len(data) == 0 {
+		return defaultMimeType
+	}
+	return http.DetectContentType(data)
+}
+
+// CheckImageMimeType reports an error if the data of an image doesn't match its declared MIME type.
+// Declared types which can't be recognised from the data are accepted
+func CheckImageMimeType(mimeType string, data []byte) error {
+	declared := normalizeMimeType(mimeType)
+	if !sniffedImageTypes[declared] {
+		return nil
+	}
+
+	detected := normalizeMimeType(http.DetectContentType(data))
+	if detected != declared {
+		return fmt.Errorf("image declared as %s contains %s data", mimeType, detected)
+	}
+	return nil
+}
+
+// MimeTypeByExtension returns the MIME type for the extension of the first of the names
+// or URIs having a known one, empty if none has
+func MimeTypeByExtension(names ...string) string {
+	for _, name := range names {
+		if mimeType := mimeTypeByExtension(name); mimeType != "" {
+			return mimeType
+		}
+	}
+	return ""
+}
+
+func mimeTypeByExtension(name string) string {
+	if u, err := url.Parse(name); err == nil && u.Scheme != "" {
+		name = u.Path
+	}
+
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return ""
+	}
+
+	if mimeType, ok := extensionMimeTypes[ext]; ok {
+		return mimeType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// normalizeMimeType strips the parameters of a MIME type and resolves common aliases
+func normalizeMimeType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(mimeType))
+	}
+
+	switch mediaType {
+	case "image/jpg", "image/pjpeg":
+		return "image/jpeg"
+	case "image/vnd.microsoft.icon":
+		return "image/x-icon"
+	case "image/x-ms-bmp":
+		return "image/bmp"
+	}
+	return mediaType
+}
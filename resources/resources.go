@@ -1,5 +1,7 @@
 package resources
 
+import "github.com/makarski/mcp-robot/spec"
+
 type ResourceType string
 
 const (
@@ -19,6 +21,8 @@ type (
 		Description string `json:"description,omitempty"`
 		MimeType    string `json:"mimeType,omitempty"`
 		Size        int64  `json:"size,omitempty"`
+		// Meta is additional metadata sent as _meta
+		Meta map[string]any `json:"_meta,omitempty"`
 	}
 
 	ResourceText struct {
@@ -28,14 +32,15 @@ type (
 
 	ResourceBinary struct {
 		resource
-		// Base64 encoded binary data
-		Blob []byte `json:"blob"`
+		// Blob is the binary data, base64 encoded in JSON
+		Blob spec.Blob `json:"blob"`
 	}
 
 	// Only used in Tools for now
 	ResourceLink struct {
 		Type ResourceType `json:"type"`
 		resource
+		Annotations *spec.Annotations `json:"annotations,omitempty"`
 	}
 )
 
@@ -52,7 +57,13 @@ func NewResourceText(uri, name, title, description, mimeType, text string) Resou
 	}
 }
 
+// NewResourceBinary returns a binary resource. An empty mimeType is detected
+// from the extension of uri or name and from the data, see DetectMimeType
 func NewResourceBinary(uri, name, title, description, mimeType string, blob []byte) ResourceBinary {
+	if mimeType == "" {
+		mimeType = DetectMimeType(blob, uri, name)
+	}
+
 	return ResourceBinary{
 		resource: resource{
 			URI:         uri,
@@ -0,0 +1,107 @@
+package resources
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestResourceBinaryRoundTrip(t *testing.T) {
+	data := []byte{0x00, 0xff, 0x10, 0x80, 0x7f}
+	resource := NewResourceBinary("file:///data.bin", "data.bin", "Data", "Raw data", "application/x-raw", data)
+
+	encoded, err := json.Marshal(resource)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var fields map[string]any
+	json.Unmarshal(encoded, &fields)
+	if fields["blob"] != "AP8QgH8=" {
+		t.Errorf("blob = %v, want standard padded base64", fields["blob"])
+	}
+	if fields["size"] != float64(len(data)) {
+		t.Errorf("size = %v, want %d", fields["size"], len(data))
+	}
+
+	var decoded ResourceBinary
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(decoded.Blob, data) || decoded.URI != resource.URI || decoded.MimeType != resource.MimeType {
+		t.Errorf("decoded %+v, want %+v", decoded, resource)
+	}
+}
+
+func TestResourceBinaryEmptyBlob(t *testing.T) {
+	encoded, _ := json.Marshal(NewResourceBinary("file:///empty", "empty", "", "", "", nil))
+
+	var fields map[string]any
+	json.Unmarshal(encoded, &fields)
+	if fields["blob"] != "" {
+		t.Errorf("blob = %v, want an empty string", fields["blob"])
+	}
+}
+
+func TestNewResourceBinaryDetectsMimeType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	tests := []struct {
+		name     string
+		uri      string
+		resName  string
+		mimeType string
+		data     []byte
+		want     string
+	}{
+		{"declared", "file:///a.png", "a.png", "image/custom", png, "image/custom"},
+		{"uri extension", "file:///reports/q1.pdf", "report", "", []byte("data"), "application/pdf"},
+		{"name extension", "db://reports/1", "q1.csv", "", []byte("data"), "text/csv; charset=utf-8"},
+		{"uri query ignored", "https://example.com/a.md?v=1", "a", "", nil, "text/markdown; charset=utf-8"},
+		{"upper case extension", "file:///A.JPG", "A", "", nil, "image/jpeg"},
+		{"sniffed", "db://images/1", "image", "", png, "image/png"},
+		{"unknown", "db://blobs/1", "blob", "", []byte{0, 1, 2, 3}, "application/octet-stream"},
+		{"empty", "db://blobs/2", "blob", "", nil, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := NewResourceBinary(tt.uri, tt.resName, "", "", tt.mimeType, tt.data)
+			if resource.MimeType != tt.want {
+				t.Errorf("MimeType = %q, want %q", resource.MimeType, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckImageMimeType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	gif := []byte("GIF89a\x01\x00\x01\x00")
+
+	tests := []struct {
+		name     string
+		mimeType string
+		data     []byte
+		wantErr  bool
+	}{
+		{"png", "image/png", png, false},
+		{"jpeg", "image/jpeg", jpeg, false},
+		{"jpg alias", "image/jpg", jpeg, false},
+		{"parameters", "image/png; name=chart", png, false},
+		{"gif", "image/gif", gif, false},
+		{"png declared as jpeg", "image/jpeg", png, true},
+		{"text declared as png", "image/png", []byte("hello"), true},
+		{"svg not sniffable", "image/svg+xml", []byte("<svg/>"), false},
+		{"unknown type", "image/x-custom", []byte{1, 2, 3}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckImageMimeType(tt.mimeType, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckImageMimeType(%q) = %v, want error %v", tt.mimeType, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	stdio "io"
+	"log/slog"
+	"time"
+
+	"github.com/makarski/mcp-robot/audit"
+	"github.com/makarski/mcp-robot/auth"
+	"github.com/makarski/mcp-robot/handler"
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+	"github.com/makarski/mcp-robot/tools"
+)
+
+// auditWriter keeps the outcome of the response to an audited tool call
+type auditWriter struct {
+	w       io.RPCResponseWriter
+	outcome responseOutcome
+	written bool
+}
+
+// WithAuditSink records every tool call in the sinks, including calls that are denied,
+// rate limited or rejected because of invalid arguments. Arguments marked sensitive
+// in the input schema are redacted. Calls are recorded by a middleware added like with Use
+func (s *server) WithAuditSink(sinks ...audit.Sink) *server {
+	s.mu.Lock()
+	for _, sink := range sinks {
+		s.middlewares = append(s.middlewares, s.auditMiddleware(sink))
+	}
+	s.mu.Unlock()
+
+	return s
+}
+
+// auditMiddleware records the tool calls in the sink once they complete
+func (s *server) auditMiddleware(sink audit.Sink) handler.Middleware {
+	return func(next handler.MCPHandler) handler.MCPHandler {
+		return handler.MCPHandlerFunc(func(w io.RPCResponseWriter, req *spec.Request[int]) {
+			if req.Method != spec.MethodToolsCall {
+				next.ServeRPC(w, req)
+				return
+			}
+
+			start := time.Now()
+			aw := &auditWriter{w: w}
+
+			defer func() {
+				v := recover()
+
+				record := s.auditRecord(req, aw, v != nil)
+				record.Time = start
+				record.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+
+				// the record is written even if the call has been cancelled
+				s.writeAuditRecord(context.WithoutCancel(req.Context()), sink, record)
+
+				if v != nil {
+					panic(v)
+				}
+			}()
+
+			next.ServeRPC(aw, req)
+		})
+	}
+}
+
+// auditRecord describes the tool call and the response written for it
+func (s *server) auditRecord(req *spec.Request[int], aw *auditWriter, panicked bool) audit.Record {
+	ctx := req.Context()
+
+	name, _ := req.Params["name"].(string)
+	record := audit.Record{
+		Tool:      name,
+		RequestID: req.RequestID(),
+	}
+
+	if sess, ok := session.FromContext(ctx); ok {
+		record.SessionID = sess.ID()
+		record.Subject = sess.Principal()
+		record.Client = sess.ClientInfo().Name
+	}
+
+	if info, ok := auth.FromContext(ctx); ok {
+		record.Subject = info.Subject
+	}
+
+	s.mu.RLock()
+	tool, ok := s.tools[name]
+	s.mu.RUnlock()
+
+	// the arguments of unknown tools can't be redacted, they are left out
+	if ok {
+		record.Destructive = tool.toolDefinition.IsDestructive()
+		if args, ok := req.Params["arguments"].(map[string]any); ok {
+			record.Arguments = tool.toolDefinition.RedactArguments(args)
+		}
+	}
+
+	switch {
+	case panicked:
+		record.Outcome = audit.OutcomePanic
+		record.ErrorCode = spec.ErrorCodeInternalError
+	case !aw.written:
+		record.Outcome = audit.OutcomeCancelled
+	case aw.outcome.Error != nil:
+		record.ErrorCode = aw.outcome.Error.Code
+		record.Error = aw.outcome.Error.Message
+
+		switch record.ErrorCode {
+		case spec.ErrorCodeToolForbidden:
+			record.Outcome = audit.OutcomeDenied
+		case spec.ErrorCodeRateLimited:
+			record.Outcome = audit.OutcomeRateLimited
+		default:
+			record.Outcome = audit.OutcomeError
+		}
+	case aw.outcome.Result != nil && aw.outcome.Result.IsError:
+		record.Outcome = audit.OutcomeToolError
+	default:
+		record.Outcome = audit.OutcomeSuccess
+	}
+
+	return record
+}
+
+// writeAuditRecord hands the record to the sink, the call is not failed if the sink fails
+func (s *server) writeAuditRecord(ctx context.Context, sink audit.Sink, record audit.Record) {
+	if err := sink.Record(ctx, record); err != nil {
+		s.mu.RLock()
+		logger := s.logger
+		s.mu.RUnlock()
+
+		logger.ErrorContext(ctx, "failed to write audit record", "tool", record.Tool, "request", record.RequestID, "error", err)
+	}
+}
+
+// logToolCall logs the call with the sensitive arguments redacted at the debug level
+func (s *server) logToolCall(ctx context.Context, definition tools.ToolDefinition, rpcReq *spec.Request[int]) {
+	s.mu.RLock()
+	logger := s.logger
+	s.mu.RUnlock()
+
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	args, _ := rpcReq.Params["arguments"].(map[string]any)
+	logger.DebugContext(ctx, "calling tool", "tool", definition.Name, "request", rpcReq.RequestID(), "arguments", definition.RedactArguments(args))
+}
+
+func (aw *auditWriter) Write(b []byte) (int, error) {
+	if !aw.written {
+		aw.written = true
+		aw.outcome = decodeOutcome(b)
+	}
+	return aw.w.Write(b)
+}
+
+// WriteResultStream records the streamed response as successful, only results are streamed
+func (aw *auditWriter) WriteResultStream(write func(w stdio.Writer) error) error {
+	aw.written = true
+	return io.WriteResultStream(aw.w, write)
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/makarski/mcp-robot/audit"
+	"github.com/makarski/mcp-robot/auth"
+	"github.com/makarski/mcp-robot/spec"
+	"github.com/makarski/mcp-robot/tools"
+)
+
+// auditRecorder is a sink keeping the records in memory
+type auditRecorder struct {
+	mu      sync.Mutex
+	records []audit.Record
+}
+
+func (r *auditRecorder) Record(_ context.Context, record audit.Record) error {
+	r.mu.Lock()
+	r.records = append(r.records, record)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *auditRecorder) last(t *testing.T) audit.Record {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.records) == 0 {
+		t.Fatal("no audit record")
+	}
+	return r.records[len(r.records)-1]
+}
+
+func TestAuditRecordRedactsSensitiveArguments(t *testing.T) {
+	login := tools.NewTool("login").
+		Description("Signs in to the backend").
+		Input().
+		WithString("user", "User name", true).
+		WithString("password", "Password", true).Sensitive().
+		WithArray("keys", "API keys", false).Of("object", "API key").
+		WithString("name", "Key name", true).
+		WithString("secret", "Key secret", true).Sensitive().
+		Done().
+		Build()
+
+	var logs bytes.Buffer
+	sink := &auditRecorder{}
+	srv := NewServerBuilder("test", "1.0.0").
+		WithTool(login, tools.ToolFunc[tools.ToolResultText](func(args map[string]any) (tools.ToolResultText, error) {
+			if args["password"] != "hunter2" {
+				return tools.ToolResultText{}, errors.New("the tool gets the plain arguments")
+			}
+			return tools.NewToolResultText("signed in"), nil
+		})).
+		WithAuditSink(sink).
+		WithLogger(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	sess := newBatchSession(spec.ProtocolVersion20250618)
+
+	ctx := auth.NewContext(context.Background(), &auth.TokenInfo{Subject: "alice"})
+	var buf bytes.Buffer
+	srv.serveRequest(ctx, sess, &buf, &spec.Request[int]{
+		Jsonrpc: spec.JsonRPC,
+		ID:      7,
+		Method:  spec.MethodToolsCall,
+		Params: map[string]any{
+			"name": "login",
+			"arguments": map[string]any{
+				"user":     "alice",
+				"password": "hunter2",
+				"keys":     []any{map[string]any{"name": "ci", "secret": "key-secret"}},
+			},
+		},
+	})
+
+	if !strings.Contains(buf.String(), "signed in") {
+		t.Fatalf("response = %s, want the tool result", buf.String())
+	}
+
+	record := sink.last(t)
+	want := map[string]any{
+		"user":     "alice",
+		"password": tools.Redacted,
+		"keys":     []any{map[string]any{"name": "ci", "secret": tools.Redacted}},
+	}
+	if !reflect.DeepEqual(record.Arguments, want) {
+		t.Errorf("arguments = %v, want %v", record.Arguments, want)
+	}
+
+	if record.Tool != "login" || record.RequestID != 7 || record.Subject != "alice" || record.Outcome != audit.OutcomeSuccess {
+		t.Errorf("record = %+v, want the successful call of login by alice", record)
+	}
+	if !record.Destructive {
+		t.Error("tool without annotations not flagged destructive")
+	}
+
+	for _, secret := range []string{"hunter2", "key-secret"} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("debug log contains the sensitive value %q: %s", secret, logs.String())
+		}
+	}
+	if !strings.Contains(logs.String(), "calling tool") {
+		t.Errorf("debug log = %s, want the tool call", logs.String())
+	}
+}
+
+func TestAuditRecordOutcome(t *testing.T) {
+	lookup := tools.NewTool("lookup").
+		Description("Looks up").
+		MarkReadOnly(true).
+		Input().
+		WithString("q", "Query", false).
+		WithBoolean("fail", "Fails the lookup", false).
+		Done().
+		Build()
+	admin := tools.NewTool("admin").Description("Administers").RequireScopes("admin").Build()
+
+	sink := &auditRecorder{}
+	srv := NewServerBuilder("test", "1.0.0").
+		WithTool(lookup, tools.ToolFunc[tools.ToolResultText](func(args map[string]any) (tools.ToolResultText, error) {
+			if args["fail"] == true {
+				return tools.ToolResultText{}, errors.New("backend down")
+			}
+			return tools.NewToolResultText("found"), nil
+		})).
+		WithTool(admin, tools.ToolFunc[tools.ToolResultText](func(map[string]any) (tools.ToolResultText, error) {
+			return tools.NewToolResultText("done"), nil
+		})).
+		WithAuditSink(sink)
+	sess := newBatchSession(spec.ProtocolVersion20250618)
+
+	tests := []struct {
+		name        string
+		params      map[string]any
+		outcome     string
+		code        int
+		destructive bool
+		arguments   bool
+	}{
+		{"success", map[string]any{"name": "lookup", "arguments": map[string]any{"q": "x"}}, audit.OutcomeSuccess, 0, false, true},
+		{"tool error", map[string]any{"name": "lookup", "arguments": map[string]any{"fail": true}}, audit.OutcomeToolError, 0, false, true},
+		{"denied", map[string]any{"name": "admin"}, audit.OutcomeDenied, spec.ErrorCodeToolForbidden, true, false},
+		{"unknown tool", map[string]any{"name": "missing", "arguments": map[string]any{"password": "hunter2"}}, audit.OutcomeError, spec.ErrorCodeInvalidParams, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			srv.serveRequest(context.Background(), sess, &buf, &spec.Request[int]{
+				Jsonrpc: spec.JsonRPC, ID: 1, Method: spec.MethodToolsCall, Params: tt.params,
+			})
+
+			record := sink.last(t)
+			if record.Outcome != tt.outcome || record.ErrorCode != tt.code {
+				t.Errorf("outcome = %s %d, want %s %d", record.Outcome, record.ErrorCode, tt.outcome, tt.code)
+			}
+			if record.Destructive != tt.destructive {
+				t.Errorf("destructive = %v, want %v", record.Destructive, tt.destructive)
+			}
+			// the arguments of unknown tools can't be redacted and are left out
+			if hasArguments := record.Arguments != nil; hasArguments != tt.arguments {
+				t.Errorf("arguments = %v, want recorded %v", record.Arguments, tt.arguments)
+			}
+		})
+	}
+}
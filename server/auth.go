@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/makarski/mcp-robot/auth"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// WithAuthorization protects the MCP endpoint: every request has to carry
+// a bearer token accepted by the verifier. The metadata is served at the
+// well-known protected resource path and referenced by 401 responses.
+// The verified token is available to handlers through auth.FromContext.
+// Tokens the verifier accepts without a subject are rejected
+func (s *HTTPServer) WithAuthorization(verifier auth.TokenVerifier, metadata auth.ProtectedResourceMetadata) *HTTPServer {
+	s.verifier = verifier
+	s.resourceMetadata = &metadata
+	return s
+}
+
+// ProtectedResourceMetadataHandler serves the protected resource metadata document.
+// It is registered by Handler, use it when mounting the server on a custom router
+func (s *HTTPServer) ProtectedResourceMetadataHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if s.resourceMetadata == nil {
+			http.NotFound(w, req)
+			return
+		}
+
+		metadata := *s.resourceMetadata
+		if metadata.Resource == "" {
+			metadata.Resource = requestOrigin(req) + s.endpoint
+		}
+
+		if len(metadata.BearerMethodsSupported) == 0 {
+			metadata.BearerMethodsSupported = []string{"header"}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		json.NewEncoder(w).Encode(metadata)
+	})
+}
+
+// authorize verifies the bearer token of the request and returns the request
+// with the token info attached to its context. On failure the 401 response
+// has been written and false is returned
+func (s *HTTPServer) authorize(w http.ResponseWriter, req *http.Request) (*http.Request, bool) {
+	if s.verifier == nil {
+		return req, true
+	}
+
+	token, err := auth.BearerToken(req.Header.Get("Authorization"))
+	if err != nil {
+		s.writeUnauthorized(w, req, "", err)
+		return nil, false
+	}
+
+	info, err := s.verifier.VerifyToken(req.Context(), token)
+	if err == nil && (info == nil || info.Subject == "") {
+		// sessions are bound to the subject, callers without one can't be told apart
+		err = fmt.Errorf("%w: missing subject", auth.ErrInvalidToken)
+	}
+	if err != nil {
+		s.writeUnauthorized(w, req, "invalid_token", err)
+		return nil, false
+	}
+
+	return req.WithContext(auth.NewContext(req.Context(), info)), true
+}
+
+// writeUnauthorized answers with 401 and a WWW-Authenticate challenge
+// pointing the client to the protected resource metadata
+func (s *HTTPServer) writeUnauthorized(w http.ResponseWriter, req *http.Request, errorCode string, err error) {
+	description := err.Error()
+	if errorCode != "" && !errors.Is(err, auth.ErrExpiredToken) && !errors.Is(err, auth.ErrInvalidToken) {
+		// don't leak the internals of custom verifiers
+		description = auth.ErrInvalidToken.Error()
+	}
+
+	challenge := fmt.Sprintf(`Bearer resource_metadata="%s"`, s.metadataURL(req))
+	if errorCode != "" {
+		challenge += fmt.Sprintf(`, error="%s", error_description="%s"`, errorCode, strings.ReplaceAll(description, `"`, `'`))
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeHTTPError(w, http.StatusUnauthorized, newMessageError(nil, spec.ErrorCodeInvalidRequest, fmt.Sprintf("unauthorized: %s", description)))
+}
+
+func (s *HTTPServer) metadataURL(req *http.Request) string {
+	if s.resourceMetadata != nil && s.resourceMetadata.Resource != "" {
+		if u, err := auth.MetadataURL(s.resourceMetadata.Resource); err == nil {
+			return u
+		}
+	}
+
+	return requestOrigin(req) + auth.WellKnownPath + s.endpoint
+}
+
+// principal returns the authenticated subject of the request, if any
+func principal(req *http.Request) string {
+	if info, ok := auth.FromContext(req.Context()); ok {
+		return info.Subject
+	}
+	return ""
+}
+
+func requestOrigin(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
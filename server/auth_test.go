@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/makarski/mcp-robot/auth"
+)
+
+// newTestRequest returns a request to a local server, other hosts are rejected by default
+func newTestRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Host = "localhost:8080"
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	return req
+}
+
+func TestUnauthorizedHidesVerifierInternals(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		err      error
+		want     string
+		internal string
+	}{
+		{"missing token", "", nil, "unauthorized: ", ""},
+		{"invalid token", "Bearer t", fmt.Errorf("%w: signature verification failed", auth.ErrInvalidToken), "signature verification failed", ""},
+		{"expired token", "Bearer t", auth.ErrExpiredToken, auth.ErrExpiredToken.Error(), ""},
+		{"custom verifier error", "Bearer t", errors.New("dial tcp 10.0.0.7:5432: connection refused"), auth.ErrInvalidToken.Error(), "10.0.0.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := auth.TokenVerifierFunc(func(context.Context, string) (*auth.TokenInfo, error) {
+				return nil, tt.err
+			})
+
+			srv := NewServerBuilder("test", "1.0.0").BuildHTTPServer().
+				WithAuthorization(verifier, auth.ProtectedResourceMetadata{Resource: "https://mcp.example.com/mcp"})
+
+			req := newTestRequest(http.MethodPost, "/mcp", `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", rec.Code)
+			}
+
+			body := rec.Body.String()
+			challenge := rec.Header().Get("WWW-Authenticate")
+			if !strings.Contains(body, tt.want) {
+				t.Errorf("body = %s, want it to contain %q", body, tt.want)
+			}
+			if tt.internal != "" && (strings.Contains(body, tt.internal) || strings.Contains(challenge, tt.internal)) {
+				t.Errorf("body = %s, challenge = %s, want the verifier error hidden", body, challenge)
+			}
+		})
+	}
+}
+
+func TestTokenWithoutSubjectIsRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		info   *auth.TokenInfo
+		status int
+	}{
+		{"nil token info", nil, http.StatusUnauthorized},
+		{"empty subject", &auth.TokenInfo{Scopes: []string{"read"}}, http.StatusUnauthorized},
+		{"subject", &auth.TokenInfo{Subject: "user"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := auth.TokenVerifierFunc(func(context.Context, string) (*auth.TokenInfo, error) {
+				return tt.info, nil
+			})
+
+			srv := NewServerBuilder("test", "1.0.0").BuildHTTPServer().
+				WithAuthorization(verifier, auth.ProtectedResourceMetadata{Resource: "https://mcp.example.com/mcp"})
+
+			req := newTestRequest(http.MethodPost, "/mcp", initializeRequest)
+			req.Header.Set("Authorization", "Bearer t")
+
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body = %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusUnauthorized {
+				if challenge := rec.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, `error="invalid_token"`) {
+					t.Errorf("challenge = %q, want an invalid_token error", challenge)
+				}
+				if rec.Header().Get(headerSessionID) != "" {
+					t.Error("session created for a token without subject")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// serveBatch processes the elements of a JSON-RPC batch concurrently
+// and returns the encoded array of responses.
+// Notifications are left out, if no responses remain nil is returned
+func (s *server) serveBatch(ctx context.Context, sess *session.Session, raw []byte) []byte {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(raw, &elements); err != nil {
+		return encodeError(newMessageError(nil, spec.ErrorCodeParseError, fmt.Sprintf("Failed to decode batch: %s", err)))
+	}
+
+	if len(elements) == 0 {
+		return encodeError(newMessageError(nil, spec.ErrorCodeInvalidRequest, "empty batch"))
+	}
+
+	if !sess.Features().Batching {
+		return encodeError(newMessageError(
+			nil,
+			spec.ErrorCodeInvalidRequest,
+			fmt.Sprintf("batch requests are not supported by protocol version %s", sess.ProtocolVersion()),
+		))
+	}
+
+	responses := make([]bytes.Buffer, len(elements))
+
+	var wg sync.WaitGroup
+	for i, element := range elements {
+		msg, msgErr := decodeMessage(element)
+		if msgErr != nil {
+			if msgErr.Code == spec.ErrorCodeParseError {
+				// the batch itself is valid JSON, so is every element
+				msgErr.Code = spec.ErrorCodeInvalidRequest
+			}
+			msgErr.writeTo(&responses[i])
+			continue
+		}
+
+		rpcReq := msg.req
+		switch msg.kind {
+		case kindResponse:
+			// responses to server requests are not answered
+			continue
+		case kindNotification:
+			s.serveNotification(ctx, sess, &rpcReq)
+			continue
+		}
+
+		if rpcReq.Method == spec.MethodInitialize {
+			io.NewResponseWriter(withResponseID(&responses[i], &rpcReq), rpcReq.ID).WriteError(
+				spec.ErrorCodeInvalidRequest,
+				"initialize must not be part of a batch",
+			)
+			continue
+		}
+
+		wg.Add(1)
+		go func(w *bytes.Buffer) {
+			defer wg.Done()
+			s.serveRequest(ctx, sess, w, &rpcReq)
+		}(&responses[i])
+	}
+	wg.Wait()
+
+	encoded := make([][]byte, 0, len(responses))
+	for _, response := range responses {
+		if b := bytes.TrimSpace(response.Bytes()); len(b) > 0 {
+			encoded = append(encoded, b)
+		}
+	}
+
+	if len(encoded) == 0 {
+		return nil
+	}
+
+	var out bytes.Buffer
+	out.WriteByte('[')
+	out.Write(bytes.Join(encoded, []byte(",")))
+	out.WriteString("]\n")
+
+	return out.Bytes()
+}
+
+func encodeError(err *messageError) []byte {
+	var buf bytes.Buffer
+	err.writeTo(&buf)
+	return buf.Bytes()
+}
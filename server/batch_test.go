@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+type batchResponse struct {
+	ID    *int `json:"id"`
+	Error *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+	Result map[string]any `json:"result"`
+}
+
+func newBatchSession(version string) *session.Session {
+	sess := session.New(session.NewID())
+	sess.Initialize(version, spec.Info{Name: "test", Version: "1.0.0"}, spec.ClientCapabilities{})
+	sess.MarkReady()
+	return sess
+}
+
+func TestServeBatch(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		// codes are the error codes of the responses ordered by id, 0 for results
+		codes []int
+		// single is the error code of a response that is not an array
+		single int
+	}{
+		{
+			name:  "requests",
+			raw:   `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","id":2,"method":"tools/list"}]`,
+			codes: []int{0, 0},
+		},
+		{
+			name:  "requests and notifications",
+			raw:   `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":9}}]`,
+			codes: []int{0},
+		},
+		{
+			name: "notifications only",
+			raw:  `[{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","method":"notifications/roots/list_changed"}]`,
+		},
+		{
+			name: "responses only",
+			raw:  `[{"jsonrpc":"2.0","id":5,"result":{}}]`,
+		},
+		{
+			name:  "unknown method",
+			raw:   `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","id":2,"method":"x/unknown"}]`,
+			codes: []int{0, spec.ErrorCodeMethodNotFound},
+		},
+		{
+			name:  "initialize",
+			raw:   `[{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}]`,
+			codes: []int{spec.ErrorCodeInvalidRequest},
+		},
+		{
+			name:  "invalid element",
+			raw:   `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"1.0","id":2,"method":"ping"}]`,
+			codes: []int{0, spec.ErrorCodeInvalidRequest},
+		},
+		{
+			name:   "empty",
+			raw:    `[]`,
+			single: spec.ErrorCodeInvalidRequest,
+		},
+		{
+			name:   "not an array of values",
+			raw:    `[1,`,
+			single: spec.ErrorCodeParseError,
+		},
+	}
+
+	srv := NewServerBuilder("test", "1.0.0")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := newBatchSession(spec.ProtocolVersion20250326)
+			out := srv.serveBatch(context.Background(), sess, []byte(tt.raw))
+
+			if tt.single != 0 {
+				var response batchResponse
+				if err := json.Unmarshal(out, &response); err != nil || response.Error == nil || response.Error.Code != tt.single {
+					t.Fatalf("response = %s, want error %d", out, tt.single)
+				}
+				return
+			}
+
+			if len(tt.codes) == 0 {
+				if out != nil {
+					t.Fatalf("response = %s, want none", out)
+				}
+				return
+			}
+
+			var responses []batchResponse
+			if err := json.Unmarshal(out, &responses); err != nil {
+				t.Fatalf("invalid response %s: %v", out, err)
+			}
+			if len(responses) != len(tt.codes) {
+				t.Fatalf("responses = %s, want %d", out, len(tt.codes))
+			}
+
+			sort.Slice(responses, func(i, j int) bool { return *responses[i].ID < *responses[j].ID })
+			for i, response := range responses {
+				code := 0
+				if response.Error != nil {
+					code = response.Error.Code
+				}
+				if code != tt.codes[i] {
+					t.Errorf("response %d code = %d, want %d", *response.ID, code, tt.codes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServeBatchByProtocolVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		allowed bool
+	}{
+		{spec.ProtocolVersion20241105, true},
+		{spec.ProtocolVersion20250326, true},
+		{spec.ProtocolVersion20250618, false},
+	}
+
+	srv := NewServerBuilder("test", "1.0.0")
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			out := srv.serveBatch(context.Background(), newBatchSession(tt.version), []byte(`[{"jsonrpc":"2.0","id":1,"method":"ping"}]`))
+
+			var responses []batchResponse
+			isArray := json.Unmarshal(out, &responses) == nil
+			if isArray != tt.allowed {
+				t.Fatalf("response = %s, want batching allowed %v", out, tt.allowed)
+			}
+
+			if !tt.allowed {
+				var response batchResponse
+				json.Unmarshal(out, &response)
+				if response.Error == nil || response.Error.Code != spec.ErrorCodeInvalidRequest || response.ID != nil {
+					t.Errorf("response = %s, want an invalid request error with a null id", out)
+				}
+			}
+		})
+	}
+}
+
+func TestServeBatchNotificationsReachTheSession(t *testing.T) {
+	srv := NewServerBuilder("test", "1.0.0")
+	sess := session.New(session.NewID())
+	sess.Initialize(spec.ProtocolVersion20250326, spec.Info{}, spec.ClientCapabilities{})
+
+	if out := srv.serveBatch(context.Background(), sess, []byte(`[{"jsonrpc":"2.0","method":"notifications/initialized"}]`)); out != nil {
+		t.Fatalf("response = %s, want none", out)
+	}
+	if !sess.Ready() {
+		t.Error("want the session ready after notifications/initialized in a batch")
+	}
+}
+
+func TestHTTPBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		raw     string
+		status  int
+		array   bool
+	}{
+		{"requests", spec.ProtocolVersion20250326, `[{"jsonrpc":"2.0","id":2,"method":"ping"}]`, http.StatusOK, true},
+		{"notifications only", spec.ProtocolVersion20250326, `[{"jsonrpc":"2.0","method":"notifications/initialized"}]`, http.StatusAccepted, false},
+		{"unsupported version", spec.ProtocolVersion20250618, `[{"jsonrpc":"2.0","id":2,"method":"ping"}]`, http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewServerBuilder("test", "1.0.0").BuildHTTPServer().Handler()
+			sessionID := initializeSession(t, h, tt.version)
+
+			req := newTestRequest(http.MethodPost, "/mcp", tt.raw)
+			req.Header.Set(headerSessionID, sessionID)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body = %s", rec.Code, tt.status, rec.Body)
+			}
+
+			body := bytes.TrimSpace(rec.Body.Bytes())
+			if isArray := len(body) > 0 && body[0] == '['; isArray != tt.array {
+				t.Errorf("body = %s, want an array %v", body, tt.array)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/makarski/mcp-robot/spec"
+	"github.com/makarski/mcp-robot/tools"
+)
+
+// chart is a custom result rendering itself into a summary, an image and structured data
+type chart struct {
+	title  string
+	points []int
+}
+
+func (c chart) MarshalContent() (tools.ToolResultContent, error) {
+	summary := tools.NewToolResultText(fmt.Sprintf("%s: %d points", c.title, len(c.points)))
+	summary.Annotations = &spec.Annotations{Audience: []spec.Role{spec.RoleAssistant}}
+
+	points := make([]any, len(c.points))
+	for i, p := range c.points {
+		points[i] = p
+	}
+
+	return tools.ToolResultContent{
+		Content:    []tools.ContentBlock{summary, tools.NewToolResultImage([]byte("png"), "image/png")},
+		Structured: tools.ToolResultStructured{"title": c.title, "points": points},
+		Meta:       map[string]any{"renderer": "chart"},
+	}, nil
+}
+
+func TestToolsCallContent(t *testing.T) {
+	plot := tools.NewTool("plot").
+		Description("Plots a chart").
+		Output().
+		WithString("title", "Chart title", true).
+		WithArray("points", "Data points", true).Of("integer", "Data point").
+		Done().
+		Build()
+	broken := tools.NewTool("broken").
+		Description("Returns structured content not matching its schema").
+		Output().
+		WithString("title", "Chart title", true).
+		Done().
+		Build()
+	forecast := tools.NewTool("forecast").Description("Forecasts the weather").Build()
+
+	srv := NewServerBuilder("test", "1.0.0").
+		WithTool(plot, tools.ToolFunc[chart](func(map[string]any) (chart, error) {
+			return chart{title: "Sales", points: []int{3, 5, 8}}, nil
+		})).
+		WithTool(broken, tools.ToolFunc[tools.Content](func(map[string]any) (tools.Content, error) {
+			return tools.NewToolResultUnion().AddText("no title").WithStructured(map[string]any{"points": 1}), nil
+		})).
+		WithTool(forecast, tools.ToolFunc[*tools.ToolResultUnion](func(map[string]any) (*tools.ToolResultUnion, error) {
+			return tools.NewToolResultUnion().
+				AddText("Sunny").ForAudience(spec.RoleUser).Priority(0.9).Meta("source", "dwd").
+				WithStructured(map[string]any{"temp": 21}).
+				ResultMeta("traceId", "abc"), nil
+		}))
+
+	tests := []struct {
+		name    string
+		tool    string
+		version string
+		result  string
+	}{
+		{
+			"custom content",
+			"plot",
+			spec.ProtocolVersion20250618,
+			`{"_meta":{"renderer":"chart"},"content":[{"type":"text","text":"Sales: 3 points","annotations":{"audience":["assistant"]}},{"type":"image","data":"cG5n","mimeType":"image/png"}],"isError":false,"structuredContent":{"points":[3,5,8],"title":"Sales"}}`,
+		},
+		{
+			"custom content without structured content support",
+			"plot",
+			spec.ProtocolVersion20250326,
+			`{"_meta":{"renderer":"chart"},"content":[{"type":"text","text":"Sales: 3 points","annotations":{"audience":["assistant"]}},{"type":"image","data":"cG5n","mimeType":"image/png"}],"isError":false}`,
+		},
+		{
+			"annotations, meta and structured content",
+			"forecast",
+			spec.ProtocolVersion20250618,
+			`{"_meta":{"traceId":"abc"},"content":[{"type":"text","text":"Sunny","annotations":{"audience":["user"],"priority":0.9},"_meta":{"source":"dwd"}}],"isError":false,"structuredContent":{"temp":21}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := callTool(t, srv, tt.version, tt.tool)
+
+			if string(result) != tt.result {
+				t.Errorf("result =\n%s\nwant\n%s", result, tt.result)
+			}
+		})
+	}
+
+	t.Run("structured content not matching the output schema", func(t *testing.T) {
+		var result struct {
+			IsError bool `json:"isError"`
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		}
+		json.Unmarshal(callTool(t, srv, spec.ProtocolVersion20250618, "broken"), &result)
+
+		if !result.IsError || len(result.Content) != 1 {
+			t.Fatalf("result = %+v, want an error result", result)
+		}
+	})
+}
+
+// callTool calls the tool in a session of the protocol version and returns the raw result
+func callTool(t *testing.T, srv *server, version, tool string) json.RawMessage {
+	t.Helper()
+
+	var buf bytes.Buffer
+	srv.serveRequest(context.Background(), newBatchSession(version), &buf, &spec.Request[int]{
+		Jsonrpc: spec.JsonRPC,
+		ID:      1,
+		Method:  spec.MethodToolsCall,
+		Params:  map[string]any{"name": tool},
+	})
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *spec.Error     `json:"error"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &response); err != nil || response.Error != nil {
+		t.Fatalf("response = %s, want a result", buf.Bytes())
+	}
+	return response.Result
+}
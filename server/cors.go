@@ -0,0 +1,173 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makarski/mcp-robot/spec"
+)
+
+type (
+	// CORSPolicy controls cross-origin access to the HTTP transport and
+	// the validation of the Origin and Host headers protecting against DNS rebinding.
+	//
+	// Origins are matched exactly ("https://app.example.com"), a trailing ":*"
+	// matches any port ("http://localhost:*") and "*" matches any origin.
+	// Hosts without a port match any port, "*" matches any host.
+	// Requests without an Origin header, e.g. from non-browser clients, only have
+	// their Host validated
+	CORSPolicy struct {
+		AllowedOrigins   []string
+		AllowedHosts     []string
+		AllowCredentials bool
+		// AllowedHeaders are allowed in addition to the headers used by MCP
+		AllowedHeaders []string
+		// ExposedHeaders are exposed to browsers in addition to Mcp-Session-Id and WWW-Authenticate
+		ExposedHeaders []string
+		// MaxAge is how long preflight results may be cached, zero omits the header
+		MaxAge time.Duration
+	}
+)
+
+var (
+	corsAllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodOptions}
+	corsAllowedHeaders = []string{"Content-Type", "Accept", "Authorization", "Last-Event-ID", headerSessionID, headerProtocolVersion}
+	corsExposedHeaders = []string{headerSessionID, "WWW-Authenticate"}
+)
+
+// DefaultCORSPolicy is the policy of a new HTTPServer: only local origins
+// and hosts are accepted, which is the safe choice for servers running on the user's machine
+func DefaultCORSPolicy() CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins: []string{
+			"http://localhost:*",
+			"https://localhost:*",
+			"http://127.0.0.1:*",
+			"https://127.0.0.1:*",
+			"http://[::1]:*",
+			"https://[::1]:*",
+		},
+		AllowedHosts: []string{"localhost", "127.0.0.1", "::1"},
+	}
+}
+
+// WithCORS replaces the CORS and Origin validation policy
+//
+// Default value is DefaultCORSPolicy()
+func (s *HTTPServer) WithCORS(policy CORSPolicy) *HTTPServer {
+	s.cors = policy
+	return s
+}
+
+// checkOrigin validates the Host and Origin headers and sets the CORS response headers.
+// Requests from foreign origins or to unexpected hosts are rejected with 403
+func (s *HTTPServer) checkOrigin(w http.ResponseWriter, req *http.Request) bool {
+	if !s.cors.allowsHost(req.Host) {
+		writeHTTPError(w, http.StatusForbidden, newMessageError(nil, spec.ErrorCodeInvalidRequest, fmt.Sprintf("host not allowed: %s", req.Host)))
+		return false
+	}
+
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if !s.cors.allowsOrigin(origin) {
+		writeHTTPError(w, http.StatusForbidden, newMessageError(nil, spec.ErrorCodeInvalidRequest, fmt.Sprintf("origin not allowed: %s", origin)))
+		return false
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+
+	if slices.Contains(s.cors.AllowedOrigins, "*") && !s.cors.AllowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if s.cors.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	header.Set("Access-Control-Expose-Headers", strings.Join(append(slices.Clone(corsExposedHeaders), s.cors.ExposedHeaders...), ", "))
+	return true
+}
+
+// preflightHandler answers CORS preflight requests of allowed origins
+func (s *HTTPServer) preflightHandler(w http.ResponseWriter, req *http.Request) {
+	header := w.Header()
+	header.Set("Access-Control-Allow-Methods", strings.Join(corsAllowedMethods, ", "))
+	header.Set("Access-Control-Allow-Headers", strings.Join(append(slices.Clone(corsAllowedHeaders), s.cors.AllowedHeaders...), ", "))
+
+	if s.cors.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(s.cors.MaxAge.Seconds())))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p CORSPolicy) allowsOrigin(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+
+		if prefix, ok := strings.CutSuffix(allowed, ":*"); ok {
+			// the origin either has no port or a numeric one after the prefix
+			if strings.EqualFold(prefix, origin) {
+				return true
+			}
+
+			if len(origin) > len(prefix) && strings.EqualFold(origin[:len(prefix)], prefix) && origin[len(prefix)] == ':' {
+				if _, err := strconv.Atoi(origin[len(prefix)+1:]); err == nil {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (p CORSPolicy) allowsHost(hostport string) bool {
+	host, port := splitHostPort(hostport)
+
+	for _, allowed := range p.AllowedHosts {
+		if allowed == "*" {
+			return true
+		}
+
+		allowedHost, allowedPort := splitHostPort(allowed)
+		if strings.EqualFold(allowedHost, host) && (allowedPort == "" || allowedPort == port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitHostPort is like net.SplitHostPort, but also accepts
+// hosts without a port, including bare IPv6 addresses
+func splitHostPort(hostport string) (string, string) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = hostport, ""
+	}
+	return strings.Trim(host, "[]"), port
+}
+
+// localAddr binds addresses without a host to the loopback interface.
+// Listening on all interfaces has to be requested explicitly, e.g. with "0.0.0.0:8080"
+func localAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
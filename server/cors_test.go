@@ -0,0 +1,175 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	custom := &CORSPolicy{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedHosts:   []string{"mcp.example.com:443"},
+		ExposedHeaders: []string{"X-Trace"},
+	}
+
+	tests := []struct {
+		name        string
+		policy      *CORSPolicy
+		host        string
+		origin      string
+		status      int
+		allowOrigin string
+		credentials bool
+	}{
+		{"local origin", nil, "localhost:8080", "http://localhost:3000", http.StatusOK, "http://localhost:3000", false},
+		{"local origin without port", nil, "localhost:8080", "http://localhost", http.StatusOK, "http://localhost", false},
+		{"loopback origin", nil, "127.0.0.1:8080", "https://127.0.0.1:3000", http.StatusOK, "https://127.0.0.1:3000", false},
+		{"ipv6 loopback", nil, "[::1]:8080", "http://[::1]:3000", http.StatusOK, "http://[::1]:3000", false},
+		{"missing origin", nil, "localhost:8080", "", http.StatusOK, "", false},
+		{"foreign origin", nil, "localhost:8080", "https://evil.example", http.StatusForbidden, "", false},
+		{"origin with local prefix", nil, "localhost:8080", "http://localhost.evil.example", http.StatusForbidden, "", false},
+		{"origin with non-numeric port", nil, "localhost:8080", "http://localhost:8080.evil.example", http.StatusForbidden, "", false},
+		{"spoofed host", nil, "evil.example:8080", "", http.StatusForbidden, "", false},
+		{"spoofed host with local origin", nil, "evil.example", "http://localhost:3000", http.StatusForbidden, "", false},
+		{"host with local prefix", nil, "localhost.evil.example:8080", "", http.StatusForbidden, "", false},
+		{"allowed origin and host", custom, "mcp.example.com:443", "https://app.example.com", http.StatusOK, "https://app.example.com", false},
+		{"other origin", custom, "mcp.example.com:443", "https://other.example.com", http.StatusForbidden, "", false},
+		{"other port", custom, "mcp.example.com:8443", "https://app.example.com", http.StatusForbidden, "", false},
+		{"local host of remote policy", custom, "localhost:8080", "", http.StatusForbidden, "", false},
+		{"any origin", &CORSPolicy{AllowedOrigins: []string{"*"}, AllowedHosts: []string{"*"}}, "mcp.example.com", "https://app.example.com", http.StatusOK, "*", false},
+		{"any origin with credentials", &CORSPolicy{AllowedOrigins: []string{"*"}, AllowedHosts: []string{"*"}, AllowCredentials: true}, "mcp.example.com", "https://app.example.com", http.StatusOK, "https://app.example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServerBuilder("test", "1.0.0").BuildHTTPServer()
+			if tt.policy != nil {
+				srv.WithCORS(*tt.policy)
+			}
+
+			req := newTestRequest(http.MethodPost, DefaultEndpoint, initializeRequest)
+			req.Host = tt.host
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body = %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusForbidden && !strings.Contains(rec.Body.String(), `"code":-32600`) {
+				t.Errorf("body = %s, want an invalid request error", rec.Body)
+			}
+
+			header := rec.Header()
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("allow origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := header.Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("allow credentials = %v, want %v", got, tt.credentials)
+			}
+
+			if tt.allowOrigin != "" {
+				exposed := header.Get("Access-Control-Expose-Headers")
+				if !strings.Contains(exposed, headerSessionID) || !strings.Contains(exposed, "WWW-Authenticate") {
+					t.Errorf("exposed headers = %q, want %s and WWW-Authenticate", exposed, headerSessionID)
+				}
+				if tt.policy == custom && !strings.Contains(exposed, "X-Trace") {
+					t.Errorf("exposed headers = %q, want X-Trace", exposed)
+				}
+				if header.Get("Vary") != "Origin" {
+					t.Errorf("vary = %q, want Origin", header.Get("Vary"))
+				}
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	srv := NewServerBuilder("test", "1.0.0").BuildHTTPServer().
+		WithCORS(CORSPolicy{
+			AllowedOrigins: []string{"https://app.example.com"},
+			AllowedHosts:   []string{"mcp.example.com"},
+			AllowedHeaders: []string{"X-Client"},
+			MaxAge:         10 * time.Minute,
+		})
+
+	tests := []struct {
+		name   string
+		origin string
+		status int
+	}{
+		{"allowed origin", "https://app.example.com", http.StatusNoContent},
+		{"denied origin", "https://evil.example", http.StatusForbidden},
+		{"missing origin", "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestRequest(http.MethodOptions, DefaultEndpoint, "")
+			req.Host = "mcp.example.com"
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body = %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusNoContent {
+				if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "" {
+					t.Errorf("allow methods = %q for a denied origin", got)
+				}
+				return
+			}
+
+			header := rec.Header()
+			if got, want := header.Get("Access-Control-Allow-Methods"), "GET, POST, DELETE, OPTIONS"; got != want {
+				t.Errorf("allow methods = %q, want %q", got, want)
+			}
+			allowed := header.Get("Access-Control-Allow-Headers")
+			for _, h := range []string{headerSessionID, headerProtocolVersion, "Authorization", "Last-Event-ID", "X-Client"} {
+				if !strings.Contains(allowed, h) {
+					t.Errorf("allow headers = %q, want %s", allowed, h)
+				}
+			}
+			if got := header.Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("max age = %q, want 600", got)
+			}
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.origin {
+				t.Errorf("allow origin = %q, want %q", got, tt.origin)
+			}
+		})
+	}
+}
+
+func TestLocalAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{":8080", "127.0.0.1:8080"},
+		{":0", "127.0.0.1:0"},
+		{"0.0.0.0:8080", "0.0.0.0:8080"},
+		{"localhost:8080", "localhost:8080"},
+		{"[::1]:8080", "[::1]:8080"},
+		{"mcp.example.com:443", "mcp.example.com:443"},
+		{"invalid", "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := localAddr(tt.addr); got != tt.want {
+				t.Errorf("localAddr(%q) = %q, want %q", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
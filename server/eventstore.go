@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the MemoryEventStore limits
+const (
+	DefaultMaxEventsPerStream = 100
+	DefaultEventTTL           = 5 * time.Minute
+	DefaultStreamTTL          = 24 * time.Hour
+)
+
+// ErrEventNotFound is returned by an EventStore when the events following
+// the given id can't be replayed, e.g. because they have expired
+var ErrEventNotFound = errors.New("event not found")
+
+type (
+	// EventStore stores the events sent on the SSE streams of the Streamable HTTP transport,
+	// so that a client can resume a broken stream with the Last-Event-ID header
+	// and receive the events it missed
+	EventStore interface {
+		// StoreEvent appends the message to the stream and returns the id of the event
+		StoreEvent(ctx context.Context, streamID string, message []byte) (string, error)
+		// ReplayEventsAfter returns the stream of the event with the given id
+		// and the events stored on it after that event
+		ReplayEventsAfter(ctx context.Context, lastEventID string) (string, []Event, error)
+	}
+
+	// Event is a message stored on a stream
+	Event struct {
+		ID      string
+		Message []byte
+	}
+
+	// MemoryEventStoreConfig limits the memory used by a MemoryEventStore.
+	// Zero values fall back to DefaultMaxEventsPerStream, DefaultEventTTL and DefaultStreamTTL
+	MemoryEventStoreConfig struct {
+		// MaxEventsPerStream is the number of most recent events kept per stream
+		MaxEventsPerStream int
+		// TTL is how long events are kept
+		TTL time.Duration
+		// StreamTTL is how long a stream whose events have expired is remembered after its last event.
+		// Its sequence counter is kept, so that the response of a call running longer than TTL
+		// doesn't reuse the id of an event the client has already received
+		StreamTTL time.Duration
+	}
+
+	// MemoryEventStore is an EventStore keeping the events in memory.
+	// It is suitable for a single server instance,
+	// deployments with multiple instances need a shared store
+	MemoryEventStore struct {
+		config MemoryEventStoreConfig
+
+		mu        sync.Mutex
+		streams   map[string]*memoryStream
+		lastPrune time.Time
+		now       func() time.Time
+	}
+
+	memoryStream struct {
+		seq      uint64
+		events   []storedEvent
+		storedAt time.Time
+	}
+
+	storedEvent struct {
+		Event
+		seq      uint64
+		storedAt time.Time
+	}
+)
+
+// NewMemoryEventStore creates an in-memory EventStore with the given limits
+func NewMemoryEventStore(config MemoryEventStoreConfig) *MemoryEventStore {
+	if config.MaxEventsPerStream <= 0 {
+		config.MaxEventsPerStream = DefaultMaxEventsPerStream
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = DefaultEventTTL
+	}
+
+	if config.StreamTTL <= 0 {
+		config.StreamTTL = DefaultStreamTTL
+	}
+
+	return &MemoryEventStore{
+		config:  config,
+		streams: make(map[string]*memoryStream),
+		now:     time.Now,
+	}
+}
+
+// StoreEvent implements EventStore.
+// Event ids have the form "<streamID>/<sequence number>"
+func (m *MemoryEventStore) StoreEvent(_ context.Context, streamID string, message []byte) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.prune(now)
+
+	stream, ok := m.streams[streamID]
+	if !ok {
+		stream = &memoryStream{}
+		m.streams[streamID] = stream
+	}
+
+	stream.seq++
+	stream.storedAt = now
+	event := storedEvent{
+		Event: Event{
+			ID:      streamID + "/" + strconv.FormatUint(stream.seq, 10),
+			Message: message,
+		},
+		seq:      stream.seq,
+		storedAt: now,
+	}
+
+	stream.events = append(stream.events, event)
+	if overflow := len(stream.events) - m.config.MaxEventsPerStream; overflow > 0 {
+		stream.events = append(stream.events[:0:0], stream.events[overflow:]...)
+	}
+
+	return event.ID, nil
+}
+
+// ReplayEventsAfter implements EventStore.
+// ErrEventNotFound is returned if any of the events following lastEventID has been evicted
+func (m *MemoryEventStore) ReplayEventsAfter(_ context.Context, lastEventID string) (string, []Event, error) {
+	i := strings.LastIndexByte(lastEventID, '/')
+	if i < 0 {
+		return "", nil, ErrEventNotFound
+	}
+
+	streamID := lastEventID[:i]
+	seq, err := strconv.ParseUint(lastEventID[i+1:], 10, 64)
+	if err != nil {
+		return "", nil, ErrEventNotFound
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(m.now())
+
+	stream, ok := m.streams[streamID]
+	if !ok || seq > stream.seq {
+		return "", nil, ErrEventNotFound
+	}
+
+	var events []Event
+	for _, event := range stream.events {
+		if event.seq > seq {
+			events = append(events, event.Event)
+		}
+	}
+
+	// the event right after lastEventID must still be stored
+	if seq < stream.seq && (len(stream.events) == 0 || stream.events[0].seq > seq+1) {
+		return "", nil, ErrEventNotFound
+	}
+
+	return streamID, events, nil
+}
+
+// prune drops the expired events, at most once per second.
+// Streams without events are dropped after StreamTTL
+func (m *MemoryEventStore) prune(now time.Time) {
+	if now.Sub(m.lastPrune) < time.Second {
+		return
+	}
+	m.lastPrune = now
+
+	for id, stream := range m.streams {
+		expired := 0
+		for expired < len(stream.events) && now.Sub(stream.events[expired].storedAt) > m.config.TTL {
+			expired++
+		}
+
+		stream.events = stream.events[expired:]
+		if len(stream.events) == 0 && now.Sub(stream.storedAt) > m.config.StreamTTL {
+			delete(m.streams, id)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock is the clock of a MemoryEventStore under test
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestEventStore(config MemoryEventStoreConfig) (*MemoryEventStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryEventStore(config)
+	store.now = clock.Now
+	return store, clock
+}
+
+func TestMemoryEventStoreReplay(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestEventStore(MemoryEventStoreConfig{})
+
+	first, _ := store.StoreEvent(ctx, "s", []byte("one"))
+	second, _ := store.StoreEvent(ctx, "s", []byte("two"))
+	third, _ := store.StoreEvent(ctx, "s", []byte("three"))
+
+	streamID, events, err := store.ReplayEventsAfter(ctx, first)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if streamID != "s" {
+		t.Errorf("stream = %q, want %q", streamID, "s")
+	}
+	if len(events) != 2 || events[0].ID != second || events[1].ID != third {
+		t.Errorf("events = %v, want %s and %s", events, second, third)
+	}
+
+	_, events, err = store.ReplayEventsAfter(ctx, third)
+	if err != nil || len(events) != 0 {
+		t.Errorf("replay after last event = %v, %v, want no events", events, err)
+	}
+}
+
+func TestMemoryEventStoreReplayErrors(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestEventStore(MemoryEventStoreConfig{MaxEventsPerStream: 2})
+
+	first, _ := store.StoreEvent(ctx, "s", []byte("one"))
+	store.StoreEvent(ctx, "s", []byte("two"))
+	store.StoreEvent(ctx, "s", []byte("three"))
+	store.StoreEvent(ctx, "s", []byte("four"))
+
+	tests := []struct {
+		name        string
+		lastEventID string
+	}{
+		{"evicted", first},
+		{"unknown stream", "other/1"},
+		{"future event", "s/10"},
+		{"malformed id", "s"},
+		{"malformed sequence", "s/x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := store.ReplayEventsAfter(ctx, tt.lastEventID)
+			if !errors.Is(err, ErrEventNotFound) {
+				t.Errorf("err = %v, want ErrEventNotFound", err)
+			}
+		})
+	}
+}
+
+func TestMemoryEventStoreKeepsSequenceAfterExpiry(t *testing.T) {
+	ctx := context.Background()
+	store, clock := newTestEventStore(MemoryEventStoreConfig{TTL: 50 * time.Millisecond})
+
+	primingID, _ := store.StoreEvent(ctx, "s", nil)
+
+	// the call outlives the priming event
+	clock.Advance(1100 * time.Millisecond)
+
+	if _, events, err := store.ReplayEventsAfter(ctx, primingID); err != nil || len(events) != 0 {
+		t.Fatalf("replay while pending = %v, %v, want no events", events, err)
+	}
+
+	responseID, _ := store.StoreEvent(ctx, "s", []byte("response"))
+	if responseID == primingID {
+		t.Fatalf("response reused the priming id %s", primingID)
+	}
+
+	_, events, err := store.ReplayEventsAfter(ctx, primingID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].ID != responseID || string(events[0].Message) != "response" {
+		t.Errorf("events = %v, want the response %s", events, responseID)
+	}
+}
+
+func TestMemoryEventStoreDropsIdleStreams(t *testing.T) {
+	ctx := context.Background()
+	store, clock := newTestEventStore(MemoryEventStoreConfig{TTL: time.Second, StreamTTL: time.Minute})
+
+	id, _ := store.StoreEvent(ctx, "s", nil)
+
+	clock.Advance(2 * time.Minute)
+
+	if _, _, err := store.ReplayEventsAfter(ctx, id); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("err = %v, want ErrEventNotFound", err)
+	}
+	if len(store.streams) != 0 {
+		t.Errorf("streams = %d, want the idle stream dropped", len(store.streams))
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// Defaults of the health endpoints, see HealthConfig
+const (
+	DefaultHealthEndpoint    = "/healthz"
+	DefaultReadinessEndpoint = "/readyz"
+	DefaultInfoEndpoint      = "/info"
+	DefaultReadinessTimeout  = 5 * time.Second
+)
+
+// Statuses reported by the health endpoints
+const (
+	healthStatusOK       = "ok"
+	healthStatusNotReady = "not ready"
+)
+
+type (
+	// HealthConfig configures the health endpoints of the HTTP server.
+	// Empty paths fall back to the defaults
+	HealthConfig struct {
+		// HealthPath is the path of the liveness endpoint, answering 200
+		// as long as the process serves HTTP requests
+		HealthPath string
+		// ReadyPath is the path of the readiness endpoint, answering 503
+		// during a shutdown or if a readiness check fails
+		ReadyPath string
+		// InfoPath is the path of the endpoint describing the server
+		InfoPath string
+		// DisableInfo switches the info endpoint off, e.g. to not disclose the registered tools
+		DisableInfo bool
+		// ReadinessTimeout bounds the readiness checks of a probe
+		ReadinessTimeout time.Duration
+	}
+
+	// ReadinessCheck reports whether a dependency of the server, like a database,
+	// is available. The server is not ready while a check returns an error
+	ReadinessCheck func(ctx context.Context) error
+
+	namedCheck struct {
+		name  string
+		check ReadinessCheck
+	}
+
+	// healthStatus is the response of the liveness and readiness endpoints
+	healthStatus struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks,omitempty"`
+	}
+
+	// serverInfo is the response of the info endpoint
+	serverInfo struct {
+		spec.Info
+		ProtocolVersions []string `json:"protocolVersions"`
+		Tools            int      `json:"tools"`
+		// Resources and Prompts are reported for completeness,
+		// the server doesn't serve resources and prompts yet
+		Resources      int `json:"resources"`
+		Prompts        int `json:"prompts"`
+		ActiveSessions int `json:"activeSessions"`
+	}
+)
+
+// WithHealthEndpoints serves the liveness, readiness and info endpoints with Serve and ListenAndServeAddr.
+// Like the protected resource metadata, the endpoints are not subject to authorization
+func (s *HTTPServer) WithHealthEndpoints(config HealthConfig) *HTTPServer {
+	s.health = config.withDefaults()
+	s.healthEnabled = true
+	return s
+}
+
+// WithReadinessCheck adds a check run by every probe of the readiness endpoint.
+// The checks run concurrently, their results are reported under their names
+func (s *HTTPServer) WithReadinessCheck(name string, check ReadinessCheck) *HTTPServer {
+	s.readinessChecks = append(s.readinessChecks, namedCheck{name, check})
+	return s
+}
+
+// HealthHandler returns the handler of the liveness endpoint,
+// so that it can be mounted on any router
+func (s *HTTPServer) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeHealthStatus(w, http.StatusOK, healthStatus{Status: healthStatusOK})
+	})
+}
+
+// ReadinessHandler returns the handler of the readiness endpoint,
+// so that it can be mounted on any router
+func (s *HTTPServer) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-s.shutdownCh:
+			writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "shutting down"})
+			return
+		default:
+		}
+
+		timeout := s.health.withDefaults().ReadinessTimeout
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		status := healthStatus{Status: healthStatusOK}
+		code := http.StatusOK
+
+		if len(s.readinessChecks) > 0 {
+			status.Checks = s.runReadinessChecks(ctx)
+			for _, result := range status.Checks {
+				if result != healthStatusOK {
+					status.Status = healthStatusNotReady
+					code = http.StatusServiceUnavailable
+				}
+			}
+		}
+
+		writeHealthStatus(w, code, status)
+	})
+}
+
+// InfoHandler returns the handler of the info endpoint, describing the server
+// without speaking MCP, so that it can be mounted on any router
+func (s *HTTPServer) InfoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.mu.RLock()
+		info := serverInfo{
+			Info:             s.info,
+			ProtocolVersions: spec.SupportedProtocolVersions,
+			Tools:            len(s.tools),
+		}
+		s.mu.RUnlock()
+
+		info.ActiveSessions = len(s.liveSessions())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		json.NewEncoder(w).Encode(info)
+	})
+}
+
+// runReadinessChecks runs the checks concurrently and returns their results by name.
+// Checks still running when ctx is done are reported as timed out
+func (s *HTTPServer) runReadinessChecks(ctx context.Context) map[string]string {
+	type result struct {
+		name string
+		err  error
+	}
+
+	done := make(chan result, len(s.readinessChecks))
+	for _, c := range s.readinessChecks {
+		go func() {
+			done <- result{c.name, c.check(ctx)}
+		}()
+	}
+
+	results := make(map[string]string, len(s.readinessChecks))
+	for _, c := range s.readinessChecks {
+		results[c.name] = "timed out"
+	}
+
+	for range s.readinessChecks {
+		select {
+		case r := <-done:
+			results[r.name] = healthStatusOK
+			if r.err != nil {
+				results[r.name] = r.err.Error()
+			}
+		case <-ctx.Done():
+			return results
+		}
+	}
+
+	return results
+}
+
+func (c HealthConfig) withDefaults() HealthConfig {
+	if c.ReadinessTimeout <= 0 {
+		c.ReadinessTimeout = DefaultReadinessTimeout
+	}
+
+	c.HealthPath = withLeadingSlash(c.HealthPath, DefaultHealthEndpoint)
+	c.ReadyPath = withLeadingSlash(c.ReadyPath, DefaultReadinessEndpoint)
+	c.InfoPath = withLeadingSlash(c.InfoPath, DefaultInfoEndpoint)
+	return c
+}
+
+func writeHealthStatus(w http.ResponseWriter, code int, status healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
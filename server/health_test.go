@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/makarski/mcp-robot/spec"
+	"github.com/makarski/mcp-robot/tools"
+)
+
+// probe requests path from h and decodes the JSON response into v
+func probe(t *testing.T, h http.Handler, path string, v any) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newTestRequest(http.MethodGet, path, ""))
+
+	if v != nil && rec.Code != http.StatusNotFound {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("invalid response %q: %v", rec.Body, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestReadiness(t *testing.T) {
+	failing := func(context.Context) error { return errors.New("connection refused") }
+	passing := func(context.Context) error { return nil }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name   string
+		checks map[string]ReadinessCheck
+		status int
+		want   healthStatus
+	}{
+		{"no checks", nil, http.StatusOK, healthStatus{Status: "ok"}},
+		{"passing checks", map[string]ReadinessCheck{"db": passing, "cache": passing}, http.StatusOK,
+			healthStatus{Status: "ok", Checks: map[string]string{"db": "ok", "cache": "ok"}}},
+		{"failing check", map[string]ReadinessCheck{"db": failing, "cache": passing}, http.StatusServiceUnavailable,
+			healthStatus{Status: "not ready", Checks: map[string]string{"db": "connection refused", "cache": "ok"}}},
+		{"slow check", map[string]ReadinessCheck{"db": slow}, http.StatusServiceUnavailable,
+			healthStatus{Status: "not ready", Checks: map[string]string{"db": "timed out"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServerBuilder("test", "1.0.0").BuildHTTPServer().
+				WithHealthEndpoints(HealthConfig{ReadinessTimeout: 20 * time.Millisecond})
+			for name, check := range tt.checks {
+				srv.WithReadinessCheck(name, check)
+			}
+
+			var got healthStatus
+			status := probe(t, srv.Handler(), DefaultReadinessEndpoint, &got)
+
+			if status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+			if got.Status != tt.want.Status || !maps.Equal(got.Checks, tt.want.Checks) {
+				t.Errorf("response = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadinessWhileDraining(t *testing.T) {
+	started := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+
+	srv := newBlockingServer(started, unblock).BuildHTTPServer().WithHealthEndpoints(HealthConfig{})
+	url, _ := servingHTTPServer(t, context.Background(), srv)
+	h := srv.Handler()
+
+	var ready healthStatus
+	if status := probe(t, h, DefaultReadinessEndpoint, &ready); status != http.StatusOK {
+		t.Fatalf("readiness status = %d before the shutdown, want %d", status, http.StatusOK)
+	}
+
+	responses := startWaitCall(t, url)
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(context.Background()) }()
+
+	// the probe of the orchestrator takes the server out of rotation while it drains
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status := probe(t, h, DefaultReadinessEndpoint, &ready)
+		if status == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("readiness status = %d while draining, want %d", status, http.StatusServiceUnavailable)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if ready.Status != "shutting down" {
+		t.Errorf("readiness = %+v, want shutting down", ready)
+	}
+
+	var live healthStatus
+	if status := probe(t, h, DefaultHealthEndpoint, &live); status != http.StatusOK || live.Status != "ok" {
+		t.Errorf("liveness = %d %+v while draining, want %d ok", status, live, http.StatusOK)
+	}
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned %v while a request is in flight", err)
+	default:
+	}
+
+	close(unblock)
+	if resp := <-responses; resp != nil {
+		resp.Body.Close()
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("shutdown error = %v", err)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	weather := tools.NewTool("weather").Description("Reports the weather").Build()
+	builder := NewServerBuilder("weather-server", "2.1.0").
+		WithTool(weather, tools.ToolFunc[tools.ToolResultText](func(map[string]any) (tools.ToolResultText, error) {
+			return tools.NewToolResultText("sunny"), nil
+		}))
+
+	srv := builder.BuildHTTPServer().WithHealthEndpoints(HealthConfig{})
+	h := srv.Handler()
+	initializeSession(t, h, spec.ProtocolVersion20250618)
+
+	var info serverInfo
+	if status := probe(t, h, DefaultInfoEndpoint, &info); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+
+	if info.Name != "weather-server" || info.Version != "2.1.0" {
+		t.Errorf("info = %+v, want the server name and version", info.Info)
+	}
+	if info.Tools != 1 || info.ActiveSessions != 1 {
+		t.Errorf("tools = %d, sessions = %d, want 1 and 1", info.Tools, info.ActiveSessions)
+	}
+	if len(info.ProtocolVersions) != len(spec.SupportedProtocolVersions) {
+		t.Errorf("protocol versions = %q, want %q", info.ProtocolVersions, spec.SupportedProtocolVersions)
+	}
+
+	disabled := builder.BuildHTTPServer().WithHealthEndpoints(HealthConfig{DisableInfo: true}).Handler()
+	if status := probe(t, disabled, DefaultInfoEndpoint, nil); status != http.StatusNotFound {
+		t.Errorf("status = %d with the info endpoint disabled, want %d", status, http.StatusNotFound)
+	}
+}
@@ -1,60 +1,748 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	stdio "io"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/makarski/mcp-robot/auth"
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/session"
 	"github.com/makarski/mcp-robot/spec"
 )
 
-type HTTPServer struct {
-	*server
+const (
+	headerSessionID       = "Mcp-Session-Id"
+	headerProtocolVersion = "Mcp-Protocol-Version"
+
+	// sseKeepAlive is the interval of the comment lines keeping idle SSE streams open
+	sseKeepAlive = 15 * time.Second
+)
+
+type (
+	HTTPServer struct {
+		*server
+
+		endpoint    string
+		timeouts    HTTPTimeouts
+		tlsConfig   *tls.Config
+		maxBodySize int64
+
+		cors             CORSPolicy
+		verifier         auth.TokenVerifier
+		resourceMetadata *auth.ProtectedResourceMetadata
+
+		sseEndpoint       string
+		messageEndpoint   string
+		websocketEndpoint string
+		websocketConfig   WebSocketConfig
+		metricsEndpoint   string
+
+		health          HealthConfig
+		healthEnabled   bool
+		readinessChecks []namedCheck
+
+		sessionsMu     sync.RWMutex
+		sessions       map[string]*session.Session
+		legacyStreams  map[string]*legacyStream
+		eventStore     EventStore
+		requestStreams map[string]*streamSignal
+		janitorOnce    sync.Once
+
+		serversMu  sync.Mutex
+		servers    map[*http.Server]struct{}
+		active     drainGroup
+		shutdownCh chan struct{}
+		closeOnce  sync.Once
+	}
+
+	// HTTPTimeouts configures the underlying http.Server.
+	// Zero values mean no timeout, see http.Server for the semantics of each field.
+	// WriteTimeout also applies to SSE streams and should be left at zero
+	// unless streams are not used
+	HTTPTimeouts struct {
+		ReadHeaderTimeout time.Duration
+		ReadTimeout       time.Duration
+		WriteTimeout      time.Duration
+		IdleTimeout       time.Duration
+	}
+
+	// drainGroup counts the requests in progress and lets
+	// a shutdown wait for them after new ones are refused
+	drainGroup struct {
+		mu      sync.Mutex
+		n       int
+		closed  bool
+		drained chan struct{}
+	}
+)
+
+// DefaultEndpoint is the path the MCP endpoint is served at by Serve and ListenAndServeAddr
+const DefaultEndpoint = "/mcp"
+
+// DefaultMaxBodySize is the largest request body accepted from a client
+const DefaultMaxBodySize = 4 << 20
+
+// DefaultReadHeaderTimeout protects the server from clients that never finish sending headers
+const DefaultReadHeaderTimeout = 10 * time.Second
+
+// WithEndpoint sets the path of the MCP endpoint used by Serve and ListenAndServeAddr.
+// It has no effect when the server is mounted as an http.Handler.
+// An empty path disables the Streamable HTTP transport, e.g. to serve the legacy transport only
+//
+// Default value is DefaultEndpoint
+func (s *HTTPServer) WithEndpoint(path string) *HTTPServer {
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	s.endpoint = path
+	return s
 }
 
-func (s *HTTPServer) ListenAndServe(pattern string) func(addr string, mux *http.ServeMux) error {
-	fmt.Println("entered listen and serve")
+// WithTimeouts sets the timeouts of the underlying http.Server
+func (s *HTTPServer) WithTimeouts(timeouts HTTPTimeouts) *HTTPServer {
+	s.timeouts = timeouts
+	return s
+}
+
+// WithMaxBodySize sets the largest request body accepted from a client,
+// larger messages are answered with 413 Request Entity Too Large
+//
+// Default value is DefaultMaxBodySize
+func (s *HTTPServer) WithMaxBodySize(n int64) *HTTPServer {
+	s.maxBodySize = n
+	return s
+}
+
+// WithTLSConfig sets the TLS configuration used by ListenAndServeTLS
+func (s *HTTPServer) WithTLSConfig(config *tls.Config) *HTTPServer {
+	s.tlsConfig = config
+	return s
+}
+
+// ServeHTTP serves the MCP endpoint, so that the server can be mounted on any router:
+//
+//	mux.Handle("/mcp", srv)
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.serveGuarded(w, req, func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodPost:
+			s.entrypoint(w, req)
+		case http.MethodGet:
+			s.streamHandler(w, req)
+		case http.MethodDelete:
+			s.deleteSessionHandler(w, req)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE, OPTIONS")
+			writeHTTPError(w, http.StatusMethodNotAllowed, newMessageError(nil, spec.ErrorCodeInvalidRequest, fmt.Sprintf("method not allowed: %s", req.Method)))
+		}
+	})
+}
+
+// serveGuarded runs the checks shared by all transport endpoints:
+// requests are refused during a shutdown, the origin is validated,
+// preflight requests are answered and the caller is authorized
+func (s *HTTPServer) serveGuarded(w http.ResponseWriter, req *http.Request, serve http.HandlerFunc) {
+	s.janitorOnce.Do(func() { go s.expireSessions() })
+
+	if !s.active.acquire() {
+		w.Header().Set("Connection", "close")
+		writeHTTPError(w, http.StatusServiceUnavailable, newMessageError(nil, spec.ErrorCodeInternalError, "server is shutting down"))
+		return
+	}
+	defer s.active.release()
+
+	if !s.checkOrigin(w, req) {
+		return
+	}
+
+	if req.Method == http.MethodOptions {
+		s.preflightHandler(w, req)
+		return
+	}
+
+	req, ok := s.authorize(w, req)
+	if !ok {
+		return
+	}
+
+	serve(w, req)
+}
+
+// Handler returns the handler serving the MCP endpoint at the configured path
+func (s *HTTPServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if s.endpoint != "" {
+		mux.Handle(s.endpoint, s)
+	}
+
+	if s.sseEndpoint != "" {
+		mux.Handle(s.sseEndpoint, s.LegacySSEHandler())
+		mux.Handle(s.messageEndpoint, s.LegacyMessageHandler())
+	}
+
+	if s.websocketEndpoint != "" {
+		mux.Handle(s.websocketEndpoint, s.WebSocketHandler())
+	}
+
+	if s.healthEnabled {
+		mux.Handle(s.health.HealthPath, s.HealthHandler())
+		mux.Handle(s.health.ReadyPath, s.ReadinessHandler())
+		if !s.health.DisableInfo {
+			mux.Handle(s.health.InfoPath, s.InfoHandler())
+		}
+	}
+
+	if s.metricsEndpoint != "" {
+		mux.Handle(s.metricsEndpoint, s.MetricsHandler())
+	}
+
+	if s.resourceMetadata != nil {
+		mux.Handle(auth.WellKnownPath, s.ProtectedResourceMetadataHandler())
+		mux.Handle(auth.WellKnownPath+"/", s.ProtectedResourceMetadataHandler())
+	}
+
+	return mux
+}
+
+// Serve accepts connections on the listener until ctx is done or Shutdown is called.
+// Cancelling ctx shuts the server down gracefully, in-flight requests are not cancelled by it,
+// and Serve returns once the shutdown is complete.
+// Like http.Server.Serve, it always returns a non-nil error, http.ErrServerClosed after a shutdown
+func (s *HTTPServer) Serve(ctx context.Context, l net.Listener) error {
+	srv := s.newHTTPServer(ctx, s.Handler())
+	defer s.removeHTTPServer(srv)
 
+	wait := s.shutdownOnDone(ctx)
+	defer wait()
+
+	return srv.Serve(l)
+}
+
+// ListenAndServeAddr listens on the TCP network address addr and serves the MCP endpoint.
+// Addresses without a host, like ":8080", are bound to the loopback interface
+func (s *HTTPServer) ListenAndServeAddr(addr string) error {
+	l, err := net.Listen("tcp", localAddr(addr))
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(context.Background(), l)
+}
+
+// ListenAndServe returns a function serving the MCP endpoint at "/"+pattern on addr.
+// The endpoint is registered on mux, or on http.DefaultServeMux if mux is nil.
+// Addresses without a host, like ":8080", are bound to the loopback interface
+//
+// Deprecated: use ListenAndServeAddr or Serve, which serve all the configured endpoints
+// and can be shut down, or mount the server on a router as an http.Handler
+func (s *HTTPServer) ListenAndServe(pattern string) func(addr string, mux *http.ServeMux) error {
 	return func(addr string, mux *http.ServeMux) error {
 		if mux == nil {
-			fmt.Println("mux is nil, creating a new ServeMux")
-			http.HandleFunc("POST /"+pattern, s.entrypoint)
-			http.HandleFunc("OPTIONS /"+pattern, optionsHandler)
-			return http.ListenAndServe(addr, nil)
-		} else {
-			fmt.Println("mux is not nil, using provided ServeMux")
-			mux.HandleFunc("POST /"+pattern, s.entrypoint)
-			mux.HandleFunc("OPTIONS /"+pattern, optionsHandler)
-			return http.ListenAndServe(addr, mux)
+			mux = http.DefaultServeMux
+		}
+		mux.Handle("/"+pattern, s)
+
+		l, err := net.Listen("tcp", localAddr(addr))
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		srv := s.newHTTPServer(ctx, mux)
+		defer s.removeHTTPServer(srv)
+
+		wait := s.shutdownOnDone(ctx)
+		defer wait()
+
+		return srv.Serve(l)
+	}
+}
+
+// ListenAndServeTLS is like ListenAndServeAddr, but serves HTTPS
+// with the given certificate and key files
+func (s *HTTPServer) ListenAndServeTLS(addr, certFile, keyFile string) error {
+	l, err := net.Listen("tcp", localAddr(addr))
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	srv := s.newHTTPServer(ctx, s.Handler())
+	defer s.removeHTTPServer(srv)
+
+	wait := s.shutdownOnDone(ctx)
+	defer wait()
+
+	return srv.ServeTLS(l, certFile, keyFile)
+}
+
+// Shutdown gracefully stops the server: new requests are refused, SSE streams are closed
+// and in-flight requests are awaited. If ctx expires first, the remaining requests are cancelled.
+// Finally all sessions are ended
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.shutdownCh) })
+
+	drained := s.active.close()
+
+	s.serversMu.Lock()
+	servers := make([]*http.Server, 0, len(s.servers))
+	for srv := range s.servers {
+		servers = append(servers, srv)
+	}
+	s.serversMu.Unlock()
+
+	var shutdownErr error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			shutdownErr = err
+		}
+	}
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		shutdownErr = ctx.Err()
+	}
+
+	s.sessionsMu.Lock()
+	sessions := s.sessions
+	s.sessions = make(map[string]*session.Session)
+	s.sessionsMu.Unlock()
+
+	for _, sess := range sessions {
+		s.endSession(sess)
+	}
+
+	if shutdownErr != nil {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}
+
+	return shutdownErr
+}
+
+// newHTTPServer creates an http.Server serving h, which is shut down by Shutdown
+// until it is removed with removeHTTPServer
+func (s *HTTPServer) newHTTPServer(ctx context.Context, h http.Handler) *http.Server {
+	readHeaderTimeout := s.timeouts.ReadHeaderTimeout
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = DefaultReadHeaderTimeout
+	}
+
+	srv := &http.Server{
+		Handler:           h,
+		TLSConfig:         s.tlsConfig,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       s.timeouts.ReadTimeout,
+		WriteTimeout:      s.timeouts.WriteTimeout,
+		IdleTimeout:       s.timeouts.IdleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			// keep the values of ctx, but not its cancellation:
+			// a shutdown drains in-flight requests instead of cancelling them
+			return context.WithoutCancel(ctx)
+		},
+	}
+
+	s.serversMu.Lock()
+	s.servers[srv] = struct{}{}
+	s.serversMu.Unlock()
+
+	return srv
+}
+
+// removeHTTPServer forgets the server once it stopped serving
+func (s *HTTPServer) removeHTTPServer(srv *http.Server) {
+	s.serversMu.Lock()
+	delete(s.servers, srv)
+	s.serversMu.Unlock()
+}
+
+// shutdownOnDone shuts the server down once ctx is done.
+// The returned function stops watching ctx and waits
+// for a shutdown triggered by ctx to complete
+func (s *HTTPServer) shutdownOnDone(ctx context.Context) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		select {
+		case <-ctx.Done():
+			s.Shutdown(context.Background())
+		case <-stop:
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// readBody reads the request body up to the configured size limit.
+// If the body can't be read, the request is answered and ok is false
+func (s *HTTPServer) readBody(w http.ResponseWriter, req *http.Request) (body []byte, ok bool) {
+	limit := s.maxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+
+	body, err := stdio.ReadAll(http.MaxBytesReader(w, req.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeHTTPError(w, http.StatusRequestEntityTooLarge, newMessageError(nil, spec.ErrorCodeInvalidRequest, fmt.Sprintf("request body exceeds %d bytes", limit)))
+			return nil, false
 		}
+
+		writeHTTPError(w, http.StatusBadRequest, newMessageError(nil, spec.ErrorCodeParseError, "failed to read request body"))
+		return nil, false
 	}
+
+	return body, true
 }
 
 func (s *HTTPServer) entrypoint(w http.ResponseWriter, req *http.Request) {
-	fmt.Println("entered entrypoint")
+	body, ok := s.readBody(w, req)
+	if !ok {
+		return
+	}
+
+	if isBatch(body) {
+		s.serveHTTPBatch(w, req, body)
+		return
+	}
+
+	msg, msgErr := decodeMessage(body)
+	if msgErr != nil {
+		writeHTTPError(w, http.StatusBadRequest, msgErr)
+		return
+	}
 
-	var rpcReq spec.Request[int]
-	if err := json.NewDecoder(req.Body).Decode(&rpcReq); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	rpcReq := msg.req
+	if msg.kind != kindRequest {
+		s.serveHTTPNotification(w, req, msg.kind, &rpcReq)
 		return
 	}
 
-	handler, err := s.resolveHandler(rpcReq)
+	sess, status, err := s.lookupSession(req, rpcReq.Method)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to resolve handler: %s", err), http.StatusNotFound)
+		writeHTTPError(w, status, newMessageError(rawRequestID(&rpcReq), spec.ErrorCodeInvalidRequest, err.Error()))
+		return
+	}
+
+	isInitialize := rpcReq.Method == spec.MethodInitialize
+	if s.eventStore != nil && !isInitialize && acceptsEventStream(req) {
+		s.serveRequestStream(w, req, sess, &rpcReq)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set(headerSessionID, sess.ID())
+
+	s.serveRequest(req.Context(), sess, httpResultWriter{w}, &rpcReq)
 
-	handler.ServeRPC(w, &rpcReq)
+	if isInitialize {
+		if sess.Initialized() {
+			s.startSession(sess)
+		} else {
+			// the handshake failed, the session can't be used
+			s.removeSession(sess.ID())
+		}
+	}
 }
 
-func optionsHandler(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept")
-	w.WriteHeader(http.StatusOK)
+// serveHTTPNotification accepts a notification or a response of the client.
+// Neither is answered with a JSON-RPC message, only with 202 Accepted
+func (s *HTTPServer) serveHTTPNotification(w http.ResponseWriter, req *http.Request, kind messageKind, rpcReq *spec.Request[int]) {
+	sess, status, err := s.lookupSession(req, "")
+	if err != nil {
+		writeHTTPError(w, status, newMessageError(nil, spec.ErrorCodeInvalidRequest, err.Error()))
+		return
+	}
+
+	if kind == kindNotification {
+		s.serveNotification(req.Context(), sess, rpcReq)
+	}
+
+	w.Header().Set(headerSessionID, sess.ID())
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *HTTPServer) serveHTTPBatch(w http.ResponseWriter, req *http.Request, body []byte) {
+	sess, status, err := s.lookupSession(req, "")
+	if err != nil {
+		writeHTTPError(w, status, newMessageError(nil, spec.ErrorCodeInvalidRequest, err.Error()))
+		return
+	}
+
+	w.Header().Set(headerSessionID, sess.ID())
+
+	response := s.serveBatch(req.Context(), sess, body)
+	if response == nil {
+		// the batch consisted of notifications only
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(response)
+}
+
+// streamHandler opens an SSE stream delivering the notifications
+// the server sends to the client outside of a request
+func (s *HTTPServer) streamHandler(w http.ResponseWriter, req *http.Request) {
+	sess, status, err := s.lookupSession(req, "")
+	if err != nil {
+		writeHTTPError(w, status, newMessageError(nil, spec.ErrorCodeInvalidRequest, err.Error()))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeHTTPError(w, http.StatusInternalServerError, newMessageError(nil, spec.ErrorCodeInternalError, "streaming is not supported"))
+		return
+	}
+
+	defer s.trackStream(metricsStreamNotifications)()
+
+	var streamID string
+	if s.eventStore != nil && req.Header.Get(headerLastEventID) != "" {
+		var done bool
+		if streamID, done = s.resumeStream(w, req, sess); done {
+			return
+		}
+	}
+
+	if streamID == "" {
+		streamID = newStreamID(sess, streamKindNotifications)
+		setSSEHeaders(w, sess)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-sess.Done():
+			return
+		case <-s.shutdownCh:
+			return
+		case notification := <-sess.Notifications():
+			data, err := json.Marshal(notification)
+			if err != nil {
+				continue
+			}
+
+			id := s.storeEvent(req.Context(), streamID, data)
+			if err := writeSSEEvent(w, id, "message", data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+		sess.Touch()
+	}
+}
+
+// deleteSessionHandler lets the client explicitly terminate its session
+func (s *HTTPServer) deleteSessionHandler(w http.ResponseWriter, req *http.Request) {
+	sess, status, err := s.lookupSession(req, "")
+	if err != nil {
+		writeHTTPError(w, status, newMessageError(nil, spec.ErrorCodeInvalidRequest, err.Error()))
+		return
+	}
+
+	s.removeSession(sess.ID())
+	s.endSession(sess)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupSession returns the session the request belongs to.
+// An initialize request always starts a new session, any other request
+// has to reference an existing one with the Mcp-Session-Id header
+func (s *HTTPServer) lookupSession(req *http.Request, method string) (*session.Session, int, error) {
+	if method == spec.MethodInitialize {
+		sess := session.New(session.NewID())
+		sess.SetPrincipal(principal(req))
+
+		s.sessionsMu.Lock()
+		s.sessions[sess.ID()] = sess
+		s.sessionsMu.Unlock()
+
+		return sess, http.StatusOK, nil
+	}
+
+	sessionID := req.Header.Get(headerSessionID)
+	if sessionID == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("missing %s header", headerSessionID)
+	}
+
+	s.sessionsMu.RLock()
+	sess, ok := s.sessions[sessionID]
+	_, legacy := s.legacyStreams[sessionID]
+	s.sessionsMu.RUnlock()
+	if !ok || legacy || sess.Principal() != principal(req) {
+		// a session is only usable by the principal that initialized it,
+		// and only on the transport that started it
+		return nil, http.StatusNotFound, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	if version := req.Header.Get(headerProtocolVersion); version != "" && !spec.IsSupportedProtocolVersion(version) {
+		return nil, http.StatusBadRequest, fmt.Errorf("unsupported %s: %s", headerProtocolVersion, version)
+	}
+
+	// once negotiated, the client has to stick to the version of the session
+	if version := req.Header.Get(headerProtocolVersion); version != "" && sess.Initialized() && version != sess.ProtocolVersion() {
+		return nil, http.StatusBadRequest, fmt.Errorf("%s %s differs from the negotiated version %s", headerProtocolVersion, version, sess.ProtocolVersion())
+	}
+
+	return sess, http.StatusOK, nil
+}
+
+func (s *HTTPServer) removeSession(id string) {
+	s.sessionsMu.Lock()
+	delete(s.sessions, id)
+	s.sessionsMu.Unlock()
+}
+
+// expireSessions periodically ends the sessions that have been idle
+// for longer than the configured timeout
+func (s *HTTPServer) expireSessions() {
+	timeout := s.idleTimeout()
+	if timeout <= 0 {
+		return
+	}
+
+	interval := min(timeout/2, time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+
+		var expired []*session.Session
+
+		s.sessionsMu.Lock()
+		for id, sess := range s.sessions {
+			if time.Since(sess.IdleSince()) > timeout && sess.InFlight() == 0 {
+				delete(s.sessions, id)
+				expired = append(expired, sess)
+			}
+		}
+		s.sessionsMu.Unlock()
+
+		for _, sess := range expired {
+			s.endSession(sess)
+		}
+	}
+}
+
+func (g *drainGroup) acquire() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return false
+	}
+	g.n++
+	return true
+}
+
+func (g *drainGroup) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.n--
+	if g.closed && g.n == 0 {
+		close(g.drained)
+	}
+}
+
+// close refuses further acquisitions and returns a channel
+// that is closed once all acquired slots have been released
+func (g *drainGroup) close() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.closed {
+		g.closed = true
+		g.drained = make(chan struct{})
+		if g.n == 0 {
+			close(g.drained)
+		}
+	}
+	return g.drained
+}
+
+// httpResultWriter streams results straight into the body of a JSON response.
+// Responses delivered over SSE are collected, they are stored as events
+type httpResultWriter struct {
+	w http.ResponseWriter
+}
+
+func (hw httpResultWriter) Write(b []byte) (int, error) {
+	return hw.w.Write(b)
+}
+
+func (hw httpResultWriter) WriteResultStream(write func(w stdio.Writer) error) error {
+	cw := io.NewChunkWriter(func(chunk []byte) error {
+		_, err := hw.w.Write(chunk)
+		return err
+	})
+
+	err := write(cw)
+	if err == nil {
+		err = cw.Flush()
+	}
+	return cw.StreamError(err)
+}
+
+// writeHTTPError answers with a JSON-RPC error envelope and the given HTTP status
+func writeHTTPError(w http.ResponseWriter, status int, err *messageError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err.writeTo(w)
+}
+
+// writeSSEEvent writes an event, the id and the event type are omitted when empty
+func writeSSEEvent(w http.ResponseWriter, id, event string, data []byte) error {
+	var buf bytes.Buffer
+	if id != "" {
+		fmt.Fprintf(&buf, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", event)
+	}
+	fmt.Fprintf(&buf, "data: %s\n\n", data)
+
+	_, err := w.Write(buf.Bytes())
+	return err
 }
@@ -0,0 +1,401 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+	"github.com/makarski/mcp-robot/tools"
+)
+
+// initializeSession runs the initialize handshake with the version and returns the session id
+func initializeSession(t *testing.T, h http.Handler, version string) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newTestRequest(http.MethodPost, "/mcp",
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"`+version+`","capabilities":{},"clientInfo":{"name":"test","version":"1.0.0"}}}`))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("initialize status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	id := rec.Header().Get(headerSessionID)
+	if id == "" {
+		t.Fatal("initialize returned no session id")
+	}
+	return id
+}
+
+func TestProtocolVersionHeader(t *testing.T) {
+	h := NewServerBuilder("test", "1.0.0").BuildHTTPServer().Handler()
+	sessionID := initializeSession(t, h, spec.ProtocolVersion20250326)
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"negotiated", spec.ProtocolVersion20250326, http.StatusOK},
+		{"missing", "", http.StatusOK},
+		{"other supported version", spec.ProtocolVersion20250618, http.StatusBadRequest},
+		{"unsupported", "1999-01-01", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestRequest(http.MethodPost, "/mcp", `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+			req.Header.Set(headerSessionID, sessionID)
+			if tt.header != "" {
+				req.Header.Set(headerProtocolVersion, tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d, body = %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestLegacySessionIsRejectedOnStreamableHTTP(t *testing.T) {
+	srv := NewServerBuilder("test", "1.0.0").BuildHTTPServer().WithLegacySSE("", "")
+
+	mux := http.NewServeMux()
+	mux.Handle(DefaultEndpoint, srv)
+	mux.Handle(DefaultSSEEndpoint, srv.LegacySSEHandler())
+	mux.Handle(DefaultMessageEndpoint, srv.LegacyMessageHandler())
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+DefaultSSEEndpoint, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open the legacy stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var endpoint string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			endpoint = data
+			break
+		}
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Query().Get(queryParamSessionID) == "" {
+		t.Fatalf("endpoint event = %q, want the message endpoint with a session id", endpoint)
+	}
+	sessionID := u.Query().Get(queryParamSessionID)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+	}{
+		{"post", http.MethodPost, `{"jsonrpc":"2.0","id":2,"method":"ping"}`},
+		{"get", http.MethodGet, ""},
+		{"delete", http.MethodDelete, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestRequest(tt.method, DefaultEndpoint, tt.body)
+			req.Header.Set(headerSessionID, sessionID)
+
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d, body = %s", rec.Code, http.StatusNotFound, rec.Body)
+			}
+		})
+	}
+
+	// the session is still usable on its own transport
+	post, err := http.Post(ts.URL+endpoint, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":3,"method":"ping"}`))
+	if err != nil {
+		t.Fatalf("failed to post to the legacy endpoint: %v", err)
+	}
+	post.Body.Close()
+
+	if post.StatusCode != http.StatusAccepted {
+		t.Errorf("legacy status = %d, want %d", post.StatusCode, http.StatusAccepted)
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int64
+		body   string
+		status int
+	}{
+		{"default limit", 0, initializeRequest, http.StatusOK},
+		{"within limit", int64(len(initializeRequest)), initializeRequest, http.StatusOK},
+		{"over limit", int64(len(initializeRequest)) - 1, initializeRequest, http.StatusRequestEntityTooLarge},
+		{"large batch", 64, "[" + strings.Repeat(`{"jsonrpc":"2.0","id":1,"method":"ping"},`, 10) + "]", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewServerBuilder("test", "1.0.0").BuildHTTPServer().WithMaxBodySize(tt.limit).Handler()
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, newTestRequest(http.MethodPost, DefaultEndpoint, tt.body))
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d, body = %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusRequestEntityTooLarge && !strings.Contains(rec.Body.String(), `"code":-32600`) {
+				t.Errorf("body = %s, want an invalid request error", rec.Body)
+			}
+		})
+	}
+}
+
+// servingHTTPServer serves srv on a loopback listener until the test ends
+// and returns the URL of the MCP endpoint and the result of Serve
+func servingHTTPServer(t *testing.T, ctx context.Context, srv *HTTPServer) (string, <-chan error) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, l) }()
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	return "http://" + l.Addr().String() + DefaultEndpoint, served
+}
+
+// postMessage posts the message to the MCP endpoint at url
+func postMessage(url, sessionID, body string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if sessionID != "" {
+		req.Header.Set(headerSessionID, sessionID)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// newBlockingServer returns a server with a tool "wait" that signals started
+// and returns once unblock is closed or its context is done
+func newBlockingServer(started chan<- struct{}, unblock <-chan struct{}) *server {
+	wait := tools.NewTool("wait").Description("Waits").Build()
+	return NewServerBuilder("test", "1.0.0").
+		WithTool(wait, tools.ToolContextFunc[tools.ToolResultText](func(ctx context.Context, _ map[string]any) (tools.ToolResultText, error) {
+			started <- struct{}{}
+			select {
+			case <-unblock:
+				return tools.NewToolResultText("done"), nil
+			case <-ctx.Done():
+				return tools.ToolResultText{}, ctx.Err()
+			}
+		}))
+}
+
+// startWaitCall initializes a session and calls the tool "wait" in the background
+func startWaitCall(t *testing.T, url string) <-chan *http.Response {
+	t.Helper()
+
+	resp, err := postMessage(url, "", initializeRequest)
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	resp.Body.Close()
+	sessionID := resp.Header.Get(headerSessionID)
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := postMessage(url, sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"wait"}}`)
+		if err != nil {
+			resp = nil
+		}
+		responses <- resp
+	}()
+
+	return responses
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+
+	builder := newBlockingServer(started, unblock)
+	ended := make(chan struct{})
+	builder.OnSessionEnd(func(*session.Session) { close(ended) })
+
+	srv := builder.BuildHTTPServer()
+	url, served := servingHTTPServer(t, context.Background(), srv)
+
+	responses := startWaitCall(t, url)
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned %v while a request is in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if resp, err := postMessage(url, "", initializeRequest); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("status = %d during the shutdown, want the request refused", resp.StatusCode)
+		}
+	}
+
+	close(unblock)
+
+	resp := <-responses
+	if resp == nil {
+		t.Fatal("in-flight request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("in-flight status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if body, _ := bufio.NewReader(resp.Body).ReadString('\n'); !strings.Contains(body, "done") {
+		t.Errorf("in-flight response = %s, want the tool result", body)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Errorf("shutdown error = %v", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("serve error = %v, want %v", err, http.ErrServerClosed)
+	}
+
+	select {
+	case <-ended:
+	default:
+		t.Error("session not ended by the shutdown")
+	}
+
+	srv.serversMu.Lock()
+	defer srv.serversMu.Unlock()
+	if len(srv.servers) != 0 {
+		t.Errorf("servers = %d, want none after Serve returned", len(srv.servers))
+	}
+}
+
+func TestShutdownCancelsRequestsAfterDeadline(t *testing.T) {
+	started := make(chan struct{}, 1)
+	srv := newBlockingServer(started, nil).BuildHTTPServer()
+	url, served := servingHTTPServer(t, context.Background(), srv)
+
+	responses := startWaitCall(t, url)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("shutdown error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case resp := <-responses:
+		if resp != nil {
+			resp.Body.Close()
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("in-flight request not cancelled")
+	}
+
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("serve error = %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+func TestServeShutsDownWhenContextIsDone(t *testing.T) {
+	srv := NewServerBuilder("test", "1.0.0").BuildHTTPServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	url, served := servingHTTPServer(t, ctx, srv)
+
+	resp, err := postMessage(url, "", initializeRequest)
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	resp.Body.Close()
+
+	cancel()
+
+	select {
+	case err := <-served:
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("serve error = %v, want %v", err, http.ErrServerClosed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve didn't return")
+	}
+
+	srv.serversMu.Lock()
+	defer srv.serversMu.Unlock()
+	if len(srv.servers) != 0 {
+		t.Errorf("servers = %d, want none after Serve returned", len(srv.servers))
+	}
+}
+
+func TestDeprecatedListenAndServe(t *testing.T) {
+	srv := NewServerBuilder("test", "1.0.0").BuildHTTPServer()
+	mux := http.NewServeMux()
+
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe("legacy")("127.0.0.1:0", mux) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		srv.serversMu.Lock()
+		n := len(srv.servers)
+		srv.serversMu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the endpoint is registered on the given mux
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, newTestRequest(http.MethodPost, "/legacy", initializeRequest))
+	if rec.Code != http.StatusOK || rec.Header().Get(headerSessionID) == "" {
+		t.Fatalf("initialize status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error = %v", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("serve error = %v, want %v", err, http.ErrServerClosed)
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/makarski/mcp-robot/ratelimit"
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// Scopes of the rate limits, reported in the error data of rejected calls
+const (
+	limitScopeGlobal  = "global"
+	limitScopeSession = "session"
+	limitScopeTool    = "tool"
+)
+
+type (
+	// RateLimitStats are the counters of the rate limits of tool calls
+	RateLimitStats struct {
+		Global ratelimit.Stats
+		// Sessions sums the counters of the per session limits
+		Sessions ratelimit.Stats
+		Tools    map[string]ratelimit.Stats
+	}
+
+	// sessionLimiters holds a limiter per caller, created on first use
+	sessionLimiters struct {
+		mu       sync.Mutex
+		limit    ratelimit.Limit
+		limiters map[string]*ratelimit.Limiter
+		// principals maps the sessions that used the limiter of their principal to its key
+		principals map[string]string
+		// retired keeps the counters of the limiters of ended sessions
+		retired ratelimit.Stats
+	}
+)
+
+// WithRateLimit limits the tool calls of all clients together
+func (s *server) WithRateLimit(limit ratelimit.Limit) *server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.globalLimiter = newLimiter(limit)
+	return s
+}
+
+// WithSessionRateLimit limits the tool calls of every caller.
+// Authenticated callers share the limit across their sessions,
+// anonymous callers get a limit per session
+func (s *server) WithSessionRateLimit(limit ratelimit.Limit) *server {
+	s.sessionLimits.mu.Lock()
+	defer s.sessionLimits.mu.Unlock()
+
+	s.sessionLimits.limit = limit
+	s.sessionLimits.limiters = make(map[string]*ratelimit.Limiter)
+	s.sessionLimits.principals = make(map[string]string)
+	return s
+}
+
+// RateLimitStats returns the counters of the configured rate limits
+func (s *server) RateLimitStats() RateLimitStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := RateLimitStats{
+		Sessions: s.sessionLimits.stats(),
+		Tools:    make(map[string]ratelimit.Stats),
+	}
+
+	if s.globalLimiter != nil {
+		stats.Global = s.globalLimiter.Stats()
+	}
+
+	for name, tool := range s.tools {
+		if tool.limiter != nil {
+			stats.Tools[name] = tool.limiter.Stats()
+		}
+	}
+
+	return stats
+}
+
+// acquireToolCall admits a tool call through the tool, session and global limits.
+// The narrowest limit is checked first, so that a caller over its own limit
+// doesn't use up the capacity shared with other callers
+func (s *server) acquireToolCall(ctx context.Context, tool serverTool) ([]*ratelimit.Permit, error) {
+	s.mu.RLock()
+	global := s.globalLimiter
+	logger := s.logger
+	s.mu.RUnlock()
+
+	var sessionLimiter *ratelimit.Limiter
+	sess, ok := session.FromContext(ctx)
+	if ok {
+		sessionLimiter = s.sessionLimits.get(sess)
+	}
+
+	limits := []struct {
+		scope   string
+		limiter *ratelimit.Limiter
+	}{
+		{limitScopeTool, tool.limiter},
+		{limitScopeSession, sessionLimiter},
+		{limitScopeGlobal, global},
+	}
+
+	var permits []*ratelimit.Permit
+	for _, limit := range limits {
+		if limit.limiter == nil {
+			continue
+		}
+
+		permit, err := limit.limiter.Acquire(ctx)
+		if err == nil {
+			permits = append(permits, permit)
+			continue
+		}
+
+		for _, permit := range permits {
+			permit.Cancel()
+		}
+
+		var limitErr *ratelimit.LimitError
+		if !errors.As(err, &limitErr) {
+			return nil, spec.NewProtocolError(spec.ErrorCodeInternalError, fmt.Sprintf("tool call not admitted: %s", err))
+		}
+
+		attrs := []any{
+			"tool", tool.toolDefinition.Name,
+			"scope", limit.scope,
+			"reason", limitErr.Reason,
+		}
+		if sess != nil {
+			attrs = append(attrs, "session", sess.ID())
+		}
+		logger.WarnContext(ctx, "tool call rate limited", attrs...)
+
+		return nil, spec.NewProtocolErrorWithData(
+			spec.ErrorCodeRateLimited,
+			fmt.Sprintf("call of tool '%s' rejected by the %s limit: %s", tool.toolDefinition.Name, limit.scope, limitErr),
+			map[string]any{
+				"tool":         tool.toolDefinition.Name,
+				"scope":        limit.scope,
+				"reason":       limitErr.Reason,
+				"retryAfterMs": limitErr.RetryAfter.Milliseconds(),
+			},
+		)
+	}
+
+	return permits, nil
+}
+
+func releasePermits(permits []*ratelimit.Permit) {
+	for _, permit := range permits {
+		permit.Release()
+	}
+}
+
+// get returns the limiter of the caller of the session, nil if no limit is configured
+func (sl *sessionLimiters) get(sess *session.Session) *ratelimit.Limiter {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.limiters == nil || sl.limit.IsZero() {
+		return nil
+	}
+
+	key := sessionLimiterKey(sess.ID())
+	if principal := sess.Principal(); principal != "" {
+		key = "principal:" + principal
+		sl.principals[sess.ID()] = key
+	}
+
+	limiter, ok := sl.limiters[key]
+	if !ok {
+		limiter = ratelimit.NewLimiter(sl.limit)
+		sl.limiters[key] = limiter
+	}
+
+	return limiter
+}
+
+// end drops the limiter of the ended session. The limiters of principals without sessions
+// are dropped once they are idle, so that a caller can't reset its limit by reconnecting.
+// Limiters still busy are dropped when a later session ends
+func (sl *sessionLimiters) end(sess *session.Session) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.retire(sessionLimiterKey(sess.ID()))
+	delete(sl.principals, sess.ID())
+
+	active := make(map[string]bool, len(sl.principals))
+	for _, key := range sl.principals {
+		active[key] = true
+	}
+
+	for key, limiter := range sl.limiters {
+		if strings.HasPrefix(key, "principal:") && !active[key] && limiter.Idle() {
+			sl.retire(key)
+		}
+	}
+}
+
+// retire removes the limiter and keeps its counters, the caller holds mu
+func (sl *sessionLimiters) retire(key string) {
+	if limiter, ok := sl.limiters[key]; ok {
+		stats := limiter.Stats()
+		stats.InFlight = 0
+		sl.retired = sl.retired.Add(stats)
+		delete(sl.limiters, key)
+	}
+}
+
+func (sl *sessionLimiters) stats() ratelimit.Stats {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	stats := sl.retired
+	for _, limiter := range sl.limiters {
+		stats = stats.Add(limiter.Stats())
+	}
+	return stats
+}
+
+func sessionLimiterKey(sessionID string) string {
+	return "session:" + sessionID
+}
+
+// newLimiter creates a limiter, nil for a zero limit
+func newLimiter(limit ratelimit.Limit) *ratelimit.Limiter {
+	if limit.IsZero() {
+		return nil
+	}
+	return ratelimit.NewLimiter(limit)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/makarski/mcp-robot/ratelimit"
+	"github.com/makarski/mcp-robot/session"
+)
+
+func newPrincipalSession(id, principal string) *session.Session {
+	sess := session.New(id)
+	sess.SetPrincipal(principal)
+	return sess
+}
+
+func TestSessionLimitersEvictPrincipals(t *testing.T) {
+	srv := NewServerBuilder("test", "1.0.0").WithSessionRateLimit(ratelimit.Limit{MaxConcurrent: 1})
+	limits := &srv.sessionLimits
+
+	first := newPrincipalSession("s1", "alice")
+	second := newPrincipalSession("s2", "alice")
+	anonymous := session.New("s3")
+
+	shared := limits.get(first)
+	if limits.get(second) != shared {
+		t.Fatal("want the sessions of a principal to share a limiter")
+	}
+	limits.get(anonymous)
+
+	limits.end(first)
+	if _, ok := limits.limiters["principal:alice"]; !ok {
+		t.Fatal("want the limiter kept while the principal has sessions")
+	}
+
+	// a call in flight keeps the limiter busy
+	permit, err := shared.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limits.end(second)
+	if _, ok := limits.limiters["principal:alice"]; !ok {
+		t.Fatal("want a busy limiter kept, so that reconnecting doesn't reset the limit")
+	}
+
+	permit.Release()
+	limits.end(anonymous)
+
+	if len(limits.limiters) != 0 || len(limits.principals) != 0 {
+		t.Errorf("limiters = %v, principals = %v, want all dropped", limits.limiters, limits.principals)
+	}
+	if stats := limits.stats(); stats.Allowed != 1 {
+		t.Errorf("allowed = %d, want the counters of dropped limiters kept", stats.Allowed)
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	stdio "io"
+	"strconv"
+
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+type messageKind int
+
+const (
+	kindRequest messageKind = iota
+	kindNotification
+	kindResponse
+)
+
+type (
+	// message is a validated JSON-RPC message received from the client
+	message struct {
+		kind messageKind
+		req  spec.Request[int]
+	}
+
+	// messageError is the failure to decode a message.
+	// id is the message id as sent, nil if it could not be read
+	messageError struct {
+		*spec.ProtocolError
+		id json.RawMessage
+	}
+
+	// responseIDWriter writes the responses of a request with the id sent by the client
+	// in place of the id the response writers encoded
+	responseIDWriter struct {
+		w  io.RPCResponseWriter
+		id json.RawMessage
+		// chunks is set for the chunks of a streamed response, only the first one carries the id
+		chunks  bool
+		started bool
+	}
+
+	// responseOutcome is the part of a written response recorded by metrics and audit records
+	responseOutcome struct {
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Result *struct {
+			IsError bool `json:"isError"`
+		} `json:"result"`
+	}
+
+	envelope struct {
+		Jsonrpc json.RawMessage `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Method  json.RawMessage `json:"method"`
+		Params  json.RawMessage `json:"params"`
+		Result  json.RawMessage `json:"result"`
+		Error   json.RawMessage `json:"error"`
+	}
+)
+
+// decodeOutcome decodes the outcome of a response,
+// a response that can't be decoded is considered successful
+func decodeOutcome(b []byte) responseOutcome {
+	var outcome responseOutcome
+	json.Unmarshal(b, &outcome)
+	return outcome
+}
+
+// isBatch reports whether the raw message is a JSON-RPC batch
+func isBatch(raw []byte) bool {
+	trimmed := bytes.TrimLeft(raw, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// decodeMessage decodes and validates a single JSON-RPC message.
+// Requests, notifications and responses are told apart:
+// a notification has no id, a response has an id but no method
+func decodeMessage(raw []byte) (message, *messageError) {
+	if !json.Valid(raw) {
+		return message{}, newMessageError(nil, spec.ErrorCodeParseError, "invalid JSON")
+	}
+
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return message{}, newMessageError(nil, spec.ErrorCodeInvalidRequest, "message must be a JSON object")
+	}
+
+	var (
+		id    int
+		rawID json.RawMessage
+	)
+
+	if env.ID != nil {
+		if isNull(env.ID) {
+			return message{}, newMessageError(nil, spec.ErrorCodeInvalidRequest, "'id' must be a string or an integer")
+		}
+		if err := json.Unmarshal(env.ID, &id); err != nil {
+			var s string
+			if err := json.Unmarshal(env.ID, &s); err != nil {
+				return message{}, newMessageError(nil, spec.ErrorCodeInvalidRequest, "'id' must be a string or an integer")
+			}
+			rawID = env.ID
+		}
+	}
+
+	var version string
+	if err := json.Unmarshal(env.Jsonrpc, &version); err != nil || version != spec.JsonRPC {
+		return message{}, newMessageError(env.ID, spec.ErrorCodeInvalidRequest, fmt.Sprintf("'jsonrpc' must be \"%s\"", spec.JsonRPC))
+	}
+
+	if env.Method == nil {
+		if env.ID != nil && (env.Result != nil || env.Error != nil) {
+			return message{kind: kindResponse, req: spec.Request[int]{Jsonrpc: version, ID: id, RawID: rawID}}, nil
+		}
+		return message{}, newMessageError(env.ID, spec.ErrorCodeInvalidRequest, "missing 'method'")
+	}
+
+	var method string
+	if err := json.Unmarshal(env.Method, &method); err != nil || isNull(env.Method) {
+		return message{}, newMessageError(env.ID, spec.ErrorCodeInvalidRequest, "'method' must be a string")
+	}
+
+	var params map[string]any
+	if env.Params != nil && !isNull(env.Params) {
+		if err := decodeParamsJSON(env.Params, &params); err != nil {
+			return message{}, newMessageError(env.ID, spec.ErrorCodeInvalidRequest, "'params' must be an object")
+		}
+	}
+
+	kind := kindRequest
+	if env.ID == nil {
+		kind = kindNotification
+	}
+
+	return message{
+		kind: kind,
+		req: spec.Request[int]{
+			Jsonrpc: version,
+			ID:      id,
+			Method:  method,
+			Params:  params,
+			RawID:   rawID,
+		},
+	}, nil
+}
+
+// decodeParamsJSON decodes request parameters keeping numbers as json.Number,
+// so that large integers don't lose precision and integers can be told from decimals
+func decodeParamsJSON(raw []byte, params *map[string]any) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(params)
+}
+
+func newMessageError(id json.RawMessage, code int, message string) *messageError {
+	return &messageError{
+		ProtocolError: spec.NewProtocolError(code, message),
+		id:            id,
+	}
+}
+
+// writeTo answers the undecodable message with an error response
+func (e *messageError) writeTo(w io.RPCResponseWriter) error {
+	rw := io.NewNullIDResponseWriter(w)
+	if e.id != nil {
+		rw = io.NewResponseWriter(&responseIDWriter{w: w, id: e.id}, 0)
+	}
+
+	return rw.WriteProtocolError(e.ProtocolError)
+}
+
+// rawRequestID returns the id of the request as sent by the client
+func rawRequestID(req *spec.Request[int]) json.RawMessage {
+	if req.RawID != nil {
+		return req.RawID
+	}
+	return json.RawMessage(strconv.Itoa(req.ID))
+}
+
+// withResponseID returns w answering req with the id sent by the client,
+// w itself if the request has an integer id
+func withResponseID(w io.RPCResponseWriter, req *spec.Request[int]) io.RPCResponseWriter {
+	if req.RawID == nil {
+		return w
+	}
+	return &responseIDWriter{w: w, id: req.RawID}
+}
+
+func (rw *responseIDWriter) Write(b []byte) (int, error) {
+	if rw.chunks && rw.started {
+		return rw.w.Write(b)
+	}
+	rw.started = true
+
+	if _, err := rw.w.Write(rw.replaceID(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// WriteResultStream replaces the id in the first chunk, the prefix of the response
+func (rw *responseIDWriter) WriteResultStream(write func(w stdio.Writer) error) error {
+	return io.WriteResultStream(rw.w, func(w stdio.Writer) error {
+		return write(&responseIDWriter{w: w, id: rw.id, chunks: true})
+	})
+}
+
+// replaceID replaces the zero id at the start of a response encoded by an io.ResponseWriter
+func (rw *responseIDWriter) replaceID(b []byte) []byte {
+	rest, ok := bytes.CutPrefix(b, zeroIDPrefix)
+	if !ok || (len(rest) > 0 && rest[0] != ',' && rest[0] != '}') {
+		return b
+	}
+
+	replaced := make([]byte, 0, len(b)-1+len(rw.id))
+	replaced = append(replaced, idPrefix...)
+	replaced = append(replaced, rw.id...)
+	return append(replaced, rest...)
+}
+
+var (
+	idPrefix     = []byte(`{"jsonrpc":"` + spec.JsonRPC + `","id":`)
+	zeroIDPrefix = append(idPrefix[:len(idPrefix):len(idPrefix)], '0')
+)
+
+func isNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/makarski/mcp-robot/spec"
+	"github.com/makarski/mcp-robot/tools"
+)
+
+func TestDecodeMessageKeepsNumberPrecision(t *testing.T) {
+	tests := []struct {
+		name    string
+		literal string
+	}{
+		{"2^53-1", "9007199254740991"},
+		{"2^53", "9007199254740992"},
+		{"2^53+1", "9007199254740993"},
+		{"-(2^53+1)", "-9007199254740993"},
+		{"beyond int64", "123456789012345678901234567890"},
+		{"fraction beyond float64 precision", "9007199254740993.5"},
+		{"large exponent", "1e400"},
+		{"exponent of 2^53+1", "9.007199254740993e15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"lookup","arguments":{"id":` + tt.literal + `,"nested":[` + tt.literal + `]}}}`)
+
+			msg, msgErr := decodeMessage(raw)
+			if msgErr != nil {
+				t.Fatalf("unexpected error: %v", msgErr)
+			}
+
+			args := msg.req.Params["arguments"].(map[string]any)
+			if n, ok := args["id"].(json.Number); !ok || n.String() != tt.literal {
+				t.Errorf("id = %#v, want json.Number %s", args["id"], tt.literal)
+			}
+			if n, ok := args["nested"].([]any)[0].(json.Number); !ok || n.String() != tt.literal {
+				t.Errorf("nested = %#v, want json.Number %s", args["nested"], tt.literal)
+			}
+		})
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		kind messageKind
+		code int
+	}{
+		{"request", `{"jsonrpc":"2.0","id":1,"method":"ping"}`, kindRequest, 0},
+		{"notification", `{"jsonrpc":"2.0","method":"notifications/initialized"}`, kindNotification, 0},
+		{"response", `{"jsonrpc":"2.0","id":1,"result":{}}`, kindResponse, 0},
+		{"invalid JSON", `{"jsonrpc":`, 0, spec.ErrorCodeParseError},
+		{"not an object", `[1]`, 0, spec.ErrorCodeInvalidRequest},
+		{"wrong version", `{"jsonrpc":"1.0","id":1,"method":"ping"}`, 0, spec.ErrorCodeInvalidRequest},
+		{"string id", `{"jsonrpc":"2.0","id":"a","method":"ping"}`, kindRequest, 0},
+		{"string id response", `{"jsonrpc":"2.0","id":"a","result":{}}`, kindResponse, 0},
+		{"object id", `{"jsonrpc":"2.0","id":{},"method":"ping"}`, 0, spec.ErrorCodeInvalidRequest},
+		{"fractional id", `{"jsonrpc":"2.0","id":1.5,"method":"ping"}`, 0, spec.ErrorCodeInvalidRequest},
+		{"null id", `{"jsonrpc":"2.0","id":null,"method":"ping"}`, 0, spec.ErrorCodeInvalidRequest},
+		{"missing method", `{"jsonrpc":"2.0","id":1}`, 0, spec.ErrorCodeInvalidRequest},
+		{"numeric method", `{"jsonrpc":"2.0","id":1,"method":1}`, 0, spec.ErrorCodeInvalidRequest},
+		{"array params", `{"jsonrpc":"2.0","id":1,"method":"ping","params":[]}`, 0, spec.ErrorCodeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, msgErr := decodeMessage([]byte(tt.raw))
+			if tt.code != 0 {
+				if msgErr == nil || msgErr.Code != tt.code {
+					t.Fatalf("error = %v, want code %d", msgErr, tt.code)
+				}
+				return
+			}
+
+			if msgErr != nil {
+				t.Fatalf("unexpected error: %v", msgErr)
+			}
+			if msg.kind != tt.kind {
+				t.Errorf("kind = %d, want %d", msg.kind, tt.kind)
+			}
+		})
+	}
+}
+
+func TestStringRequestIDsRoundTrip(t *testing.T) {
+	weather := tools.NewTool("weather").Description("Reports the weather").Build()
+	chart := tools.NewTool("chart").Description("Draws a chart").Build()
+	builder := NewServerBuilder("test", "1.0.0").
+		WithTool(weather, tools.ToolFunc[tools.ToolResultText](func(map[string]any) (tools.ToolResultText, error) {
+			return tools.NewToolResultText("sunny"), nil
+		})).
+		WithTool(chart, tools.ToolFunc[tools.ToolResultMedia](func(map[string]any) (tools.ToolResultMedia, error) {
+			return tools.NewToolResultImageReader(strings.NewReader("png"), 3, "image/png"), nil
+		}))
+
+	tests := []struct {
+		name    string
+		request string
+		id      string
+		errCode int
+	}{
+		{"ping", `{"jsonrpc":"2.0","id":"a","method":"ping"}`, `"a"`, 0},
+		{"uuid", `{"jsonrpc":"2.0","id":"550e8400-e29b-41d4-a716-446655440000","method":"tools/call","params":{"name":"weather"}}`, `"550e8400-e29b-41d4-a716-446655440000"`, 0},
+		{"streamed result", `{"jsonrpc":"2.0","id":"chart-1","method":"tools/call","params":{"name":"chart"}}`, `"chart-1"`, 0},
+		{"numeric string", `{"jsonrpc":"2.0","id":"0","method":"ping"}`, `"0"`, 0},
+		{"escaped", `{"jsonrpc":"2.0","id":"\u0041\"","method":"ping"}`, `"\u0041\""`, 0},
+		{"error", `{"jsonrpc":"2.0","id":"b","method":"x/unknown"}`, `"b"`, spec.ErrorCodeMethodNotFound},
+		{"invalid message", `{"jsonrpc":"1.0","id":"c","method":"ping"}`, `"c"`, spec.ErrorCodeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := strings.Join([]string{
+				initializeRequest,
+				`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+				tt.request,
+			}, "\n") + "\n"
+
+			var out strings.Builder
+			if err := builder.BuildStdioServer().serve(strings.NewReader(input), &out); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("output = %s, want the initialize response and one response", out.String())
+			}
+
+			var response struct {
+				ID     json.RawMessage `json:"id"`
+				Result map[string]any  `json:"result"`
+				Error  *spec.Error     `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(lines[1]), &response); err != nil {
+				t.Fatalf("invalid response %q: %v", lines[1], err)
+			}
+
+			if string(response.ID) != tt.id {
+				t.Errorf("id = %s, want %s", response.ID, tt.id)
+			}
+			if tt.errCode != 0 {
+				if response.Error == nil || response.Error.Code != tt.errCode {
+					t.Errorf("error = %v, want code %d", response.Error, tt.errCode)
+				}
+			} else if response.Result == nil {
+				t.Errorf("response = %s, want a result", lines[1])
+			}
+		})
+	}
+}
+
+func TestCancelStringRequestID(t *testing.T) {
+	started := make(chan struct{})
+	slow := tools.NewTool("slow").Description("Waits for cancellation").Build()
+	srv := NewServerBuilder("test", "1.0.0").
+		WithTool(slow, tools.ToolContextFunc[tools.ToolResultText](func(ctx context.Context, _ map[string]any) (tools.ToolResultText, error) {
+			close(started)
+			<-ctx.Done()
+			return tools.NewToolResultText("cancelled"), nil
+		}))
+	sess := newBatchSession(spec.ProtocolVersion20250618)
+
+	msg, msgErr := decodeMessage([]byte(`{"jsonrpc":"2.0","id":"1","method":"tools/call","params":{"name":"slow"}}`))
+	if msgErr != nil {
+		t.Fatalf("unexpected error: %v", msgErr)
+	}
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.serveRequest(context.Background(), sess, &buf, &msg.req)
+	}()
+	<-started
+
+	// the integer 1 is another request than the string "1"
+	for _, requestID := range []any{json.Number("1"), "1"} {
+		srv.serveNotification(context.Background(), sess, &spec.Request[int]{
+			Jsonrpc: spec.JsonRPC,
+			Method:  spec.MethodNotificationsCancelled,
+			Params:  map[string]any{"requestId": requestID},
+		})
+
+		if _, ok := requestID.(json.Number); ok {
+			select {
+			case <-done:
+				t.Fatal("request cancelled by an integer id")
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("request not cancelled")
+	}
+	if buf.Len() > 0 {
+		t.Errorf("response = %s, want none for a cancelled request", buf.Bytes())
+	}
+}
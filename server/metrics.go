@@ -0,0 +1,216 @@
+package server
+
+import (
+	stdio "io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/makarski/mcp-robot/handler"
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/metrics"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// DefaultMetricsEndpoint is the path the metrics are served at by Serve and ListenAndServeAddr
+const DefaultMetricsEndpoint = "/metrics"
+
+// Values of the code label of mcp_requests_total besides JSON-RPC error codes
+const (
+	metricsCodeOK        = "ok"
+	metricsCodeToolError = "tool_error"
+	metricsCodeCancelled = "cancelled"
+)
+
+// metricsMethodOther is the method label of requests for methods the server doesn't serve
+const metricsMethodOther = "other"
+
+// metricsMethods are the methods recorded as is in the method label.
+// Methods are sent by the client, any other shares metricsMethodOther to bound the cardinality
+var metricsMethods = map[string]bool{
+	spec.MethodInitialize: true,
+	spec.MethodPing:       true,
+	spec.MethodToolsList:  true,
+	spec.MethodToolsCall:  true,
+}
+
+// Values of the kind label of mcp_sse_streams
+const (
+	metricsStreamNotifications = "notifications"
+	metricsStreamRequest       = "request"
+	metricsStreamLegacy        = "legacy"
+)
+
+type (
+	// serverMetrics are the metrics the server records in a registry
+	serverMetrics struct {
+		registry *metrics.Registry
+		requests *metrics.Counter
+		duration *metrics.Histogram
+		panics   *metrics.Counter
+		streams  *metrics.Gauge
+	}
+
+	// metricsWriter keeps the outcome of the response written by the handler
+	metricsWriter struct {
+		w       io.RPCResponseWriter
+		code    string
+		written bool
+	}
+)
+
+// WithMetrics records the metrics of the server in registry: requests by method, tool and
+// outcome, request latencies, tool panics, active sessions, SSE streams and queued notifications.
+// Requests are measured by a middleware added like with Use, so that stdio servers
+// record the same metrics as HTTP servers
+func (s *server) WithMetrics(registry *metrics.Registry) *server {
+	m := &serverMetrics{
+		registry: registry,
+		requests: registry.Counter("mcp_requests_total", "Number of JSON-RPC requests served", "method", "tool", "code"),
+		duration: registry.Histogram("mcp_request_duration_seconds", "Duration of JSON-RPC requests", nil, "method", "tool"),
+		panics:   registry.Counter("mcp_tool_panics_total", "Number of panics recovered from request handlers", "tool"),
+		streams:  registry.Gauge("mcp_sse_streams", "Number of open SSE streams", "kind"),
+	}
+
+	registry.GaugeFunc("mcp_active_sessions", "Number of active sessions", func() float64 {
+		return float64(len(s.liveSessions()))
+	})
+
+	registry.GaugeFunc("mcp_notification_queue_depth", "Number of notifications queued for delivery", func() float64 {
+		var depth int
+		for _, sess := range s.liveSessions() {
+			depth += sess.PendingNotifications()
+		}
+		return float64(depth)
+	})
+
+	s.mu.Lock()
+	s.metrics = m
+	s.middlewares = append(s.middlewares, s.metricsMiddleware(m))
+	s.mu.Unlock()
+
+	return s
+}
+
+// WithMetricsEndpoint serves the metrics at path with Serve and ListenAndServeAddr.
+// Like the protected resource metadata, the endpoint is not subject to authorization.
+// A registry is created if none has been set with WithMetrics.
+// An empty path falls back to DefaultMetricsEndpoint
+func (s *HTTPServer) WithMetricsEndpoint(path string) *HTTPServer {
+	s.metricsEndpoint = withLeadingSlash(path, DefaultMetricsEndpoint)
+
+	s.mu.RLock()
+	configured := s.metrics != nil
+	s.mu.RUnlock()
+
+	if !configured {
+		s.WithMetrics(metrics.NewRegistry())
+	}
+
+	return s
+}
+
+// MetricsHandler returns the handler serving the metrics in the Prometheus text format,
+// so that it can be mounted on any router. It answers 404 if metrics are not enabled
+func (s *HTTPServer) MetricsHandler() http.Handler {
+	s.mu.RLock()
+	m := s.metrics
+	s.mu.RUnlock()
+
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return m.registry.Handler()
+}
+
+// metricsMiddleware measures every request. Panics are counted and passed on to the server
+func (s *server) metricsMiddleware(m *serverMetrics) handler.Middleware {
+	return func(next handler.MCPHandler) handler.MCPHandler {
+		return handler.MCPHandlerFunc(func(w io.RPCResponseWriter, req *spec.Request[int]) {
+			method := req.Method
+			if !metricsMethods[method] {
+				method = metricsMethodOther
+			}
+			tool := s.metricsToolLabel(req)
+			start := time.Now()
+
+			mw := &metricsWriter{w: w, code: metricsCodeCancelled}
+			defer func() {
+				v := recover()
+				if v != nil {
+					m.panics.Inc(tool)
+					mw.code = strconv.Itoa(spec.ErrorCodeInternalError)
+				}
+
+				m.requests.Inc(method, tool, mw.code)
+				m.duration.Observe(time.Since(start).Seconds(), method, tool)
+
+				if v != nil {
+					panic(v)
+				}
+			}()
+
+			next.ServeRPC(mw, req)
+		})
+	}
+}
+
+// metricsToolLabel returns the name of the called tool, empty for other
+// requests and for tools that are not registered
+func (s *server) metricsToolLabel(req *spec.Request[int]) string {
+	if req.Method != spec.MethodToolsCall {
+		return ""
+	}
+
+	name, _ := req.Params["name"].(string)
+	if !s.HasTool(name) {
+		return ""
+	}
+	return name
+}
+
+// trackStream counts an open SSE stream of the kind,
+// the returned function has to be called once it is closed
+func (s *server) trackStream(kind string) func() {
+	s.mu.RLock()
+	m := s.metrics
+	s.mu.RUnlock()
+
+	if m == nil {
+		return func() {}
+	}
+
+	m.streams.Inc(kind)
+	return func() { m.streams.Dec(kind) }
+}
+
+func (mw *metricsWriter) Write(b []byte) (int, error) {
+	if !mw.written {
+		mw.written = true
+		mw.code = responseCode(b)
+	}
+	return mw.w.Write(b)
+}
+
+// WriteResultStream records the streamed response as successful, only results are streamed
+func (mw *metricsWriter) WriteResultStream(write func(w stdio.Writer) error) error {
+	if !mw.written {
+		mw.written = true
+		mw.code = metricsCodeOK
+	}
+	return io.WriteResultStream(mw.w, write)
+}
+
+// responseCode returns the error code of a response, or whether the result is a tool error
+func responseCode(b []byte) string {
+	outcome := decodeOutcome(b)
+
+	switch {
+	case outcome.Error != nil:
+		return strconv.Itoa(outcome.Error.Code)
+	case outcome.Result != nil && outcome.Result.IsError:
+		return metricsCodeToolError
+	default:
+		return metricsCodeOK
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/makarski/mcp-robot/handler"
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/metrics"
+	"github.com/makarski/mcp-robot/spec"
+	"github.com/makarski/mcp-robot/tools"
+)
+
+func TestMetricsLabelsAreBounded(t *testing.T) {
+	weather := tools.NewTool("weather").Description("Reports the weather").Build()
+	builder := NewServerBuilder("test", "1.0.0").
+		WithTool(weather, tools.ToolFunc[tools.ToolResultText](func(map[string]any) (tools.ToolResultText, error) {
+			return tools.NewToolResultText("sunny"), nil
+		})).
+		WithMetrics(metrics.NewRegistry()).
+		// rejects some methods with another code than method not found
+		Use(func(next handler.MCPHandler) handler.MCPHandler {
+			return handler.MCPHandlerFunc(func(w io.RPCResponseWriter, req *spec.Request[int]) {
+				if strings.HasPrefix(req.Method, "x/denied") {
+					io.NewResponseWriter(w, req.ID).WriteError(spec.ErrorCodeInvalidRequest, "denied")
+					return
+				}
+				next.ServeRPC(w, req)
+			})
+		})
+
+	input := strings.Join([]string{
+		// unknown methods share a label whatever the outcome, also before initialize
+		`{"jsonrpc":"2.0","id":1,"method":"x/before-1"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"x/before-2"}`,
+		`{"jsonrpc":"2.0","id":7,"method":"x/denied-1"}`,
+		`{"jsonrpc":"2.0","id":8,"method":"x/denied-2"}`,
+		initializeRequest,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"weather"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"random-tool"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"x/after"}`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/list","params":{"cursor":1}}`,
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	if err := builder.BuildStdioServer().serve(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := newTestRequest(http.MethodGet, DefaultMetricsEndpoint, "")
+	builder.BuildHTTPServer().WithMetricsEndpoint("").Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+
+	for _, series := range []string{
+		`mcp_requests_total{method="other",tool="",code="-32601"} 3`,
+		`mcp_requests_total{method="other",tool="",code="-32600"} 2`,
+		`mcp_requests_total{method="initialize",tool="",code="ok"} 1`,
+		`mcp_requests_total{method="tools/call",tool="weather",code="ok"} 1`,
+		`mcp_requests_total{method="tools/call",tool="",code="-32602"} 1`,
+		`mcp_request_duration_seconds_count{method="other",tool=""} 5`,
+		`mcp_active_sessions 0`,
+	} {
+		if !strings.Contains(body, series+"\n") {
+			t.Errorf("metrics don't contain %s", series)
+		}
+	}
+
+	for _, raw := range []string{"x/before", "x/denied", "x/after", "random-tool"} {
+		if strings.Contains(body, raw) {
+			t.Errorf("metrics contain the client value %q", raw)
+		}
+	}
+}
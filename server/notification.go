@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/makarski/mcp-robot/handler"
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// OnNotification registers a handler for client notifications of the given method.
+// Handlers run after the built-in processing of the notification and should return quickly,
+// as they are called before the next message of the client is read
+func (s *server) OnNotification(method string, fn handler.NotificationHandlerFunc) *server {
+	s.mu.Lock()
+	s.notificationHandlers[method] = append(s.notificationHandlers[method], fn)
+	s.mu.Unlock()
+
+	return s
+}
+
+// serveNotification dispatches a client notification. It never writes a response
+func (s *server) serveNotification(ctx context.Context, sess *session.Session, rpcReq *spec.Request[int]) {
+	sess.Touch()
+
+	notification := &spec.Notification{
+		JsonRPC: rpcReq.Jsonrpc,
+		Method:  rpcReq.Method,
+		Params:  rpcReq.Params,
+	}
+
+	switch notification.Method {
+	case spec.MethodNotificationsInitialized:
+		sess.MarkReady()
+	case spec.MethodNotificationsCancelled:
+		if requestID, ok := notification.Params["requestId"]; ok {
+			if id, ok := toRequestID(requestID); ok {
+				sess.CancelRequest(id)
+			}
+		}
+	case spec.MethodNotificationsRootsListChanged:
+		sess.InvalidateRoots()
+	}
+
+	s.mu.RLock()
+	handlers := s.notificationHandlers[notification.Method]
+	s.mu.RUnlock()
+
+	ctx = session.NewContext(ctx, sess)
+	for _, h := range handlers {
+		h(ctx, notification)
+	}
+}
+
+// toRequestID converts a decoded JSON id to the type requests are tracked with,
+// see spec.Request.RequestID
+func toRequestID(v any) (any, bool) {
+	switch id := v.(type) {
+	case string:
+		return id, true
+	case json.Number:
+		i, err := strconv.Atoi(id.String())
+		return i, err == nil
+	case float64:
+		return int(id), true
+	case int:
+		return id, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/makarski/mcp-robot/auth"
+	"github.com/makarski/mcp-robot/spec"
+	"github.com/makarski/mcp-robot/tools"
+)
+
+func TestToolPolicies(t *testing.T) {
+	okTool := tools.ToolFunc[tools.ToolResultText](func(map[string]any) (tools.ToolResultText, error) {
+		return tools.NewToolResultText("ok"), nil
+	})
+
+	srv := NewServerBuilder("test", "1.0.0").
+		WithTool(tools.NewTool("read").Description("Reads").MarkReadOnly(true).Build(), okTool).
+		WithTool(tools.NewTool("admin").Description("Administers").MarkReadOnly(true).RequireScopes("admin").Build(), okTool).
+		WithTool(tools.NewTool("update").Description("Updates").MarkAsDestructive(false).Build(), okTool).
+		WithTool(tools.NewTool("drop").Description("Drops").Build(), okTool).
+		WithToolPolicy(tools.AnnotationPolicy(tools.AnnotationScopes{Write: "write", Destructive: "delete"}))
+	sess := newBatchSession(spec.ProtocolVersion20250618)
+
+	tests := []struct {
+		name    string
+		scopes  []string
+		visible []string
+		// missing are the scopes reported for the hidden tools
+		missing map[string][]string
+	}{
+		{"anonymous", nil, []string{"read"}, map[string][]string{
+			"admin":  {"admin"},
+			"update": {"write"},
+			"drop":   {"write", "delete"},
+		}},
+		{"admin", []string{"admin"}, []string{"read", "admin"}, map[string][]string{
+			"update": {"write"},
+			"drop":   {"write", "delete"},
+		}},
+		{"writer", []string{"write"}, []string{"read", "update"}, map[string][]string{
+			"admin": {"admin"},
+			"drop":  {"delete"},
+		}},
+		{"all scopes", []string{"admin", "write", "delete"}, []string{"read", "admin", "update", "drop"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.scopes != nil {
+				ctx = auth.NewContext(ctx, &auth.TokenInfo{Subject: "user", Scopes: tt.scopes})
+			}
+
+			serve := func(method string, params map[string]any) map[string]any {
+				var buf bytes.Buffer
+				srv.serveRequest(ctx, sess, &buf, &spec.Request[int]{Jsonrpc: spec.JsonRPC, ID: 1, Method: method, Params: params})
+
+				var response map[string]any
+				if err := json.Unmarshal(buf.Bytes(), &response); err != nil {
+					t.Fatalf("invalid response %q: %v", buf.Bytes(), err)
+				}
+				return response
+			}
+
+			result, _ := serve(spec.MethodToolsList, nil)["result"].(map[string]any)
+			listed, _ := result["tools"].([]any)
+			var names []string
+			for _, tool := range listed {
+				names = append(names, tool.(map[string]any)["name"].(string))
+			}
+			if !slices.Equal(names, tt.visible) {
+				t.Errorf("tools/list = %q, want %q", names, tt.visible)
+			}
+
+			for _, name := range []string{"read", "admin", "update", "drop"} {
+				response := serve(spec.MethodToolsCall, map[string]any{"name": name})
+				missing, hidden := tt.missing[name]
+
+				if !hidden {
+					if response["result"] == nil {
+						t.Errorf("calling %s: response = %v, want a result", name, response)
+					}
+					continue
+				}
+
+				e, _ := response["error"].(map[string]any)
+				if e == nil || e["code"] != float64(spec.ErrorCodeToolForbidden) {
+					t.Errorf("calling %s: response = %v, want code %d", name, response, spec.ErrorCodeToolForbidden)
+					continue
+				}
+
+				data, _ := e["data"].(map[string]any)
+				var required []string
+				if scopes, ok := data["requiredScopes"].([]any); ok {
+					for _, scope := range scopes {
+						required = append(required, scope.(string))
+					}
+				}
+				if data["tool"] != name || !slices.Equal(required, missing) {
+					t.Errorf("calling %s: error data = %v, want the tool and the scopes %q", name, data, missing)
+				}
+			}
+		})
+	}
+}
+
+func TestToolPolicyFunc(t *testing.T) {
+	okTool := tools.ToolFunc[tools.ToolResultText](func(map[string]any) (tools.ToolResultText, error) {
+		return tools.NewToolResultText("ok"), nil
+	})
+
+	// a custom policy denying without scopes hides the tool from everyone
+	srv := NewServerBuilder("test", "1.0.0").
+		WithTool(tools.NewTool("open").Description("Open").Build(), okTool).
+		WithTool(tools.NewTool("closed").Description("Closed").Build(), okTool).
+		WithToolPolicy(tools.PolicyFunc(func(_ context.Context, definition tools.ToolDefinition) error {
+			if definition.Name == "closed" {
+				return &tools.PolicyError{Tool: definition.Name, Reason: "maintenance"}
+			}
+			return nil
+		}))
+
+	ctx := auth.NewContext(context.Background(), &auth.TokenInfo{Subject: "user", Scopes: []string{"admin"}})
+
+	srv.mu.RLock()
+	visible := srv.visibleTools(ctx)
+	srv.mu.RUnlock()
+	if !slices.Equal(visible, []string{"open"}) {
+		t.Errorf("visible tools = %q, want [open]", visible)
+	}
+
+	definition := srv.tools["closed"].toolDefinition
+	err := srv.authorizeToolCall(ctx, definition)
+
+	pe, ok := err.(*spec.ProtocolError)
+	if !ok || pe.Code != spec.ErrorCodeToolForbidden {
+		t.Fatalf("err = %v, want code %d", err, spec.ErrorCodeToolForbidden)
+	}
+	if data, _ := pe.Data.(map[string]any); data["tool"] != "closed" || data["requiredScopes"] != nil {
+		t.Errorf("data = %v, want the tool without required scopes", pe.Data)
+	}
+
+	if err := srv.authorizeToolCall(ctx, srv.tools["open"].toolDefinition); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+const (
+	headerLastEventID = "Last-Event-ID"
+
+	// the kinds of SSE streams, encoded in the stream ids
+	streamKindNotifications = "get"
+	streamKindRequest       = "req"
+)
+
+// streamSignal wakes up the connections following a request stream
+// once the response has been stored
+type streamSignal struct {
+	mu      sync.Mutex
+	changed chan struct{}
+	done    bool
+}
+
+// WithEventStore makes the SSE streams of the Streamable HTTP transport resumable.
+// Every event gets an id and is kept in the store, a client reconnecting with
+// a GET request and the Last-Event-ID header receives the events it missed
+// and the stream continues.
+//
+// Requests of clients accepting text/event-stream are answered with an SSE stream
+// and keep running when the client disconnects, so that the response can be picked up
+// by resuming the stream. Without a store responses are plain JSON, as by default
+func (s *HTTPServer) WithEventStore(store EventStore) *HTTPServer {
+	s.eventStore = store
+	return s
+}
+
+// serveRequestStream serves the request in the background and answers
+// with an SSE stream the response is delivered over once it is stored
+func (s *HTTPServer) serveRequestStream(w http.ResponseWriter, req *http.Request, sess *session.Session, rpcReq *spec.Request[int]) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeHTTPError(w, http.StatusInternalServerError, newMessageError(rawRequestID(rpcReq), spec.ErrorCodeInternalError, "streaming is not supported"))
+		return
+	}
+
+	// the request outlives the connection, but keeps the values of its context
+	ctx := context.WithoutCancel(req.Context())
+	streamID := newStreamID(sess, streamKindRequest)
+
+	// the priming event gives the client an id to resume from before the response is ready
+	primingID, err := s.eventStore.StoreEvent(ctx, streamID, nil)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, newMessageError(rawRequestID(rpcReq), spec.ErrorCodeInternalError, fmt.Sprintf("failed to store event: %s", err)))
+		return
+	}
+
+	if !s.active.acquire() {
+		writeHTTPError(w, http.StatusServiceUnavailable, newMessageError(rawRequestID(rpcReq), spec.ErrorCodeInternalError, "server is shutting down"))
+		return
+	}
+
+	signal := &streamSignal{changed: make(chan struct{})}
+
+	s.sessionsMu.Lock()
+	s.requestStreams[streamID] = signal
+	s.sessionsMu.Unlock()
+
+	go func() {
+		defer s.active.release()
+
+		var buf bytes.Buffer
+		s.serveRequest(ctx, sess, &buf, rpcReq)
+
+		if message := bytes.TrimSpace(buf.Bytes()); len(message) > 0 {
+			if _, err := s.eventStore.StoreEvent(ctx, streamID, message); err != nil {
+				s.logger.ErrorContext(ctx, "failed to store event", "stream", streamID, "error", err)
+			}
+		}
+
+		s.sessionsMu.Lock()
+		delete(s.requestStreams, streamID)
+		s.sessionsMu.Unlock()
+
+		signal.finish()
+	}()
+
+	defer s.trackStream(metricsStreamRequest)()
+
+	setSSEHeaders(w, sess)
+	if err := writeSSEEvent(w, primingID, "", nil); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	s.followRequestStream(w, req, sess, primingID, signal)
+}
+
+// followRequestStream writes the events stored on a request stream after lastEventID
+// until the response has been delivered. A nil signal means the request has completed
+func (s *HTTPServer) followRequestStream(w http.ResponseWriter, req *http.Request, sess *session.Session, lastEventID string, signal *streamSignal) {
+	flusher := w.(http.Flusher)
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		changed, done := signal.wait()
+
+		_, events, err := s.eventStore.ReplayEventsAfter(req.Context(), lastEventID)
+		if err != nil {
+			return
+		}
+
+		for _, event := range events {
+			if len(event.Message) > 0 {
+				if err := writeSSEEvent(w, event.ID, "message", event.Message); err != nil {
+					return
+				}
+			}
+			lastEventID = event.ID
+		}
+		flusher.Flush()
+
+		if done {
+			return
+		}
+
+		// unlike notification streams, request streams stay open during a shutdown
+		// until the response is delivered, as the request is awaited anyway
+		select {
+		case <-changed:
+		case <-req.Context().Done():
+			return
+		case <-sess.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// resumeStream replays the events following the Last-Event-ID of the request.
+// Request streams are followed until the response is delivered, for notification
+// streams the id of the resumed stream is returned. If the events can't be replayed,
+// e.g. because they have expired, an empty id is returned and a new stream is started
+func (s *HTTPServer) resumeStream(w http.ResponseWriter, req *http.Request, sess *session.Session) (string, bool) {
+	lastEventID := req.Header.Get(headerLastEventID)
+
+	streamID, events, err := s.eventStore.ReplayEventsAfter(req.Context(), lastEventID)
+	if err != nil {
+		return "", false
+	}
+
+	kind, ok := streamKind(sess, streamID)
+	if !ok {
+		// streams of other sessions are never replayed
+		return "", false
+	}
+
+	setSSEHeaders(w, sess)
+
+	if kind == streamKindRequest {
+		s.sessionsMu.RLock()
+		signal := s.requestStreams[streamID]
+		s.sessionsMu.RUnlock()
+
+		s.followRequestStream(w, req, sess, lastEventID, signal)
+		return "", true
+	}
+
+	for _, event := range events {
+		if len(event.Message) > 0 {
+			if err := writeSSEEvent(w, event.ID, "message", event.Message); err != nil {
+				return "", true
+			}
+		}
+	}
+
+	return streamID, false
+}
+
+// storeEvent stores the message on the stream and returns the id of the event.
+// Messages are sent without an id if no store is configured or storing fails
+func (s *HTTPServer) storeEvent(ctx context.Context, streamID string, message []byte) string {
+	if s.eventStore == nil {
+		return ""
+	}
+
+	id, err := s.eventStore.StoreEvent(ctx, streamID, message)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to store event", "stream", streamID, "error", err)
+		return ""
+	}
+
+	return id
+}
+
+// wait returns a channel closed on the next change of the stream
+// and whether the stream has completed. A nil signal is always completed
+func (ss *streamSignal) wait() (<-chan struct{}, bool) {
+	if ss == nil {
+		return nil, true
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.changed, ss.done
+}
+
+func (ss *streamSignal) finish() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.done = true
+	close(ss.changed)
+}
+
+// newStreamID creates the id of a new SSE stream of the session.
+// The id is prefixed with the session id and the kind of the stream
+func newStreamID(sess *session.Session, kind string) string {
+	return sess.ID() + "-" + kind + "-" + session.NewID()
+}
+
+// streamKind returns the kind of the stream, if the stream belongs to the session
+func streamKind(sess *session.Session, streamID string) (string, bool) {
+	rest, ok := strings.CutPrefix(streamID, sess.ID()+"-")
+	if !ok {
+		return "", false
+	}
+
+	kind, _, ok := strings.Cut(rest, "-")
+	return kind, ok && (kind == streamKindNotifications || kind == streamKindRequest)
+}
+
+// acceptsEventStream reports whether the client accepts SSE responses to its requests
+func acceptsEventStream(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+}
+
+func setSSEHeaders(w http.ResponseWriter, sess *session.Session) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set(headerSessionID, sess.ID())
+	w.WriteHeader(http.StatusOK)
+}
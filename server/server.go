@@ -1,20 +1,32 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	stdio "io"
+	"log/slog"
+	"net/http"
 	"os"
+	"runtime/debug"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/makarski/mcp-robot/auth"
 	"github.com/makarski/mcp-robot/handler"
 	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/ratelimit"
+	"github.com/makarski/mcp-robot/session"
 	"github.com/makarski/mcp-robot/spec"
 	"github.com/makarski/mcp-robot/tools"
 )
 
 var o = os.Stdout
 
+// DefaultSessionIdleTimeout is the time after which an inactive HTTP session expires
+const DefaultSessionIdleTimeout = 30 * time.Minute
+
 type (
 	server struct {
 		mu           sync.RWMutex
@@ -22,11 +34,32 @@ type (
 		tools        map[string]serverTool
 		toolNames    []string // used for pagination
 		info         spec.Info
+		instructions string
+
+		sessionIdleTimeout time.Duration
+		onSessionStart     []func(*session.Session)
+		onSessionEnd       []func(*session.Session)
+
+		notificationHandlers map[string][]handler.NotificationHandlerFunc
+
+		policies []tools.Policy
+		logger   *slog.Logger
+
+		globalLimiter *ratelimit.Limiter
+		sessionLimits sessionLimiters
+		toolTimeout   time.Duration
+		middlewares   []handler.Middleware
+		metrics       *serverMetrics
+
+		// liveMu guards the started sessions of all transports
+		liveMu sync.Mutex
+		live   map[string]*session.Session
 	}
 
 	serverTool struct {
 		handler        handler.MCPHandler
 		toolDefinition tools.ToolDefinition
+		limiter        *ratelimit.Limiter
 	}
 )
 
@@ -36,7 +69,14 @@ func NewServerBuilder(name, version string) *server {
 
 func (s *server) BuildHTTPServer() *HTTPServer {
 	return &HTTPServer{
-		server: s,
+		server:         s,
+		endpoint:       DefaultEndpoint,
+		cors:           DefaultCORSPolicy(),
+		sessions:       make(map[string]*session.Session),
+		legacyStreams:  make(map[string]*legacyStream),
+		requestStreams: make(map[string]*streamSignal),
+		servers:        make(map[*http.Server]struct{}),
+		shutdownCh:     make(chan struct{}),
 	}
 }
 
@@ -48,8 +88,13 @@ func (s *server) BuildStdioServer() *StdioServer {
 
 func newServer(name, version string) *server {
 	return &server{
-		toolsPerPage: -1, // -1 means no pagination
-		tools:        make(map[string]serverTool),
+		toolsPerPage:         -1, // -1 means no pagination
+		tools:                make(map[string]serverTool),
+		sessionIdleTimeout:   DefaultSessionIdleTimeout,
+		notificationHandlers: make(map[string][]handler.NotificationHandlerFunc),
+		policies:             []tools.Policy{tools.ScopePolicy()},
+		logger:               slog.Default(),
+		live:                 make(map[string]*session.Session),
 		info: spec.Info{
 			Name:    name,
 			Version: version,
@@ -74,20 +119,49 @@ func (s *server) okEmptyResponse(w io.RPCResponseWriter, rpcReq *spec.Request[in
 }
 
 func (s *server) initializeHandler(w io.RPCResponseWriter, rpcReq *spec.Request[int]) {
-	capabilities := s.capabilities()
+	rw := io.NewResponseWriter(w, rpcReq.ID)
 
-	response := spec.Response[int]{
-		Jsonrpc: spec.JsonRPC,
-		ID:      rpcReq.ID,
-		Result: map[string]any{
-			"protocolVersion": spec.ProtocolVersion,
-			"capabilities":    capabilities,
-			"serverInfo":      s.info,
-		},
+	sess, ok := session.FromContext(rpcReq.Context())
+	if !ok {
+		rw.WriteError(spec.ErrorCodeInternalError, "no session attached to the initialize request")
+		return
 	}
 
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		rw := io.NewResponseWriter(w, rpcReq.ID)
+	if sess.Initialized() {
+		rw.WriteError(spec.ErrorCodeInvalidRequest, "session is already initialized")
+		return
+	}
+
+	var params spec.InitializeParams
+	if err := decodeParams(rpcReq.Params, &params); err != nil {
+		rw.WriteError(
+			spec.ErrorCodeInvalidParams,
+			fmt.Sprintf("invalid initialize params: %s", err),
+		)
+		return
+	}
+
+	if params.ProtocolVersion == "" {
+		rw.WriteError(spec.ErrorCodeInvalidParams, "missing 'protocolVersion' parameter")
+		return
+	}
+
+	protocolVersion := spec.NegotiateProtocolVersion(params.ProtocolVersion)
+	sess.Initialize(protocolVersion, params.ClientInfo, params.Capabilities)
+
+	s.mu.RLock()
+	result := map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    s.capabilities(),
+		"serverInfo":      s.info,
+	}
+
+	if s.instructions != "" {
+		result["instructions"] = s.instructions
+	}
+	s.mu.RUnlock()
+
+	if err := rw.WriteResult(result); err != nil {
 		rw.WriteError(
 			spec.ErrorCodeInternalError,
 			"failed to encode initialize response",
@@ -100,7 +174,10 @@ func (s *server) listToolsHandler(w io.RPCResponseWriter, rpcReq *spec.Request[i
 	defer s.mu.RUnlock()
 
 	rw := io.NewResponseWriter(w, rpcReq.ID)
-	if len(s.toolNames) == 0 {
+
+	// tools the caller is not allowed to call are not listed
+	toolNames := s.visibleTools(rpcReq.Context())
+	if len(toolNames) == 0 {
 		rw.WriteResult(map[string]any{"tools": []tools.ToolDefinition{}})
 		return
 	}
@@ -108,7 +185,7 @@ func (s *server) listToolsHandler(w io.RPCResponseWriter, rpcReq *spec.Request[i
 	startPage := 0
 	offset := 0
 	nextPage := startPage
-	end := len(s.tools)
+	end := len(toolNames)
 
 	if cursor, ok := rpcReq.Params["cursor"]; ok {
 		cursorStr, ok := cursor.(string)
@@ -139,7 +216,7 @@ func (s *server) listToolsHandler(w io.RPCResponseWriter, rpcReq *spec.Request[i
 		}
 	}
 
-	if offset >= len(s.toolNames) {
+	if offset >= len(toolNames) {
 		rw.WriteError(
 			spec.ErrorCodeInvalidParams,
 			fmt.Sprintf("invalid 'cursor' parameter: %d is out of range", startPage),
@@ -147,9 +224,15 @@ func (s *server) listToolsHandler(w io.RPCResponseWriter, rpcReq *spec.Request[i
 		return
 	}
 
-	toolsList := make([]tools.ToolDefinition, 0, len(s.tools))
-	for _, tool := range s.toolNames[offset:end] {
-		toolsList = append(toolsList, s.tools[tool].toolDefinition)
+	features := session.FeaturesFromContext(rpcReq.Context())
+
+	toolsList := make([]tools.ToolDefinition, 0, end-offset)
+	for _, tool := range toolNames[offset:end] {
+		definition := s.tools[tool].toolDefinition
+		if !features.StructuredContent {
+			definition.OutputSchema = tools.ToolSchema{}
+		}
+		toolsList = append(toolsList, definition)
 	}
 
 	listResult := map[string]any{
@@ -174,7 +257,7 @@ func (s *server) WithTool(definition tools.ToolDefinition, toolHandler tools.Too
 
 	if _, ok := s.tools[definition.Name]; !ok {
 		handler := toolHandler.MCPHandler(definition)
-		s.tools[definition.Name] = serverTool{handler, definition}
+		s.tools[definition.Name] = serverTool{handler, definition, newLimiter(definition.RateLimit)}
 		s.toolNames = append(s.toolNames, definition.Name)
 	}
 
@@ -183,6 +266,109 @@ func (s *server) WithTool(definition tools.ToolDefinition, toolHandler tools.Too
 	return s
 }
 
+// HasTool reports whether a tool with the given name is registered, e.g. to bound
+// the cardinality of telemetry attributes to the names of registered tools
+func (s *server) HasTool(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.tools[name]
+	return ok
+}
+
+// WithInstructions sets the instructions returned to clients on initialization,
+// describing how to use the server and its features
+func (s *server) WithInstructions(instructions string) *server {
+	s.mu.Lock()
+	s.instructions = instructions
+	s.mu.Unlock()
+
+	return s
+}
+
+// WithToolPolicy adds policies deciding which tools a caller may list and call.
+// A tool is accessible only if all policies allow it.
+// The scopes declared with ToolBuilder.RequireScopes are always enforced
+func (s *server) WithToolPolicy(policies ...tools.Policy) *server {
+	s.mu.Lock()
+	s.policies = append(s.policies, policies...)
+	s.mu.Unlock()
+
+	return s
+}
+
+// WithLogger sets the logger receiving the audit entries of denied tool calls
+// and other server events
+//
+// Default value is slog.Default()
+func (s *server) WithLogger(logger *slog.Logger) *server {
+	s.mu.Lock()
+	s.logger = logger
+	s.mu.Unlock()
+
+	return s
+}
+
+// OnSessionStart registers a hook called once a client session has been initialized,
+// on every transport after the successful response to initialize.
+// The session carries the client info and the negotiated protocol version
+func (s *server) OnSessionStart(fn func(*session.Session)) *server {
+	s.mu.Lock()
+	s.onSessionStart = append(s.onSessionStart, fn)
+	s.mu.Unlock()
+
+	return s
+}
+
+// OnSessionEnd registers a hook called after a client session has been closed,
+// either by the client, by the transport or by idle expiry.
+// Sessions that were never initialized don't reach the hooks
+func (s *server) OnSessionEnd(fn func(*session.Session)) *server {
+	s.mu.Lock()
+	s.onSessionEnd = append(s.onSessionEnd, fn)
+	s.mu.Unlock()
+
+	return s
+}
+
+// SessionIdleTimeout sets the inactivity period after which HTTP sessions expire.
+// A zero or negative value disables expiry
+//
+// Default value is DefaultSessionIdleTimeout
+func (s *server) SessionIdleTimeout(timeout time.Duration) *server {
+	s.mu.Lock()
+	s.sessionIdleTimeout = timeout
+	s.mu.Unlock()
+
+	return s
+}
+
+// Use adds middlewares wrapping the handling of every request.
+// The first middleware added is the outermost one
+func (s *server) Use(middlewares ...handler.Middleware) *server {
+	s.mu.Lock()
+	s.middlewares = append(s.middlewares, middlewares...)
+	s.mu.Unlock()
+
+	return s
+}
+
+// ToolTimeout sets the timeout of tool calls for tools without a timeout of their own.
+// Zero, the default, lets calls run until they complete or are cancelled.
+//
+// A timeout answers the call with an error result and cancels the context passed
+// to the tool function, but it doesn't stop the function: Go can't preempt a goroutine,
+// so a function ignoring its context keeps running in the background until it returns,
+// and its result is discarded. The call keeps counting against the concurrency limits
+// until the function returns, so slow functions can't pile up beyond MaxConcurrent
+func (s *server) ToolTimeout(timeout time.Duration) *server {
+	s.mu.Lock()
+	s.toolTimeout = timeout
+	s.mu.Unlock()
+
+	return s
+}
+
 func (s *server) ToolsPerPage(toolsPerPage int) *server {
 	s.mu.Lock()
 	s.toolsPerPage = toolsPerPage
@@ -191,6 +377,194 @@ func (s *server) ToolsPerPage(toolsPerPage int) *server {
 	return s
 }
 
+func (s *server) idleTimeout() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sessionIdleTimeout
+}
+
+func (s *server) startSession(sess *session.Session) {
+	s.liveMu.Lock()
+	s.live[sess.ID()] = sess
+	s.liveMu.Unlock()
+
+	s.mu.RLock()
+	hooks := s.onSessionStart
+	s.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(sess)
+	}
+}
+
+// endSession closes the session. The end hooks only run for sessions
+// that have been started, i.e. initialized
+func (s *server) endSession(sess *session.Session) {
+	sess.Close()
+	s.sessionLimits.end(sess)
+
+	s.liveMu.Lock()
+	_, started := s.live[sess.ID()]
+	delete(s.live, sess.ID())
+	s.liveMu.Unlock()
+
+	if !started {
+		return
+	}
+
+	s.mu.RLock()
+	hooks := s.onSessionEnd
+	s.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(sess)
+	}
+}
+
+// liveSessions returns the sessions started and not yet ended
+func (s *server) liveSessions() []*session.Session {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+
+	sessions := make([]*session.Session, 0, len(s.live))
+	for _, sess := range s.live {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+// serveRequest resolves and runs the handler of a single request within the session.
+// The handler context carries the session and is cancelled when the request
+// is cancelled, the session is closed or ctx is done
+func (s *server) serveRequest(ctx context.Context, sess *session.Session, w io.RPCResponseWriter, rpcReq *spec.Request[int]) {
+	sess.Touch()
+
+	ctx, cancel := context.WithCancelCause(session.NewContext(ctx, sess))
+	defer cancel(nil)
+
+	req := rpcReq.WithContext(ctx)
+
+	// tracked before resolving, a call waiting for rate limit capacity can be cancelled too
+	sess.TrackRequest(req.RequestID(), func() { cancel(session.ErrRequestCancelled) })
+	defer sess.UntrackRequest(req.RequestID())
+
+	s.mu.RLock()
+	var h handler.MCPHandler = handler.MCPHandlerFunc(s.dispatch)
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		h = s.middlewares[i](h)
+	}
+	s.mu.RUnlock()
+
+	cw := &cancelAwareWriter{ctx: ctx, w: withResponseID(w, req)}
+	defer func() {
+		if v := recover(); v != nil {
+			s.recoverRequest(ctx, cw, req, v)
+		}
+	}()
+
+	h.ServeRPC(cw, req)
+}
+
+// recoverRequest logs the panic of a request handler
+// and answers the request with an internal error
+func (s *server) recoverRequest(ctx context.Context, w io.RPCResponseWriter, rpcReq *spec.Request[int], v any) {
+	stack := debug.Stack()
+	if pe, ok := v.(*tools.PanicError); ok {
+		v, stack = pe.Value, pe.Stack
+	}
+
+	s.mu.RLock()
+	logger := s.logger
+	s.mu.RUnlock()
+
+	attrs := []any{"method", rpcReq.Method, "request", rpcReq.RequestID(), "panic", fmt.Sprint(v), "stack", string(stack)}
+	if sess, ok := session.FromContext(ctx); ok {
+		attrs = append(attrs, "session", sess.ID())
+	}
+	logger.ErrorContext(ctx, "request handler panicked", attrs...)
+
+	rw := io.NewResponseWriter(w, rpcReq.ID)
+	rw.WriteError(spec.ErrorCodeInternalError, "internal error")
+}
+
+// dispatch runs the handler of the request method,
+// or answers with a JSON-RPC error if no handler could be resolved
+func (s *server) dispatch(w io.RPCResponseWriter, rpcReq *spec.Request[int]) {
+	h, err := s.resolveHandler(*rpcReq)
+	if err == nil {
+		h.ServeRPC(w, rpcReq)
+		return
+	}
+
+	rw := io.NewResponseWriter(w, rpcReq.ID)
+
+	pe, ok := err.(*spec.ProtocolError)
+	if !ok {
+		rw.WriteError(spec.ErrorCodeInternalError, fmt.Sprintf("Failed to resolve handler: %s", err))
+		return
+	}
+
+	rw.WriteErrorData(pe.Code, fmt.Sprintf("Failed to resolve handler: %s", pe.Message), pe.Data)
+}
+
+// allowTool evaluates the policies for the caller of ctx
+func (s *server) allowTool(ctx context.Context, definition tools.ToolDefinition) error {
+	for _, policy := range s.policies {
+		if err := policy.Allow(ctx, definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visibleTools returns the names of the tools the caller may call,
+// in registration order. The caller must hold s.mu
+func (s *server) visibleTools(ctx context.Context) []string {
+	names := make([]string, 0, len(s.toolNames))
+	for _, name := range s.toolNames {
+		if s.allowTool(ctx, s.tools[name].toolDefinition) == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// authorizeToolCall checks the policies before a tool call
+// and records an audit entry for denied calls
+func (s *server) authorizeToolCall(ctx context.Context, definition tools.ToolDefinition) error {
+	s.mu.RLock()
+	err := s.allowTool(ctx, definition)
+	logger := s.logger
+	s.mu.RUnlock()
+
+	if err == nil {
+		return nil
+	}
+
+	attrs := []any{
+		"tool", definition.Name,
+		"reason", err.Error(),
+		"destructive", definition.IsDestructive(),
+	}
+
+	if sess, ok := session.FromContext(ctx); ok {
+		attrs = append(attrs, "session", sess.ID())
+	}
+
+	if info, ok := auth.FromContext(ctx); ok {
+		attrs = append(attrs, "subject", info.Subject, "scopes", info.Scopes)
+	}
+
+	logger.WarnContext(ctx, "tool call denied", attrs...)
+
+	data := map[string]any{"tool": definition.Name}
+	if pe, ok := err.(*tools.PolicyError); ok && len(pe.MissingScopes) > 0 {
+		data["requiredScopes"] = pe.MissingScopes
+	}
+
+	return spec.NewProtocolErrorWithData(spec.ErrorCodeToolForbidden, err.Error(), data)
+}
+
 func (s *server) capabilities() map[string]spec.CapabilityParam {
 	capabilities := make(map[string]spec.CapabilityParam)
 
@@ -204,8 +578,12 @@ func (s *server) capabilities() map[string]spec.CapabilityParam {
 }
 
 func (s *server) resolveHandler(rpcReq spec.Request[int]) (handler.MCPHandler, error) {
+	if err := checkInitialized(rpcReq); err != nil {
+		return nil, err
+	}
+
 	switch rpcReq.Method {
-	case spec.MethodNotificationsInitialized, spec.MethodPing:
+	case spec.MethodPing:
 		return handler.MCPHandlerFunc(s.okEmptyResponse), nil
 	case spec.MethodInitialize:
 		return handler.MCPHandlerFunc(s.initializeHandler), nil
@@ -235,6 +613,10 @@ func (s *server) resolveHandler(rpcReq spec.Request[int]) (handler.MCPHandler, e
 			)
 		}
 
+		if err := s.authorizeToolCall(rpcReq.Context(), tool.toolDefinition); err != nil {
+			return nil, err
+		}
+
 		args, hasArgs := rpcReq.Params["arguments"]
 		if !hasArgs && len(tool.toolDefinition.InputSchema.Required) > 0 {
 			return nil, spec.NewProtocolError(
@@ -257,7 +639,30 @@ func (s *server) resolveHandler(rpcReq spec.Request[int]) (handler.MCPHandler, e
 			}
 		}
 
-		return tool.handler, nil
+		deadline, err := clientDeadline(rpcReq.Params)
+		if err != nil {
+			return nil, err
+		}
+
+		permits, err := s.acquireToolCall(rpcReq.Context(), tool)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler.MCPHandlerFunc(func(w io.RPCResponseWriter, rpcReq *spec.Request[int]) {
+			// the permits are kept until the tool function returns, which may be after a timeout
+			release := tools.NewCallRelease(func() { releasePermits(permits) })
+			defer release.Release()
+
+			ctx, cancel := s.toolContext(rpcReq.Context(), tool.toolDefinition, deadline)
+			defer cancel()
+			ctx = tools.WithCallRelease(ctx, release)
+
+			s.logToolCall(ctx, tool.toolDefinition, rpcReq)
+
+			tool.handler.ServeRPC(w, rpcReq.WithContext(ctx))
+			s.logTimeout(ctx, tool.toolDefinition, rpcReq.RequestID())
+		}), nil
 	default:
 		return nil, spec.NewProtocolError(
 			spec.ErrorCodeMethodNotFound,
@@ -265,3 +670,52 @@ func (s *server) resolveHandler(rpcReq spec.Request[int]) (handler.MCPHandler, e
 		)
 	}
 }
+
+// checkInitialized rejects requests that arrive before the initialize handshake.
+// Pings are allowed at any time
+func checkInitialized(rpcReq spec.Request[int]) error {
+	switch rpcReq.Method {
+	case spec.MethodInitialize, spec.MethodPing:
+		return nil
+	}
+
+	sess, ok := session.FromContext(rpcReq.Context())
+	if !ok || !sess.Initialized() {
+		return spec.NewProtocolError(
+			spec.ErrorCodeInvalidRequest,
+			fmt.Sprintf("server not initialized: received '%s' before 'initialize'", rpcReq.Method),
+		)
+	}
+
+	return nil
+}
+
+func decodeParams(params map[string]any, v any) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// cancelAwareWriter drops the response of a request cancelled by the client,
+// the client is no longer waiting for it
+type cancelAwareWriter struct {
+	ctx context.Context
+	w   io.RPCResponseWriter
+}
+
+func (cw *cancelAwareWriter) Write(b []byte) (int, error) {
+	if context.Cause(cw.ctx) == session.ErrRequestCancelled {
+		return len(b), nil
+	}
+	return cw.w.Write(b)
+}
+
+func (cw *cancelAwareWriter) WriteResultStream(write func(w stdio.Writer) error) error {
+	if context.Cause(cw.ctx) == session.ErrRequestCancelled {
+		return nil
+	}
+	return io.WriteResultStream(cw.w, write)
+}
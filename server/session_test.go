@@ -0,0 +1,228 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/makarski/mcp-robot/internal/websocket"
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+const (
+	initializeRequest       = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"client","version":"2.0.0"}}}`
+	failedInitializeRequest = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{}}}`
+)
+
+// hookRecorder records the session hooks in the order they are called
+type hookRecorder struct {
+	mu     sync.Mutex
+	events []string
+	ended  chan struct{}
+}
+
+func newHookRecorder(s *server) *hookRecorder {
+	r := &hookRecorder{ended: make(chan struct{}, 1)}
+
+	s.OnSessionStart(func(sess *session.Session) {
+		// the hook sees the result of the handshake
+		r.record(fmt.Sprintf("start %s %s", sess.ClientInfo().Name, sess.ProtocolVersion()))
+	})
+	s.OnSessionEnd(func(sess *session.Session) {
+		r.record("end")
+		r.ended <- struct{}{}
+	})
+
+	return r
+}
+
+func (r *hookRecorder) record(event string) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+func (r *hookRecorder) check(t *testing.T, want ...string) {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !slices.Equal(r.events, want) {
+		t.Errorf("hooks = %q, want %q", r.events, want)
+	}
+}
+
+// waitEnded waits for the end hook of a transport ending sessions in the background
+func (r *hookRecorder) waitEnded(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-r.ended:
+	case <-time.After(2 * time.Second):
+		t.Fatal("session not ended")
+	}
+}
+
+func TestSessionLifecycleOnStdio(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{"initialized", []string{initializeRequest, `{"jsonrpc":"2.0","method":"notifications/initialized"}`}, []string{"start client 2025-06-18", "end"}},
+		{"never initialized", []string{`{"jsonrpc":"2.0","id":1,"method":"ping"}`}, nil},
+		{"failed handshake", []string{failedInitializeRequest}, nil},
+		{"repeated initialize", []string{initializeRequest, initializeRequest}, []string{"start client 2025-06-18", "end"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := NewServerBuilder("test", "1.0.0")
+			hooks := newHookRecorder(builder)
+
+			var out strings.Builder
+			input := strings.NewReader(strings.Join(tt.input, "\n") + "\n")
+			if err := builder.BuildStdioServer().serve(input, &out); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			hooks.check(t, tt.want...)
+		})
+	}
+}
+
+func TestSessionLifecycleOnWebSocket(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		want     []string
+	}{
+		{"initialized", []string{initializeRequest}, []string{"start client 2025-06-18", "end"}},
+		{"never initialized", []string{`{"jsonrpc":"2.0","id":1,"method":"ping"}`}, nil},
+		{"failed handshake", []string{failedInitializeRequest}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := NewServerBuilder("test", "1.0.0")
+			hooks := newHookRecorder(builder)
+
+			srv := builder.BuildHTTPServer().WithWebSocket("", WebSocketConfig{})
+			ts := httptest.NewServer(srv.Handler())
+			defer ts.Close()
+
+			client := dialWebSocket(t, ts, DefaultWebSocketEndpoint, false)
+			for _, message := range tt.messages {
+				client.call(t, message)
+			}
+
+			// no hook before the handshake has been answered
+			if len(tt.want) == 0 {
+				hooks.check(t)
+			}
+
+			client.send(websocket.OpClose, []byte{0x03, 0xe8})
+			client.next(t)
+
+			if len(tt.want) > 0 {
+				hooks.waitEnded(t)
+			} else {
+				srv.Shutdown(context.Background())
+			}
+			hooks.check(t, tt.want...)
+		})
+	}
+}
+
+func TestSessionLifecycleOnHTTP(t *testing.T) {
+	builder := NewServerBuilder("test", "1.0.0")
+	hooks := newHookRecorder(builder)
+	h := builder.BuildHTTPServer().Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newTestRequest(http.MethodPost, "/mcp", failedInitializeRequest))
+	hooks.check(t)
+
+	sessionID := initializeSession(t, h, spec.ProtocolVersion20250618)
+	hooks.check(t, "start test 2025-06-18")
+
+	req := newTestRequest(http.MethodDelete, "/mcp", "")
+	req.Header.Set(headerSessionID, sessionID)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d, body = %s", rec.Code, rec.Body)
+	}
+	hooks.check(t, "start test 2025-06-18", "end")
+}
+
+func TestSessionLifecycleOnLegacySSE(t *testing.T) {
+	tests := []struct {
+		name       string
+		initialize bool
+		want       []string
+	}{
+		{"initialized", true, []string{"start client 2025-06-18", "end"}},
+		{"never initialized", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := NewServerBuilder("test", "1.0.0")
+			hooks := newHookRecorder(builder)
+
+			srv := builder.BuildHTTPServer().WithLegacySSE("", "")
+			ts := httptest.NewServer(srv.Handler())
+			defer ts.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+DefaultSSEEndpoint, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("failed to open the legacy stream: %v", err)
+			}
+			defer resp.Body.Close()
+
+			scanner := bufio.NewScanner(resp.Body)
+			var endpoint string
+			for endpoint == "" && scanner.Scan() {
+				if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+					endpoint = data
+				}
+			}
+			if _, err := url.Parse(endpoint); err != nil || endpoint == "" {
+				t.Fatalf("endpoint event = %q", endpoint)
+			}
+
+			if tt.initialize {
+				post, err := http.Post(ts.URL+endpoint, "application/json", strings.NewReader(initializeRequest))
+				if err != nil {
+					t.Fatalf("failed to post initialize: %v", err)
+				}
+				post.Body.Close()
+
+				// the response arrives over the stream once the session has started
+				for scanner.Scan() && !strings.HasPrefix(scanner.Text(), "data: {") {
+				}
+			}
+
+			cancel()
+			if tt.initialize {
+				hooks.waitEnded(t)
+			} else {
+				srv.Shutdown(context.Background())
+			}
+			hooks.check(t, tt.want...)
+		})
+	}
+}
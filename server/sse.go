@@ -0,0 +1,283 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// DefaultSSEEndpoint and DefaultMessageEndpoint are the paths
+// of the legacy HTTP+SSE transport, see WithLegacySSE
+const (
+	DefaultSSEEndpoint     = "/sse"
+	DefaultMessageEndpoint = "/message"
+)
+
+// queryParamSessionID identifies the session of a message posted to the legacy transport
+const queryParamSessionID = "sessionId"
+
+// legacyStream is the SSE stream of a legacy session.
+// Unlike with Streamable HTTP, responses are not written to the POST request
+// that carried the message, but delivered over the stream
+type legacyStream struct {
+	messages chan []byte
+	done     chan struct{}
+}
+
+// WithLegacySSE enables the HTTP+SSE transport of protocol version 2024-11-05
+// for clients that don't support Streamable HTTP yet.
+// A client opens an SSE stream with a GET request to ssePath and receives an endpoint event
+// with the URL to POST its messages to. Responses are delivered over the stream.
+//
+// Both transports share the tools of the server and are served by Serve and ListenAndServeAddr
+// at their own paths. Sessions are bound to the transport that started them,
+// the id of a legacy session is not accepted in the Mcp-Session-Id header.
+// Empty paths fall back to DefaultSSEEndpoint and DefaultMessageEndpoint
+func (s *HTTPServer) WithLegacySSE(ssePath, messagePath string) *HTTPServer {
+	s.sseEndpoint = withLeadingSlash(ssePath, DefaultSSEEndpoint)
+	s.messageEndpoint = withLeadingSlash(messagePath, DefaultMessageEndpoint)
+	return s
+}
+
+// LegacySSEHandler returns the handler of the SSE stream of the legacy transport,
+// so that it can be mounted on any router:
+//
+//	mux.Handle("/sse", srv.LegacySSEHandler())
+//
+// The endpoint event points the client to the message path configured with WithLegacySSE
+func (s *HTTPServer) LegacySSEHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.serveGuarded(w, req, func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET, OPTIONS")
+				writeHTTPError(w, http.StatusMethodNotAllowed, newMessageError(nil, spec.ErrorCodeInvalidRequest, fmt.Sprintf("method not allowed: %s", req.Method)))
+				return
+			}
+
+			s.legacyStreamHandler(w, req)
+		})
+	})
+}
+
+// LegacyMessageHandler returns the handler accepting the messages of the legacy transport
+func (s *HTTPServer) LegacyMessageHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.serveGuarded(w, req, func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodPost {
+				w.Header().Set("Allow", "POST, OPTIONS")
+				writeHTTPError(w, http.StatusMethodNotAllowed, newMessageError(nil, spec.ErrorCodeInvalidRequest, fmt.Sprintf("method not allowed: %s", req.Method)))
+				return
+			}
+
+			s.legacyMessageHandler(w, req)
+		})
+	})
+}
+
+// legacyStreamHandler starts a session and streams its responses
+// and notifications until the client disconnects
+func (s *HTTPServer) legacyStreamHandler(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeHTTPError(w, http.StatusInternalServerError, newMessageError(nil, spec.ErrorCodeInternalError, "streaming is not supported"))
+		return
+	}
+
+	sess := session.New(session.NewID())
+	sess.SetPrincipal(principal(req))
+
+	stream := &legacyStream{
+		messages: make(chan []byte, session.DefaultNotificationBuffer),
+		done:     make(chan struct{}),
+	}
+
+	s.sessionsMu.Lock()
+	s.sessions[sess.ID()] = sess
+	s.legacyStreams[sess.ID()] = stream
+	s.sessionsMu.Unlock()
+
+	defer s.trackStream(metricsStreamLegacy)()
+
+	defer func() {
+		close(stream.done)
+
+		s.sessionsMu.Lock()
+		_, ok := s.sessions[sess.ID()]
+		delete(s.sessions, sess.ID())
+		delete(s.legacyStreams, sess.ID())
+		s.sessionsMu.Unlock()
+
+		// a shutdown or the janitor may have ended the session already
+		if ok {
+			s.endSession(sess)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	endpoint := s.messageEndpoint + "?" + url.Values{queryParamSessionID: {sess.ID()}}.Encode()
+	if err := writeSSEEvent(w, "", "endpoint", []byte(endpoint)); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-sess.Done():
+			return
+		case <-s.shutdownCh:
+			return
+		case message := <-stream.messages:
+			if err := writeSSEEvent(w, "", "message", message); err != nil {
+				return
+			}
+		case notification := <-sess.Notifications():
+			data, err := json.Marshal(notification)
+			if err != nil {
+				continue
+			}
+
+			if err := writeSSEEvent(w, "", "message", data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+		sess.Touch()
+	}
+}
+
+// legacyMessageHandler accepts a message of a legacy session with 202 Accepted.
+// Requests are served in the background and answered over the SSE stream of the session
+func (s *HTTPServer) legacyMessageHandler(w http.ResponseWriter, req *http.Request) {
+	sess, stream, status, err := s.lookupLegacySession(req)
+	if err != nil {
+		writeHTTPError(w, status, newMessageError(nil, spec.ErrorCodeInvalidRequest, err.Error()))
+		return
+	}
+
+	body, ok := s.readBody(w, req)
+	if !ok {
+		return
+	}
+
+	// the response outlives the POST request, but keeps the values of its context
+	ctx := context.WithoutCancel(req.Context())
+
+	if isBatch(body) {
+		s.serveLegacy(w, stream, func() []byte {
+			return s.serveBatch(ctx, sess, body)
+		})
+		return
+	}
+
+	msg, msgErr := decodeMessage(body)
+	if msgErr != nil {
+		writeHTTPError(w, http.StatusBadRequest, msgErr)
+		return
+	}
+
+	rpcReq := msg.req
+	switch msg.kind {
+	case kindResponse:
+		w.WriteHeader(http.StatusAccepted)
+		return
+	case kindNotification:
+		s.serveNotification(ctx, sess, &rpcReq)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	s.serveLegacy(w, stream, func() []byte {
+		var buf bytes.Buffer
+		s.serveRequest(ctx, sess, &buf, &rpcReq)
+
+		if rpcReq.Method == spec.MethodInitialize && sess.Initialized() {
+			s.startSession(sess)
+		}
+
+		return buf.Bytes()
+	})
+}
+
+// serveLegacy accepts the message and runs serve in the background,
+// its output is delivered over the stream.
+// The background work delays a shutdown like any other request in progress
+func (s *HTTPServer) serveLegacy(w http.ResponseWriter, stream *legacyStream, serve func() []byte) {
+	if !s.active.acquire() {
+		writeHTTPError(w, http.StatusServiceUnavailable, newMessageError(nil, spec.ErrorCodeInternalError, "server is shutting down"))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	go func() {
+		defer s.active.release()
+		stream.send(serve())
+	}()
+}
+
+// lookupLegacySession returns the session referenced by the sessionId query parameter
+func (s *HTTPServer) lookupLegacySession(req *http.Request) (*session.Session, *legacyStream, int, error) {
+	sessionID := req.URL.Query().Get(queryParamSessionID)
+	if sessionID == "" {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("missing %s query parameter", queryParamSessionID)
+	}
+
+	s.sessionsMu.RLock()
+	sess, ok := s.sessions[sessionID]
+	stream := s.legacyStreams[sessionID]
+	s.sessionsMu.RUnlock()
+	if !ok || stream == nil || sess.Principal() != principal(req) {
+		return nil, nil, http.StatusNotFound, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	return sess, stream, http.StatusOK, nil
+}
+
+// send queues an encoded message for the stream.
+// Empty messages, e.g. of cancelled requests, are dropped,
+// as are all messages once the stream has ended
+func (ls *legacyStream) send(message []byte) {
+	message = bytes.TrimSpace(message)
+	if len(message) == 0 {
+		return
+	}
+
+	select {
+	case ls.messages <- message:
+	case <-ls.done:
+	}
+}
+
+func withLeadingSlash(path, fallback string) string {
+	if path == "" {
+		return fallback
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+
+	return path
+}
@@ -1,11 +1,18 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	stdio "io"
 	"os"
+	"sync"
 
 	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/session"
 	"github.com/makarski/mcp-robot/spec"
 )
 
@@ -16,34 +23,142 @@ type StdioServer struct {
 func (s *StdioServer) ListenAndServe() error {
 	// fmt.Println("stared stdio server")
 
-	w := os.Stdout
-	decoder := json.NewDecoder(os.Stdin)
+	return s.serve(os.Stdin, os.Stdout)
+}
+
+// serve reads messages from r and writes the responses to out until r is exhausted
+func (s *StdioServer) serve(r stdio.Reader, out stdio.Writer) error {
+	w := &lockedWriter{w: out}
+
+	// messages are delimited by newlines, a malformed line
+	// is answered with an error and doesn't affect the following ones
+	reader := bufio.NewReader(r)
+
+	// stdio serves a single client for the lifetime of the process,
+	// the session starts once the client has initialized it
+	sess := session.New(session.NewID())
+	defer s.endSession(sess)
+
+	go forwardNotifications(sess, w)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx := context.Background()
 	for {
-		var rpcReq spec.Request[int]
-		if err := decoder.Decode(&rpcReq); err != nil {
-			if err.Error() == "EOF" {
-				// fmt.Println("EOF reached, exiting")
-				return nil
-			}
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, stdio.EOF) {
+			return fmt.Errorf("failed to read from stdin: %w", err)
+		}
 
-			rw := io.NewResponseWriter(w, 0)
-			rw.WriteError(spec.ErrorCodeParseError, fmt.Sprintf("Failed to decode request: %s", err))
-			continue
+		raw := bytes.TrimSpace(line)
+		if len(raw) > 0 {
+			s.serveMessage(ctx, sess, w, raw, &wg)
 		}
 
-		rw := io.NewResponseWriter(w, rpcReq.ID)
-		handler, err := s.resolveHandler(rpcReq)
 		if err != nil {
-			errCode := spec.ErrorCodeInternalError
-			pe, ok := err.(*spec.ProtocolError)
-			if ok {
-				errCode = pe.Code
+			// fmt.Println("EOF reached, exiting")
+			return nil
+		}
+	}
+}
+
+// serveMessage serves a message or batch read from a connection
+// of a single client, like a line of stdin or a WebSocket message.
+// Requests other than initialize are served in the background, tracked by wg
+func (s *server) serveMessage(ctx context.Context, sess *session.Session, w io.RPCResponseWriter, raw []byte, wg *sync.WaitGroup) {
+	if isBatch(raw) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if response := s.serveBatch(ctx, sess, raw); response != nil {
+				w.Write(response)
 			}
+		}()
+		return
+	}
+
+	msg, msgErr := decodeMessage(raw)
+	if msgErr != nil {
+		msgErr.writeTo(w)
+		return
+	}
+
+	rpcReq := msg.req
+	switch msg.kind {
+	case kindResponse:
+		return
+	case kindNotification:
+		s.serveNotification(ctx, sess, &rpcReq)
+		return
+	}
 
-			rw.WriteError(errCode, fmt.Sprintf("Failed to resolve handler: %s", err))
-			continue
+	// the handshake completes before any further message is read,
+	// other requests are served concurrently
+	if rpcReq.Method == spec.MethodInitialize {
+		initialized := sess.Initialized()
+		s.serveRequest(ctx, sess, w, &rpcReq)
+
+		// like on HTTP, the session starts with a successful handshake
+		if !initialized && sess.Initialized() {
+			s.startSession(sess)
 		}
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.serveRequest(ctx, sess, w, &rpcReq)
+	}()
+}
+
+// forwardNotifications writes the queued session notifications
+// to the client until the session is closed
+func forwardNotifications(sess *session.Session, w io.RPCResponseWriter) {
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-sess.Done():
+			return
+		case notification := <-sess.Notifications():
+			encoder.Encode(notification)
+		}
+	}
+}
+
+// lockedWriter serializes writes of concurrently served requests,
+// so that every encoded message reaches the client in one piece
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.RPCResponseWriter
+}
+
+func (lw *lockedWriter) Write(b []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(b)
+}
+
+// WriteResultStream holds the lock while the response is written in chunks,
+// so that it isn't interleaved with other messages
+func (lw *lockedWriter) WriteResultStream(write func(w stdio.Writer) error) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	cw := io.NewChunkWriter(func(chunk []byte) error {
+		_, err := lw.w.Write(chunk)
+		return err
+	})
+
+	err := write(cw)
+	if err == nil {
+		err = cw.Flush()
+	}
 
-		handler.ServeRPC(w, &rpcReq)
+	if err != nil && cw.Started {
+		// the broken line is terminated, so that the following messages can be read
+		lw.w.Write([]byte("\n"))
 	}
+	return cw.StreamError(err)
 }
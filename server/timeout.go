@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+	"github.com/makarski/mcp-robot/tools"
+)
+
+// metaDeadline is the key of the _meta request parameter carrying
+// the RFC 3339 time by which the client expects the response.
+// It is an extension of this server, not part of any MCP version:
+// other servers ignore it, and clients shouldn't rely on it to bound their calls
+const metaDeadline = "deadline"
+
+// toolContext bounds the execution of a tool call by the tool timeout,
+// or the server default, and the deadline supplied by the client, whichever is earlier
+func (s *server) toolContext(ctx context.Context, definition tools.ToolDefinition, deadline time.Time) (context.Context, context.CancelFunc) {
+	timeout := definition.Timeout
+	if timeout == 0 {
+		s.mu.RLock()
+		timeout = s.toolTimeout
+		s.mu.RUnlock()
+	}
+
+	if timeout > 0 {
+		if toolDeadline := time.Now().Add(timeout); deadline.IsZero() || toolDeadline.Before(deadline) {
+			deadline = toolDeadline
+		}
+	}
+
+	if deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadlineCause(ctx, deadline, tools.ErrTimeout)
+}
+
+// logTimeout records a tool call that ran into its timeout.
+// The call has been answered with an error result and is no longer in flight,
+// even if the tool function hasn't returned yet
+func (s *server) logTimeout(ctx context.Context, definition tools.ToolDefinition, id any) {
+	if !errors.Is(context.Cause(ctx), tools.ErrTimeout) {
+		return
+	}
+
+	s.mu.RLock()
+	logger := s.logger
+	s.mu.RUnlock()
+
+	attrs := []any{"tool", definition.Name, "request", id}
+	if sess, ok := session.FromContext(ctx); ok {
+		attrs = append(attrs, "session", sess.ID())
+	}
+
+	logger.WarnContext(ctx, "tool call timed out", attrs...)
+}
+
+// clientDeadline returns the deadline of the _meta request parameter, zero if there is none.
+// See metaDeadline
+func clientDeadline(params map[string]any) (time.Time, error) {
+	meta, ok := params["_meta"].(map[string]any)
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	value, ok := meta[metaDeadline]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return time.Time{}, spec.NewProtocolError(
+			spec.ErrorCodeInvalidParams,
+			fmt.Sprintf("invalid '_meta.%s' parameter type: expected string, got %T", metaDeadline, value),
+		)
+	}
+
+	deadline, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		return time.Time{}, spec.NewProtocolError(
+			spec.ErrorCodeInvalidParams,
+			fmt.Sprintf("invalid '_meta.%s' parameter: expected an RFC 3339 time: %s", metaDeadline, err),
+		)
+	}
+
+	return deadline, nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/makarski/mcp-robot/ratelimit"
+	"github.com/makarski/mcp-robot/spec"
+	"github.com/makarski/mcp-robot/tools"
+)
+
+func TestClientDeadline(t *testing.T) {
+	deadline := time.Date(2025, 1, 1, 12, 0, 0, 500_000_000, time.UTC)
+
+	tests := []struct {
+		name    string
+		params  map[string]any
+		want    time.Time
+		wantErr bool
+	}{
+		{"no meta", map[string]any{"name": "lookup"}, time.Time{}, false},
+		{"no deadline", map[string]any{"_meta": map[string]any{"progressToken": "t"}}, time.Time{}, false},
+		{"deadline", map[string]any{"_meta": map[string]any{metaDeadline: "2025-01-01T12:00:00.5Z"}}, deadline, false},
+		{"not a string", map[string]any{"_meta": map[string]any{metaDeadline: 1735732800}}, time.Time{}, true},
+		{"not a time", map[string]any{"_meta": map[string]any{metaDeadline: "tomorrow"}}, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clientDeadline(tt.params)
+			if tt.wantErr {
+				var pe *spec.ProtocolError
+				if !errors.As(err, &pe) || pe.Code != spec.ErrorCodeInvalidParams {
+					t.Fatalf("err = %v, want an invalid params error", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("deadline = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolContextUsesEarlierDeadline(t *testing.T) {
+	s := NewServerBuilder("test", "1.0.0").ToolTimeout(time.Hour)
+
+	tests := []struct {
+		name       string
+		definition tools.ToolDefinition
+		client     time.Duration
+		want       time.Duration
+	}{
+		{"server default", tools.ToolDefinition{}, 0, time.Hour},
+		{"tool timeout", tools.ToolDefinition{Timeout: time.Minute}, 0, time.Minute},
+		{"earlier client deadline", tools.ToolDefinition{Timeout: time.Minute}, time.Second, time.Second},
+		{"later client deadline", tools.ToolDefinition{Timeout: time.Minute}, 2 * time.Hour, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var clientDeadline time.Time
+			if tt.client > 0 {
+				clientDeadline = time.Now().Add(tt.client)
+			}
+
+			ctx, cancel := s.toolContext(context.Background(), tt.definition, clientDeadline)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Fatal("want a deadline")
+			}
+			if remaining := time.Until(deadline); remaining > tt.want || remaining < tt.want-time.Second {
+				t.Errorf("remaining = %v, want %v", remaining, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimedOutCallKeepsPermitsUntilTheToolReturns(t *testing.T) {
+	unblock := make(chan struct{})
+	slow := tools.NewTool("slow").
+		Description("Ignores its context").
+		Timeout(20 * time.Millisecond).
+		RateLimit(ratelimit.Limit{MaxConcurrent: 1}).
+		Build()
+
+	srv := NewServerBuilder("test", "1.0.0").
+		WithTool(slow, tools.ToolFunc[tools.ToolResultText](func(map[string]any) (tools.ToolResultText, error) {
+			<-unblock
+			return tools.NewToolResultText("done"), nil
+		}))
+	sess := newBatchSession(spec.ProtocolVersion20250618)
+
+	call := func() map[string]any {
+		var buf bytes.Buffer
+		srv.serveRequest(context.Background(), sess, &buf, &spec.Request[int]{
+			Jsonrpc: spec.JsonRPC,
+			ID:      1,
+			Method:  spec.MethodToolsCall,
+			Params:  map[string]any{"name": "slow"},
+		})
+
+		var response map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &response); err != nil {
+			t.Fatalf("invalid response %q: %v", buf.Bytes(), err)
+		}
+		return response
+	}
+
+	if result, _ := call()["result"].(map[string]any); result["isError"] != true {
+		t.Fatalf("result = %v, want a timeout error result", result)
+	}
+
+	// the timed out function still runs and holds the only slot
+	response := call()
+	if e, _ := response["error"].(map[string]any); e["code"] != float64(spec.ErrorCodeRateLimited) {
+		t.Fatalf("response = %v, want the call rate limited", response)
+	}
+
+	close(unblock)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		response := call()
+		if result, _ := response["result"].(map[string]any); result != nil && result["isError"] != true {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("response = %v, want the slot released once the function returned", response)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	stdio "io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/makarski/mcp-robot/internal/websocket"
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/session"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// WebSocketSubprotocol is the subprotocol negotiated by the WebSocket transport
+const WebSocketSubprotocol = "mcp"
+
+// Defaults of the WebSocket transport, see WebSocketConfig
+const (
+	DefaultWebSocketEndpoint       = "/ws"
+	DefaultWebSocketMaxMessageSize = 4 << 20
+	DefaultWebSocketPingInterval   = 30 * time.Second
+	DefaultWebSocketPongTimeout    = 10 * time.Second
+	DefaultWebSocketWriteTimeout   = 10 * time.Second
+)
+
+type (
+	// WebSocketConfig configures the WebSocket transport.
+	// Zero values fall back to the defaults
+	WebSocketConfig struct {
+		// MaxMessageSize is the largest message accepted from a client,
+		// bigger messages close the connection with 1009
+		MaxMessageSize int64
+		// PingInterval is the interval of the pings keeping the connection alive
+		PingInterval time.Duration
+		// PongTimeout is how long the client may take to answer a ping
+		// before the connection is considered dead
+		PongTimeout time.Duration
+		// WriteTimeout bounds every write to the client
+		WriteTimeout time.Duration
+	}
+
+	// websocketWriter sends every response as a text message
+	websocketWriter struct {
+		conn *websocket.Conn
+	}
+)
+
+// WithWebSocket enables the WebSocket transport at path, served by Serve and ListenAndServeAddr
+// alongside Streamable HTTP. Every connection is a session of its own, messages are
+// JSON-RPC messages or batches sent as text. The origin and authorization checks
+// of the HTTP transport apply to the opening handshake.
+// An empty path falls back to DefaultWebSocketEndpoint
+func (s *HTTPServer) WithWebSocket(path string, config WebSocketConfig) *HTTPServer {
+	s.websocketEndpoint = withLeadingSlash(path, DefaultWebSocketEndpoint)
+	s.websocketConfig = config
+	return s
+}
+
+// WebSocketHandler returns the handler of the WebSocket transport,
+// so that it can be mounted on any router:
+//
+//	mux.Handle("/ws", srv.WebSocketHandler())
+func (s *HTTPServer) WebSocketHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.serveGuarded(w, req, s.websocketHandler)
+	})
+}
+
+// websocketHandler upgrades the connection and serves its messages
+// until the client closes it, the session ends or the server shuts down
+func (s *HTTPServer) websocketHandler(w http.ResponseWriter, req *http.Request) {
+	config := s.websocketConfig.withDefaults()
+
+	conn, err := websocket.Upgrade(w, req, WebSocketSubprotocol, config.WriteTimeout)
+	if err != nil {
+		var handshakeErr *websocket.HandshakeError
+		if errors.As(err, &handshakeErr) {
+			writeHTTPError(w, handshakeErr.Status, newMessageError(nil, spec.ErrorCodeInvalidRequest, handshakeErr.Message))
+		}
+		return
+	}
+	defer conn.Close()
+
+	conn.MaxMessageSize = config.MaxMessageSize
+
+	// the session starts once the client has initialized it, see serveMessage
+	sess := session.New(session.NewID())
+	sess.SetPrincipal(principal(req))
+
+	// a pong proves the client alive while it has nothing to send
+	readTimeout := config.PingInterval + config.PongTimeout
+	conn.OnPong = func([]byte) {
+		sess.Touch()
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+	}
+
+	ww := &websocketWriter{conn: conn}
+	go forwardNotifications(sess, ww)
+
+	messages := make(chan []byte)
+	readErr := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		for {
+			conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+			opcode, message, err := conn.ReadMessage()
+			if err == nil && opcode != websocket.OpText {
+				err = &websocket.CloseError{Code: websocket.CloseUnsupportedData, Reason: "only text messages are supported"}
+			}
+
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			select {
+			case messages <- message:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(config.PingInterval)
+	defer ping.Stop()
+
+	var (
+		wg          sync.WaitGroup
+		ctx         = req.Context()
+		code        = websocket.CloseNormalClosure
+		reason      string
+		shutdown    bool
+		pingFailure error
+	)
+
+loop:
+	for {
+		select {
+		case message := <-messages:
+			sess.Touch()
+			s.serveMessage(ctx, sess, ww, bytes.TrimSpace(message), &wg)
+		case err := <-readErr:
+			code, reason = websocketCloseCode(err)
+			break loop
+		case <-ping.C:
+			if pingFailure = conn.WritePing(nil); pingFailure != nil {
+				break loop
+			}
+		case <-sess.Done():
+			reason = "session closed"
+			break loop
+		case <-s.shutdownCh:
+			code, reason, shutdown = websocket.CloseGoingAway, "server is shutting down", true
+			break loop
+		}
+	}
+
+	if shutdown {
+		// like HTTP requests, in-flight requests are drained during a shutdown
+		wg.Wait()
+		s.endSession(sess)
+	} else {
+		// the client is gone, its requests are cancelled
+		s.endSession(sess)
+		wg.Wait()
+	}
+
+	if pingFailure == nil {
+		conn.WriteClose(code, reason)
+	}
+}
+
+func (c WebSocketConfig) withDefaults() WebSocketConfig {
+	if c.MaxMessageSize <= 0 {
+		c.MaxMessageSize = DefaultWebSocketMaxMessageSize
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = DefaultWebSocketPingInterval
+	}
+	if c.PongTimeout <= 0 {
+		c.PongTimeout = DefaultWebSocketPongTimeout
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = DefaultWebSocketWriteTimeout
+	}
+	return c
+}
+
+func (ww *websocketWriter) Write(b []byte) (int, error) {
+	if err := ww.conn.WriteMessage(websocket.OpText, bytes.TrimRight(b, "\n")); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// WriteResultStream sends the response as a fragmented text message
+func (ww *websocketWriter) WriteResultStream(write func(w stdio.Writer) error) error {
+	return ww.conn.WriteFragmented(websocket.OpText, func(send func([]byte) error) ([]byte, error) {
+		cw := io.NewChunkWriter(send)
+		if err := write(cw); err != nil {
+			return nil, cw.StreamError(err)
+		}
+		return bytes.TrimRight(cw.Rest(), "\n"), nil
+	})
+}
+
+// websocketCloseCode maps the error ending the read loop to the code of the close frame
+func websocketCloseCode(err error) (int, string) {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		if closeErr.Remote {
+			// the closing handshake is completed with the code of the client
+			if closeErr.Code == websocket.CloseNoStatusReceived {
+				return websocket.CloseNormalClosure, ""
+			}
+			return closeErr.Code, ""
+		}
+		return closeErr.Code, closeErr.Reason
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return websocket.CloseGoingAway, "ping timeout"
+	}
+
+	return websocket.CloseInternalError, "read failed"
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	stdio "io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/makarski/mcp-robot/internal/websocket"
+)
+
+type (
+	// wsClient is a minimal WebSocket client answering pings unless told otherwise
+	wsClient struct {
+		conn    net.Conn
+		writeMu sync.Mutex
+		frames  chan wsFrame
+		pings   atomic.Int32
+
+		ignorePings bool
+	}
+
+	wsFrame struct {
+		opcode  int
+		payload []byte
+	}
+)
+
+// dialWebSocket opens a WebSocket connection to the server at path
+func dialWebSocket(t *testing.T, ts *httptest.Server, path string, ignorePings bool) *wsClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Protocol", WebSocketSubprotocol)
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("failed to write the handshake: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake failed: %v %v", resp, err)
+	}
+
+	client := &wsClient{conn: conn, frames: make(chan wsFrame, 16), ignorePings: ignorePings}
+	go client.read(br)
+
+	return client
+}
+
+func (c *wsClient) read(br *bufio.Reader) {
+	defer close(c.frames)
+
+	for {
+		var header [2]byte
+		if _, err := stdio.ReadFull(br, header[:]); err != nil {
+			return
+		}
+
+		length := uint64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := stdio.ReadFull(br, ext[:]); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := stdio.ReadFull(br, ext[:]); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+
+		payload := make([]byte, length)
+		if _, err := stdio.ReadFull(br, payload); err != nil {
+			return
+		}
+
+		opcode := int(header[0] & 0x0F)
+		if opcode == websocket.OpPing {
+			c.pings.Add(1)
+			if !c.ignorePings {
+				c.send(websocket.OpPong, payload)
+			}
+			continue
+		}
+
+		c.frames <- wsFrame{opcode: opcode, payload: payload}
+	}
+}
+
+// send writes a single masked frame
+func (c *wsClient) send(opcode int, payload []byte) {
+	frame := []byte{0x80 | byte(opcode), 0x80}
+	switch length := len(payload); {
+	case length <= 125:
+		frame[1] |= byte(length)
+	case length <= 0xFFFF:
+		frame[1] |= 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame[1] |= 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	mask := [4]byte{1, 2, 3, 4}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.Write(frame)
+}
+
+func (c *wsClient) next(t *testing.T) wsFrame {
+	t.Helper()
+
+	select {
+	case f, ok := <-c.frames:
+		if !ok {
+			t.Fatal("connection closed")
+		}
+		return f
+	case <-time.After(2 * time.Second):
+		t.Fatal("no frame received")
+	}
+	return wsFrame{}
+}
+
+// call sends a request and returns the response
+func (c *wsClient) call(t *testing.T, request string) map[string]any {
+	t.Helper()
+
+	c.send(websocket.OpText, []byte(request))
+
+	f := c.next(t)
+	if f.opcode != websocket.OpText {
+		t.Fatalf("frame = %d %q, want a text message", f.opcode, f.payload)
+	}
+
+	var response map[string]any
+	if err := json.Unmarshal(f.payload, &response); err != nil {
+		t.Fatalf("invalid response %q: %v", f.payload, err)
+	}
+	return response
+}
+
+func newWebSocketServer(t *testing.T, config WebSocketConfig) *httptest.Server {
+	t.Helper()
+
+	srv := NewServerBuilder("test", "1.0.0").BuildHTTPServer().WithWebSocket("", config)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestWebSocketKeepsIdleClientAlive(t *testing.T) {
+	config := WebSocketConfig{PingInterval: 20 * time.Millisecond, PongTimeout: 20 * time.Millisecond}
+	client := dialWebSocket(t, newWebSocketServer(t, config), DefaultWebSocketEndpoint, false)
+
+	// idle for several times PingInterval+PongTimeout, only answering pings
+	time.Sleep(200 * time.Millisecond)
+
+	if pings := client.pings.Load(); pings < 3 {
+		t.Errorf("pings = %d, want the connection kept alive with pings", pings)
+	}
+
+	response := client.call(t, `{"jsonrpc":"2.0","id":7,"method":"ping"}`)
+	if response["id"] != float64(7) || response["result"] == nil {
+		t.Errorf("response = %v, want the result of the ping", response)
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	tests := []struct {
+		name        string
+		ignorePings bool
+		opcode      int
+		payload     []byte
+		code        int
+		reason      string
+	}{
+		{"missing pongs", true, 0, nil, websocket.CloseGoingAway, "ping timeout"},
+		{"binary message", false, websocket.OpBinary, []byte{0, 1}, websocket.CloseUnsupportedData, "only text messages are supported"},
+		{"oversize message", false, websocket.OpText, bytes.Repeat([]byte(" "), 65), websocket.CloseMessageTooBig, "message too big"},
+		{"client close", false, websocket.OpClose, []byte{0x03, 0xe8}, websocket.CloseNormalClosure, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := WebSocketConfig{MaxMessageSize: 64, PingInterval: 20 * time.Millisecond, PongTimeout: 20 * time.Millisecond}
+			client := dialWebSocket(t, newWebSocketServer(t, config), DefaultWebSocketEndpoint, tt.ignorePings)
+
+			if tt.opcode != 0 {
+				client.send(tt.opcode, tt.payload)
+			}
+
+			f := client.next(t)
+			if f.opcode != websocket.OpClose || len(f.payload) < 2 {
+				t.Fatalf("frame = %d %q, want a close frame", f.opcode, f.payload)
+			}
+			if code, reason := int(binary.BigEndian.Uint16(f.payload)), string(f.payload[2:]); code != tt.code || reason != tt.reason {
+				t.Errorf("close = %d %q, want %d %q", code, reason, tt.code, tt.reason)
+			}
+		})
+	}
+}
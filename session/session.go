@@ -0,0 +1,349 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// DefaultNotificationBuffer is the number of outbound notifications
+// a session queues before Notify starts failing
+const DefaultNotificationBuffer = 64
+
+var (
+	ErrSessionClosed    = errors.New("session is closed")
+	ErrQueueFull        = errors.New("session notification queue is full")
+	ErrRequestCancelled = errors.New("request cancelled by the client")
+)
+
+type (
+	// Session holds the per-connection state of a single client.
+	// Stdio servers create one session per process, HTTP servers
+	// create one per Mcp-Session-Id
+	Session struct {
+		id string
+
+		mu                 sync.RWMutex
+		initialized        bool
+		ready              bool
+		protocolVersion    string
+		clientInfo         spec.Info
+		clientCapabilities spec.ClientCapabilities
+		principal          string
+		logLevel           string
+		subscriptions      map[string]struct{}
+		roots              []spec.RootCapability
+		rootsValid         bool
+		inFlight           map[any]context.CancelFunc
+		lastActive         time.Time
+
+		notifications chan spec.Notification
+		done          chan struct{}
+		closeOnce     sync.Once
+	}
+
+	contextKey struct{}
+)
+
+// New creates an uninitialized session with the given id
+func New(id string) *Session {
+	return &Session{
+		id:            id,
+		subscriptions: make(map[string]struct{}),
+		inFlight:      make(map[any]context.CancelFunc),
+		lastActive:    time.Now(),
+		notifications: make(chan spec.Notification, DefaultNotificationBuffer),
+		done:          make(chan struct{}),
+	}
+}
+
+// NewID generates a cryptographically random session id
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("session: failed to read random bytes: " + err.Error())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// NewContext returns a copy of ctx carrying the session
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the session stored in ctx, if any
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(contextKey{}).(*Session)
+	return s, ok
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Initialize records the outcome of the initialize handshake
+func (s *Session) Initialize(protocolVersion string, clientInfo spec.Info, capabilities spec.ClientCapabilities) {
+	s.mu.Lock()
+	s.initialized = true
+	s.protocolVersion = protocolVersion
+	s.clientInfo = clientInfo
+	s.clientCapabilities = capabilities
+	s.mu.Unlock()
+}
+
+// Initialized reports whether the initialize request has been answered
+func (s *Session) Initialized() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.initialized
+}
+
+// MarkReady records that the client has sent notifications/initialized
+func (s *Session) MarkReady() {
+	s.mu.Lock()
+	s.ready = true
+	s.mu.Unlock()
+}
+
+// Ready reports whether the client has confirmed the end of initialization
+func (s *Session) Ready() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ready
+}
+
+// ProtocolVersion returns the negotiated protocol version.
+// Before initialization it falls back to the latest supported version
+func (s *Session) ProtocolVersion() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.protocolVersion == "" {
+		return spec.ProtocolVersion
+	}
+	return s.protocolVersion
+}
+
+func (s *Session) ClientInfo() spec.Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientInfo
+}
+
+func (s *Session) ClientCapabilities() spec.ClientCapabilities {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientCapabilities
+}
+
+// Features returns the feature switches of the negotiated protocol version
+func (s *Session) Features() spec.ProtocolFeatures {
+	return spec.FeaturesFor(s.ProtocolVersion())
+}
+
+// FeaturesFromContext returns the protocol features of the session stored in ctx.
+// Without a session the features of the latest protocol version are returned
+func FeaturesFromContext(ctx context.Context) spec.ProtocolFeatures {
+	if s, ok := FromContext(ctx); ok {
+		return s.Features()
+	}
+
+	return spec.FeaturesFor(spec.ProtocolVersion)
+}
+
+// Principal returns the authenticated subject the session is bound to.
+// It is empty for servers without authorization
+func (s *Session) Principal() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.principal
+}
+
+// SetPrincipal binds the session to an authenticated subject
+func (s *Session) SetPrincipal(subject string) {
+	s.mu.Lock()
+	s.principal = subject
+	s.mu.Unlock()
+}
+
+// LogLevel returns the minimum log level requested by the client.
+// An empty string means the client has not set a level
+func (s *Session) LogLevel() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.logLevel
+}
+
+func (s *Session) SetLogLevel(level string) {
+	s.mu.Lock()
+	s.logLevel = level
+	s.mu.Unlock()
+}
+
+// Subscribe registers the client's interest in updates of the resource uri
+func (s *Session) Subscribe(uri string) {
+	s.mu.Lock()
+	s.subscriptions[uri] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *Session) Unsubscribe(uri string) {
+	s.mu.Lock()
+	delete(s.subscriptions, uri)
+	s.mu.Unlock()
+}
+
+func (s *Session) IsSubscribed(uri string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.subscriptions[uri]
+	return ok
+}
+
+// Subscriptions returns the subscribed resource uris in sorted order
+func (s *Session) Subscriptions() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	uris := make([]string, 0, len(s.subscriptions))
+	for uri := range s.subscriptions {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	return uris
+}
+
+// Roots returns the cached client roots.
+// The second value is false if the cache is empty or has been invalidated
+func (s *Session) Roots() ([]spec.RootCapability, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.roots, s.rootsValid
+}
+
+func (s *Session) SetRoots(roots []spec.RootCapability) {
+	s.mu.Lock()
+	s.roots = roots
+	s.rootsValid = true
+	s.mu.Unlock()
+}
+
+// InvalidateRoots marks the roots cache as stale,
+// e.g. after the client reports that its roots have changed
+func (s *Session) InvalidateRoots() {
+	s.mu.Lock()
+	s.rootsValid = false
+	s.mu.Unlock()
+}
+
+// TrackRequest registers an in-flight request together with
+// the function cancelling its context
+func (s *Session) TrackRequest(id any, cancel context.CancelFunc) {
+	s.mu.Lock()
+	s.inFlight[id] = cancel
+	s.mu.Unlock()
+}
+
+// UntrackRequest removes a finished request from the in-flight set
+func (s *Session) UntrackRequest(id any) {
+	s.mu.Lock()
+	delete(s.inFlight, id)
+	s.mu.Unlock()
+}
+
+// CancelRequest cancels the context of an in-flight request.
+// It reports whether the request was found
+func (s *Session) CancelRequest(id any) bool {
+	s.mu.Lock()
+	cancel, ok := s.inFlight[id]
+	delete(s.inFlight, id)
+	s.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// InFlight returns the number of requests currently being served
+func (s *Session) InFlight() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.inFlight)
+}
+
+// Notify queues a server-to-client notification.
+// It never blocks: ErrQueueFull is returned if the client is not draining the queue
+func (s *Session) Notify(method string, params map[string]any) error {
+	select {
+	case <-s.done:
+		return ErrSessionClosed
+	default:
+	}
+
+	notification := spec.Notification{
+		JsonRPC: spec.JsonRPC,
+		Method:  method,
+		Params:  params,
+	}
+
+	select {
+	case s.notifications <- notification:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Notifications returns the queue of outbound notifications
+// to be delivered by the transport
+func (s *Session) Notifications() <-chan spec.Notification {
+	return s.notifications
+}
+
+// PendingNotifications returns the number of queued, undelivered notifications
+func (s *Session) PendingNotifications() int {
+	return len(s.notifications)
+}
+
+// Touch records activity on the session
+func (s *Session) Touch() {
+	s.mu.Lock()
+	s.lastActive = time.Now()
+	s.mu.Unlock()
+}
+
+// IdleSince returns the time of the last recorded activity
+func (s *Session) IdleSince() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastActive
+}
+
+// Close cancels all in-flight requests and stops the delivery of notifications.
+// It is safe to call Close more than once
+func (s *Session) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		s.mu.Lock()
+		for id, cancel := range s.inFlight {
+			cancel()
+			delete(s.inFlight, id)
+		}
+		s.mu.Unlock()
+	})
+}
+
+// Done returns a channel that is closed when the session is closed
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
@@ -0,0 +1,47 @@
+package spec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// BlobEncoding is the encoding of binary data in messages:
+// standard base64 with padding, as required by the spec
+var BlobEncoding = base64.StdEncoding
+
+// Blob is binary data, like the data of images and audio or the blob of binary resources.
+// It is encoded as a base64 JSON string
+type Blob []byte
+
+// MarshalJSON encodes the blob as a base64 string
+func (b Blob) MarshalJSON() ([]byte, error) {
+	encoded := make([]byte, BlobEncoding.EncodedLen(len(b))+2)
+	encoded[0] = '"'
+	BlobEncoding.Encode(encoded[1:], b)
+	encoded[len(encoded)-1] = '"'
+	return encoded, nil
+}
+
+// UnmarshalJSON decodes a base64 string
+func (b *Blob) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("blob must be a base64 string: %w", err)
+	}
+
+	decoded, err := BlobEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("invalid base64 blob: %w", err)
+	}
+
+	*b = decoded
+	return nil
+}
+
+// NewBlobEncoder returns a writer base64 encoding the data written to it into w.
+// Close flushes the last partial block
+func NewBlobEncoder(w io.Writer) io.WriteCloser {
+	return base64.NewEncoder(BlobEncoding, w)
+}
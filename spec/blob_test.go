@@ -0,0 +1,77 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestBlobRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		blob    Blob
+		encoded string
+	}{
+		{"empty", Blob{}, `""`},
+		{"one byte padded", Blob{0xff}, `"/w=="`},
+		{"two bytes padded", Blob{0xff, 0xfe}, `"//4="`},
+		{"unpadded", Blob("abc"), `"YWJj"`},
+		{"standard alphabet", Blob{0xfb, 0xff, 0xbf}, `"+/+/"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := json.Marshal(tt.blob)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(encoded) != tt.encoded {
+				t.Errorf("Marshal = %s, want %s", encoded, tt.encoded)
+			}
+
+			var decoded Blob
+			if err := json.Unmarshal(encoded, &decoded); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(decoded, tt.blob) {
+				t.Errorf("Unmarshal = %v, want %v", decoded, tt.blob)
+			}
+		})
+	}
+}
+
+func TestBlobMatchesEncoder(t *testing.T) {
+	data := bytes.Repeat([]byte{0, 1, 2, 250, 251, 252, 253}, 1000)
+
+	var streamed bytes.Buffer
+	encoder := NewBlobEncoder(&streamed)
+	encoder.Write(data[:10])
+	encoder.Write(data[10:])
+	encoder.Close()
+
+	marshaled, _ := json.Marshal(Blob(data))
+	if `"`+streamed.String()+`"` != string(marshaled) {
+		t.Error("the streamed encoding differs from the marshaled blob")
+	}
+}
+
+func TestBlobUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"not a string", `[1,2]`},
+		{"url alphabet", `"-_-_"`},
+		{"missing padding", `"/w"`},
+		{"invalid characters", `"!!!!"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b Blob
+			if err := json.Unmarshal([]byte(tt.raw), &b); err == nil {
+				t.Errorf("Unmarshal(%s) succeeded, want an error", tt.raw)
+			}
+		})
+	}
+}
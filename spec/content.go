@@ -0,0 +1,20 @@
+package spec
+
+// Role is the sender or recipient of messages and data in a conversation
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// Annotations tell the client how to use or display content.
+// Empty values are omitted
+type Annotations struct {
+	// Audience lists who the content is intended for
+	Audience []Role `json:"audience,omitempty"`
+	// Priority is the importance of the content, from 0 (optional) to 1 (required)
+	Priority *float64 `json:"priority,omitempty"`
+	// LastModified is the time the content was last modified in ISO 8601 format
+	LastModified string `json:"lastModified,omitempty"`
+}
@@ -7,12 +7,28 @@ const (
 	ErrorCodeInternalError       = -32603
 	ErrorCodeToolNotFound        = -32000
 	ErrorCodeToolExecutionFailed = -32001
+	ErrorCodeToolForbidden       = -32003
+	ErrorCodeRateLimited         = -32004
 	ErrorCodeParseError          = -32700
 )
 
+// Error codes reserved by the MCP specification
+const (
+	// ErrorCodeResourceNotFound is returned when a requested resource does not exist
+	ErrorCodeResourceNotFound = -32002
+)
+
+// Bounds of the JSON-RPC range reserved for implementation-defined server errors
+const (
+	ErrorCodeServerErrorStart = -32099
+	ErrorCodeServerErrorEnd   = -32000
+)
+
 type ProtocolError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	// Data carries optional structured detail, e.g. the path of an invalid argument
+	Data any `json:"data,omitempty"`
 }
 
 func NewProtocolError(code int, message string) *ProtocolError {
@@ -22,6 +38,15 @@ func NewProtocolError(code int, message string) *ProtocolError {
 	}
 }
 
+// NewProtocolErrorWithData creates a protocol error carrying structured detail
+func NewProtocolErrorWithData(code int, message string, data any) *ProtocolError {
+	return &ProtocolError{
+		Code:    code,
+		Message: message,
+		Data:    data,
+	}
+}
+
 func (e *ProtocolError) Error() string {
 	return e.Message
 }
@@ -1,8 +1,28 @@
 package spec
 
+import (
+	"context"
+	"encoding/json"
+)
+
 const JsonRPC = "2.0"
 
-const ProtocolVersion = "2025-06-18"
+const (
+	ProtocolVersion20241105 = "2024-11-05"
+	ProtocolVersion20250326 = "2025-03-26"
+	ProtocolVersion20250618 = "2025-06-18"
+)
+
+// ProtocolVersion is the latest protocol version supported by the server
+const ProtocolVersion = ProtocolVersion20250618
+
+// SupportedProtocolVersions lists the protocol versions the server
+// is able to negotiate, ordered from the newest to the oldest
+var SupportedProtocolVersions = []string{
+	ProtocolVersion20250618,
+	ProtocolVersion20250326,
+	ProtocolVersion20241105,
+}
 
 const MethodInitialize = "initialize"
 const MethodNotificationsInitialized = "notifications/initialized"
@@ -14,6 +34,9 @@ const MethodToolsList = "tools/list"
 const MethodToolsCall = "tools/call"
 const MethodNotificationsToolsListChanged = "notifications/tools/list_changed"
 
+const MethodNotificationsCancelled = "notifications/cancelled"
+const MethodNotificationsProgress = "notifications/progress"
+
 const MethodPing = "ping"
 
 type (
@@ -26,6 +49,12 @@ type (
 		ID      UID            `json:"id"`
 		Method  string         `json:"method"`
 		Params  map[string]any `json:"params,omitempty"`
+
+		// RawID is the id of a request whose id is a string, as sent by the client.
+		// ID is zero then, the server answers with RawID in place of ID
+		RawID json.RawMessage `json:"-"`
+
+		ctx context.Context
 	}
 
 	CapabilityParam struct {
@@ -38,19 +67,47 @@ type (
 		Version string `json:"version"`
 	}
 
+	ClientCapabilities struct {
+		Roots        *CapabilityParam `json:"roots,omitempty"`
+		Sampling     map[string]any   `json:"sampling,omitempty"`
+		Elicitation  map[string]any   `json:"elicitation,omitempty"`
+		Experimental map[string]any   `json:"experimental,omitempty"`
+	}
+
+	InitializeParams struct {
+		ProtocolVersion string             `json:"protocolVersion"`
+		Capabilities    ClientCapabilities `json:"capabilities"`
+		ClientInfo      Info               `json:"clientInfo"`
+	}
+
 	Response[UID ID] struct {
-		Jsonrpc      string         `json:"jsonrpc"`
-		ID           UID            `json:"id"`
-		Result       map[string]any `json:"result"`
-		ServerInfo   *Info          `json:"serverInfo,omitempty"`
-		Instructions string         `json:"instructions,omitempty"`
-		Error        *Error         `json:"error,omitempty"`
-		NextCursor   string         `json:"nextCursor,omitempty"`
+		Jsonrpc    string         `json:"jsonrpc"`
+		ID         UID            `json:"id"`
+		Result     map[string]any `json:"result,omitzero"`
+		Error      *Error         `json:"error,omitempty"`
+		NextCursor string         `json:"nextCursor,omitempty"`
+
+		// Deprecated: the server info is sent as "serverInfo" of the initialize result.
+		// The field is encoded next to the result, where clients don't read it
+		ServerInfo *Info `json:"serverInfo,omitempty"`
+		// Deprecated: the instructions are sent as "instructions" of the initialize result.
+		// The field is encoded next to the result, where clients don't read it
+		Instructions string `json:"instructions,omitempty"`
+	}
+
+	// ErrorResponse is the envelope of a failed request.
+	// ID is nil if the id of the request could not be determined,
+	// it is then encoded as null
+	ErrorResponse[UID ID] struct {
+		Jsonrpc string `json:"jsonrpc"`
+		ID      *UID   `json:"id"`
+		Error   *Error `json:"error"`
 	}
 
 	Error struct {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
+		Data    any    `json:"data,omitempty"`
 	}
 
 	Notification struct {
@@ -60,6 +117,37 @@ type (
 	}
 )
 
+// Context returns the request's context.
+// The returned context is always non-nil; it defaults to the background context
+func (r *Request[UID]) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// RequestID returns the id sent by the client, the string of RawID if set and ID otherwise
+func (r *Request[UID]) RequestID() any {
+	if r.RawID != nil {
+		var id string
+		if err := json.Unmarshal(r.RawID, &id); err == nil {
+			return id
+		}
+	}
+	return r.ID
+}
+
+// WithContext returns a shallow copy of r with its context changed to ctx
+func (r *Request[UID]) WithContext(ctx context.Context) *Request[UID] {
+	if ctx == nil {
+		panic("nil context")
+	}
+
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
 // Params  struct {
 // 			ProtocolVersion string `json:"protocolVersion"`
 // 			Capabilities    struct {
@@ -0,0 +1,48 @@
+package spec
+
+import "slices"
+
+// ProtocolFeatures describes the behaviour that differs
+// between the negotiated protocol versions
+type ProtocolFeatures struct {
+	// StructuredContent reports whether tool results may carry
+	// structuredContent and tool definitions an outputSchema
+	StructuredContent bool
+
+	// Batching reports whether the client may send JSON-RPC batches.
+	// Batches were introduced with 2025-03-26 and removed again in 2025-06-18,
+	// older clients may send them as allowed by JSON-RPC 2.0
+	Batching bool
+}
+
+// IsSupportedProtocolVersion reports whether the given version
+// is one of SupportedProtocolVersions
+func IsSupportedProtocolVersion(version string) bool {
+	return slices.Contains(SupportedProtocolVersions, version)
+}
+
+// NegotiateProtocolVersion picks the version to answer an initialize request with.
+// If the requested version is supported, it is returned as is,
+// otherwise the latest supported version is offered to the client
+func NegotiateProtocolVersion(requested string) string {
+	if IsSupportedProtocolVersion(requested) {
+		return requested
+	}
+
+	return ProtocolVersion
+}
+
+// FeaturesFor returns the feature switches for the given protocol version.
+// Unknown versions are treated as the latest one
+func FeaturesFor(version string) ProtocolFeatures {
+	switch version {
+	case ProtocolVersion20241105, ProtocolVersion20250326:
+		return ProtocolFeatures{
+			Batching: true,
+		}
+	default:
+		return ProtocolFeatures{
+			StructuredContent: true,
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/makarski/mcp-robot/handler"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+type (
+	// ToolArgsFunc is a tool function receiving its arguments as Args
+	ToolArgsFunc[TR ToolResult] func(ctx context.Context, args Args) (TR, error)
+
+	// Args gives typed access to the arguments of a tool call.
+	// Missing arguments fall back to the defaults of the input schema.
+	// The getters return an InvalidParams protocol error for missing
+	// or mistyped values, handlers can return it as is
+	Args struct {
+		values map[string]any
+		schema *ToolSchema
+	}
+)
+
+// NewArgs wraps the arguments of a call of a tool with the given input schema
+func NewArgs(values map[string]any, schema ToolSchema) Args {
+	return Args{values: values, schema: &schema}
+}
+
+func (f ToolArgsFunc[TR]) MCPHandler(definition ToolDefinition) handler.MCPHandler {
+	return ToolContextFunc[TR](func(ctx context.Context, params map[string]any) (TR, error) {
+		return f(ctx, NewArgs(params, definition.InputSchema))
+	}).MCPHandler(definition)
+}
+
+// Has reports whether the argument was passed or has a default
+func (a Args) Has(name string) bool {
+	_, ok := a.lookup(name)
+	return ok
+}
+
+// Raw returns the arguments as passed by the client, without defaults
+func (a Args) Raw() map[string]any {
+	return a.values
+}
+
+// String returns a string argument
+func (a Args) String(name string) (string, error) {
+	value, err := a.get(name)
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", typeError(name, "string", value)
+	}
+	return s, nil
+}
+
+// Int returns an integer argument. Numbers with a fractional part are rejected,
+// large integers keep their precision
+func (a Args) Int(name string) (int, error) {
+	value, err := a.get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	i, ok := integerValue(value)
+	if !ok || i < math.MinInt || i > math.MaxInt {
+		return 0, typeError(name, "integer", value)
+	}
+	return int(i), nil
+}
+
+// Float returns a number argument
+func (a Args) Float(name string) (float64, error) {
+	value, err := a.get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := numberValue(value)
+	if !ok {
+		return 0, typeError(name, "number", value)
+	}
+
+	f, _ := n.Float64()
+	return f, nil
+}
+
+// Bool returns a boolean argument
+func (a Args) Bool(name string) (bool, error) {
+	value, err := a.get(name)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := value.(bool)
+	if !ok {
+		return false, typeError(name, "boolean", value)
+	}
+	return b, nil
+}
+
+// Time returns an argument holding an RFC 3339 time
+func (a Args) Time(name string) (time.Time, error) {
+	s, err := a.String(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, spec.NewProtocolErrorWithData(
+			spec.ErrorCodeInvalidParams,
+			fmt.Sprintf("argument '%s' must be an RFC 3339 time: %s", name, err),
+			validationData(name, "time"),
+		)
+	}
+	return t, nil
+}
+
+// Duration returns an argument holding a duration like "1h30m",
+// or a number of seconds
+func (a Args) Duration(name string) (time.Duration, error) {
+	value, err := a.get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if s, ok := value.(string); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, spec.NewProtocolErrorWithData(
+				spec.ErrorCodeInvalidParams,
+				fmt.Sprintf("argument '%s' must be a duration: %s", name, err),
+				validationData(name, "duration"),
+			)
+		}
+		return d, nil
+	}
+
+	seconds, err := a.Float(name)
+	if err != nil {
+		return 0, typeError(name, "duration", value)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// StringSlice returns an array argument of strings
+func (a Args) StringSlice(name string) ([]string, error) {
+	value, err := a.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case []any:
+		strs := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, typeError(fmt.Sprintf("%s[%d]", name, i), "string", item)
+			}
+			strs[i] = s
+		}
+		return strs, nil
+	}
+
+	return nil, typeError(name, "array", value)
+}
+
+// Object returns an object argument, its properties are typed by the nested schema
+func (a Args) Object(name string) (Args, error) {
+	value, err := a.get(name)
+	if err != nil {
+		return Args{}, err
+	}
+
+	object, ok := value.(map[string]any)
+	if !ok {
+		return Args{}, typeError(name, "object", value)
+	}
+
+	schema := &ToolSchema{}
+	if a.schema != nil && a.schema.Properties[name] != nil {
+		schema = a.schema.Properties[name]
+	}
+	return Args{values: object, schema: schema}, nil
+}
+
+// Decode decodes the arguments, with the defaults of the schema applied, into v
+// like encoding/json. Numbers decoded into interface values are json.Number,
+// so that large integers keep their precision
+func (a Args) Decode(v any) error {
+	values := make(map[string]any, len(a.values))
+	if a.schema != nil {
+		for name, property := range a.schema.Properties {
+			if property.Default != nil {
+				values[name] = property.Default
+			}
+		}
+	}
+
+	for name, value := range a.values {
+		values[name] = value
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to encode arguments: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(v); err != nil {
+		return spec.NewProtocolError(spec.ErrorCodeInvalidParams, fmt.Sprintf("invalid arguments: %s", err))
+	}
+	return nil
+}
+
+// lookup returns the argument or its default
+func (a Args) lookup(name string) (any, bool) {
+	if value, ok := a.values[name]; ok && value != nil {
+		return value, true
+	}
+
+	if a.schema != nil {
+		if property, ok := a.schema.Properties[name]; ok && property.Default != nil {
+			return property.Default, true
+		}
+	}
+
+	return nil, false
+}
+
+func (a Args) get(name string) (any, error) {
+	value, ok := a.lookup(name)
+	if !ok {
+		return nil, spec.NewProtocolErrorWithData(
+			spec.ErrorCodeInvalidParams,
+			fmt.Sprintf("missing argument: %s", name),
+			validationData(name, "required"),
+		)
+	}
+	return value, nil
+}
+
+func typeError(name, expected string, value any) error {
+	return spec.NewProtocolErrorWithData(
+		spec.ErrorCodeInvalidParams,
+		fmt.Sprintf("argument '%s' must be of type %s, got %T", name, expected, value),
+		validationData(name, expected),
+	)
+}
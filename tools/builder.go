@@ -1,5 +1,11 @@
 package tools
 
+import (
+	"time"
+
+	"github.com/makarski/mcp-robot/ratelimit"
+)
+
 type (
 	ToolBuilder struct {
 		definition ToolDefinition
@@ -9,6 +15,8 @@ type (
 		root        *ToolBuilder
 		parent      *SchemaBuilder
 		schemaField *ToolSchema
+		// last is the name of the property added last, see Sensitive
+		last string
 	}
 
 	ArrayBuilder struct {
@@ -69,6 +77,7 @@ func (sb *SchemaBuilder) withPropertyType(name, description, propertyType string
 		Type:        propertyType,
 		Description: description,
 	}
+	sb.last = name
 
 	if required {
 		sb.schemaField.Required = append(sb.schemaField.Required, name)
@@ -85,10 +94,49 @@ func (sb *SchemaBuilder) WithNumber(name, description string, required bool) *Sc
 	return sb.withPropertyType(name, description, "number", required)
 }
 
+// WithInteger adds a number property that must not have a fractional part
+func (sb *SchemaBuilder) WithInteger(name, description string, required bool) *SchemaBuilder {
+	return sb.withPropertyType(name, description, "integer", required)
+}
+
 func (sb *SchemaBuilder) WithBoolean(name, description string, required bool) *SchemaBuilder {
 	return sb.withPropertyType(name, description, "boolean", required)
 }
 
+// Sensitive marks the property added last as sensitive, e.g. a password.
+// Its value is redacted in audit records and logs
+func (sb *SchemaBuilder) Sensitive() *SchemaBuilder {
+	if property, ok := sb.schemaField.Properties[sb.last]; ok {
+		property.Sensitive = true
+	}
+	return sb
+}
+
+// Default sets the default value of the property added last,
+// returned by the Args getters if the client doesn't pass the argument
+func (sb *SchemaBuilder) Default(value any) *SchemaBuilder {
+	if property, ok := sb.schemaField.Properties[sb.last]; ok {
+		property.Default = value
+	}
+	return sb
+}
+
+// Minimum sets the smallest value allowed for the number or integer property added last
+func (sb *SchemaBuilder) Minimum(minimum float64) *SchemaBuilder {
+	if property, ok := sb.schemaField.Properties[sb.last]; ok {
+		property.Minimum = &minimum
+	}
+	return sb
+}
+
+// Maximum sets the largest value allowed for the number or integer property added last
+func (sb *SchemaBuilder) Maximum(maximum float64) *SchemaBuilder {
+	if property, ok := sb.schemaField.Properties[sb.last]; ok {
+		property.Maximum = &maximum
+	}
+	return sb
+}
+
 func (sb *SchemaBuilder) WithArray(name, description string, required bool) *ArrayBuilder {
 	ab := &ArrayBuilder{
 		parent:      sb,
@@ -204,6 +252,49 @@ func (b *ToolBuilder) MarkAsCallingOpenWorld(callsOpenWorld bool) *ToolBuilder {
 	return b
 }
 
+// RequireScopes restricts the tool to callers whose token grants all of the scopes.
+// The tool is hidden from tools/list for other callers
+func (b *ToolBuilder) RequireScopes(scopes ...string) *ToolBuilder {
+	b.definition.RequiredScopes = append(b.definition.RequiredScopes, scopes...)
+	return b
+}
+
+// RateLimit limits the rate and the concurrency of the calls of the tool across all callers
+func (b *ToolBuilder) RateLimit(limit ratelimit.Limit) *ToolBuilder {
+	b.definition.RateLimit = limit
+	return b
+}
+
+// Timeout bounds the execution of a call of the tool. The handler context expires
+// after the timeout and the client receives an error result saying the call timed out.
+// The tool function isn't stopped, it keeps running until it returns;
+// functions doing long work should return when their context is done
+func (b *ToolBuilder) Timeout(timeout time.Duration) *ToolBuilder {
+	b.definition.Timeout = timeout
+	return b
+}
+
+// MaxResultSize bounds the size in bytes of the binary content of a result,
+// larger results are answered with a tool error
+func (b *ToolBuilder) MaxResultSize(size int64) *ToolBuilder {
+	b.definition.MaxResultSize = size
+	return b
+}
+
+// LinkOversizedResources replaces embedded binary resources of results exceeding
+// MaxResultSize by resource links, so that the client can fetch them separately
+func (b *ToolBuilder) LinkOversizedResources() *ToolBuilder {
+	b.definition.LinkOversizedResources = true
+	return b
+}
+
+// CheckImageMimeTypes answers results with a tool error when the data of an image
+// doesn't match its declared MIME type, so that clients don't receive mislabelled images
+func (b *ToolBuilder) CheckImageMimeTypes() *ToolBuilder {
+	b.definition.CheckImageMimeTypes = true
+	return b
+}
+
 func (b *ToolBuilder) Build() ToolDefinition {
 	return b.definition
 }
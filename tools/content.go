@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"fmt"
+
+	"github.com/makarski/mcp-robot/resources"
+)
+
+type (
+	// Content is the result of a tool function. It is implemented by the built-in
+	// result types, custom types implement it to render themselves into content blocks,
+	// e.g. a chart sent as a text summary and an image
+	Content interface {
+		MarshalContent() (ToolResultContent, error)
+	}
+
+	// ContentBlock is a block of the content of a tool result encoding to a JSON object
+	// like ToolResultText, ToolResultMedia, ToolResultEmbeddedResource or resources.ResourceLink
+	ContentBlock any
+
+	// ToolResultContent is the content of a tool result
+	ToolResultContent struct {
+		Content []ContentBlock
+		// Structured is sent as structuredContent to clients supporting it
+		// and validated against the output schema of the tool
+		Structured ToolResultStructured
+		// Meta is sent as the _meta of the result
+		Meta map[string]any
+	}
+
+	// ContentBlocks is a result made of the given content blocks
+	ContentBlocks []ContentBlock
+)
+
+func (c ContentBlocks) MarshalContent() (ToolResultContent, error) {
+	return ToolResultContent{Content: c}, nil
+}
+
+func (t ToolResultText) MarshalContent() (ToolResultContent, error) {
+	return ToolResultContent{Content: []ContentBlock{t}}, nil
+}
+
+func (m ToolResultMedia) MarshalContent() (ToolResultContent, error) {
+	return ToolResultContent{Content: []ContentBlock{m}}, nil
+}
+
+func (r ToolResultEmbeddedResource[R]) MarshalContent() (ToolResultContent, error) {
+	return ToolResultContent{Content: []ContentBlock{r}}, nil
+}
+
+// MarshalContent sends the structured content as JSON text as well,
+// for clients not reading structuredContent
+func (s ToolResultStructured) MarshalContent() (ToolResultContent, error) {
+	txt, err := JSONText(s)
+	if err != nil {
+		return ToolResultContent{}, err
+	}
+
+	return ToolResultContent{
+		Content:    []ContentBlock{NewToolResultText(txt)},
+		Structured: s,
+	}, nil
+}
+
+func (u ToolResultUnion) MarshalContent() (ToolResultContent, error) {
+	if u.structuredErr != nil {
+		return ToolResultContent{}, u.structuredErr
+	}
+
+	content := ToolResultContent{
+		Content:    u.toArray(),
+		Structured: u.structured,
+		Meta:       u.meta,
+	}
+
+	if u.structured != nil {
+		if format := u.textFallback(); format != nil {
+			txt, err := format(u.structured)
+			if err != nil {
+				return ToolResultContent{}, err
+			}
+			content.Content = append(content.Content, NewToolResultText(txt))
+		}
+	}
+
+	return content, nil
+}
+
+// marshalResult renders the result of a tool function. Besides implementations of Content,
+// results may be resource links and slices of the built-in content blocks
+func marshalResult(result any) (ToolResultContent, error) {
+	switch v := result.(type) {
+	case Content:
+		return v.MarshalContent()
+	case resources.ResourceLink:
+		return ToolResultContent{Content: []ContentBlock{v}}, nil
+	case []any:
+		return blocks(v).MarshalContent()
+	case []ToolResultText:
+		return blocks(v).MarshalContent()
+	case []ToolResultMedia:
+		return blocks(v).MarshalContent()
+	case []ToolResultEmbeddedResource[resources.ResourceText]:
+		return blocks(v).MarshalContent()
+	case []ToolResultEmbeddedResource[resources.ResourceBinary]:
+		return blocks(v).MarshalContent()
+	case []resources.ResourceLink:
+		return blocks(v).MarshalContent()
+	default:
+		return ToolResultContent{}, fmt.Errorf("invalid tool result type: %T", v)
+	}
+}
+
+func blocks[T any](items []T) ContentBlocks {
+	c := make(ContentBlocks, len(items))
+	for i, item := range items {
+		c[i] = item
+	}
+	return c
+}
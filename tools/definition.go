@@ -2,9 +2,13 @@ package tools
 
 import (
 	"fmt"
+	"math/big"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/makarski/mcp-robot/ratelimit"
 	"github.com/makarski/mcp-robot/spec"
 )
 
@@ -18,6 +22,21 @@ type (
 		Annotations  ToolAnnotations `json:"annotations,omitzero"`
 
 		ResultsPerPage int `json:"-"`
+		// RequiredScopes lists the scopes a caller needs to see and call the tool
+		RequiredScopes []string `json:"-"`
+		// RateLimit limits the calls of the tool across all callers
+		RateLimit ratelimit.Limit `json:"-"`
+		// Timeout bounds the time a call waits for the tool function, zero falls back to the server default.
+		// The function isn't stopped after the timeout, it keeps running until it observes
+		// the cancellation of its context or returns
+		Timeout time.Duration `json:"-"`
+		// MaxResultSize bounds the size in bytes of the binary content of a result, zero means no limit
+		MaxResultSize int64 `json:"-"`
+		// LinkOversizedResources replaces embedded binary resources of results
+		// exceeding MaxResultSize by resource links
+		LinkOversizedResources bool `json:"-"`
+		// CheckImageMimeTypes rejects results with images whose data doesn't match their MIME type
+		CheckImageMimeTypes bool `json:"-"`
 	}
 
 	ToolSchema struct {
@@ -26,6 +45,13 @@ type (
 		Properties  map[string]*ToolSchema `json:"properties,omitempty"`
 		Required    []string               `json:"required,omitempty"`
 		ArrayItems  *ToolSchema            `json:"items,omitempty"`
+		// Default is the value of an argument the client didn't pass, see Args
+		Default any `json:"default,omitempty"`
+		// Minimum and Maximum bound the values of number and integer properties
+		Minimum *float64 `json:"minimum,omitempty"`
+		Maximum *float64 `json:"maximum,omitempty"`
+		// Sensitive values are redacted in audit records and logs
+		Sensitive bool `json:"-"`
 	}
 
 	ToolAnnotations struct {
@@ -37,12 +63,28 @@ type (
 	}
 )
 
+// IsReadOnly reports whether the tool is marked read-only
+func (d ToolDefinition) IsReadOnly() bool {
+	return d.Annotations.ReadOnlyHint != nil && *d.Annotations.ReadOnlyHint
+}
+
+// IsDestructive reports whether the tool may perform destructive updates.
+// Following the MCP defaults, a tool that is not read-only
+// is destructive unless marked otherwise
+func (d ToolDefinition) IsDestructive() bool {
+	if d.IsReadOnly() {
+		return false
+	}
+	return d.Annotations.DestructiveHint == nil || *d.Annotations.DestructiveHint
+}
+
 func (d ToolDefinition) ValidateArguments(args map[string]any) error {
 	for _, field := range d.InputSchema.Required {
 		if _, ok := args[field]; !ok {
-			return spec.NewProtocolError(
+			return spec.NewProtocolErrorWithData(
 				spec.ErrorCodeInvalidParams,
 				fmt.Sprintf("missing required argument: %s", field),
+				validationData(field, "required"),
 			)
 		}
 	}
@@ -54,9 +96,10 @@ func (d ToolDefinition) ValidateArguments(args map[string]any) error {
 	for argName, arg := range args {
 		schema, exists := d.InputSchema.Properties[argName]
 		if !exists {
-			return spec.NewProtocolError(
+			return spec.NewProtocolErrorWithData(
 				spec.ErrorCodeInvalidParams,
 				fmt.Sprintf("unexpected argument: %s", argName),
+				validationData(argName, "unexpected"),
 			)
 		}
 
@@ -64,6 +107,9 @@ func (d ToolDefinition) ValidateArguments(args map[string]any) error {
 			return err
 		}
 
+		if err := validateRange(argName, arg, schema); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -73,38 +119,51 @@ func validateArgumentType(name string, arg any, expectedType string) error {
 	switch expectedType {
 	case "string":
 		if _, ok := arg.(string); !ok {
-			return spec.NewProtocolError(
+			return spec.NewProtocolErrorWithData(
 				spec.ErrorCodeInvalidParams,
 				fmt.Sprintf("argument '%s' must be a string", name),
+				validationData(name, "string"),
 			)
 		}
 	case "number":
-		if _, ok := arg.(float64); !ok {
-			return spec.NewProtocolError(
+		if _, ok := numberValue(arg); !ok {
+			return spec.NewProtocolErrorWithData(
 				spec.ErrorCodeInvalidParams,
 				fmt.Sprintf("argument '%s' must be a number", name),
+				validationData(name, "number"),
+			)
+		}
+	case "integer":
+		if n, ok := numberValue(arg); !ok || !n.IsInt() {
+			return spec.NewProtocolErrorWithData(
+				spec.ErrorCodeInvalidParams,
+				fmt.Sprintf("argument '%s' must be an integer", name),
+				validationData(name, "integer"),
 			)
 		}
 	case "boolean":
 		if _, ok := arg.(bool); !ok {
-			return spec.NewProtocolError(
+			return spec.NewProtocolErrorWithData(
 				spec.ErrorCodeInvalidParams,
 				fmt.Sprintf("argument '%s' must be a boolean", name),
+				validationData(name, "boolean"),
 			)
 		}
 	case "array":
 		v := reflect.ValueOf(arg)
 		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
-			return spec.NewProtocolError(
+			return spec.NewProtocolErrorWithData(
 				spec.ErrorCodeInvalidParams,
 				fmt.Sprintf("argument '%s' must be an array, got %T", name, arg),
+				validationData(name, "array"),
 			)
 		}
 	default:
 		if _, ok := arg.(map[string]any); ok {
-			return spec.NewProtocolError(
+			return spec.NewProtocolErrorWithData(
 				spec.ErrorCodeInvalidParams,
 				fmt.Sprintf("object arguments are not supported. argument '%s' is an object. ", name),
+				validationData(name, "unsupported"),
 			)
 		}
 	}
@@ -112,52 +171,101 @@ func validateArgumentType(name string, arg any, expectedType string) error {
 	return nil
 }
 
-func validateOutput[TR ToolResult](definition ToolDefinition, result TR) error {
+// validateRange checks a number argument against the minimum and maximum of its schema.
+// The comparison is exact, also for integers beyond the precision of float64
+func validateRange(name string, arg any, schema *ToolSchema) error {
+	if schema.Minimum == nil && schema.Maximum == nil {
+		return nil
+	}
+
+	n, ok := numberValue(arg)
+	if !ok {
+		return nil
+	}
+
+	if schema.Minimum != nil && n.Cmp(new(big.Rat).SetFloat64(*schema.Minimum)) < 0 {
+		return spec.NewProtocolErrorWithData(
+			spec.ErrorCodeInvalidParams,
+			fmt.Sprintf("argument '%s' must be at least %s", name, strconv.FormatFloat(*schema.Minimum, 'f', -1, 64)),
+			validationData(name, "minimum"),
+		)
+	}
+
+	if schema.Maximum != nil && n.Cmp(new(big.Rat).SetFloat64(*schema.Maximum)) > 0 {
+		return spec.NewProtocolErrorWithData(
+			spec.ErrorCodeInvalidParams,
+			fmt.Sprintf("argument '%s' must be at most %s", name, strconv.FormatFloat(*schema.Maximum, 'f', -1, 64)),
+			validationData(name, "maximum"),
+		)
+	}
+
+	return nil
+}
+
+// validationData is the structured detail attached to validation errors:
+// the path of the offending value and the rule it violates
+func validationData(path, rule string) map[string]any {
+	return map[string]any{
+		"path": path,
+		"rule": rule,
+	}
+}
+
+// validateOutput validates the structured content of a result against the output schema
+func validateOutput(definition ToolDefinition, content ToolResultContent) error {
 	schema := definition.OutputSchema
 	if schema.Type == "" {
 		return nil // No output schema defined, no validation needed
 	}
 
-	switch v := any(result).(type) {
-	case ToolResultStructured:
-		if len(schema.Required) == 0 && len(schema.Properties) == 0 {
-			return nil
-		}
-		missingFields := []string{}
-		for _, requiredField := range schema.Required {
-			if _, ok := v[requiredField]; !ok {
-				missingFields = append(missingFields, requiredField)
-			}
+	if content.Structured == nil {
+		return nil
+	}
+
+	return validateStructured(schema, content.Structured)
+}
+
+// validateStructured validates structured content against the output schema
+func validateStructured(schema ToolSchema, v ToolResultStructured) error {
+	if len(schema.Required) == 0 && len(schema.Properties) == 0 {
+		return nil
+	}
+
+	missingFields := []string{}
+	for _, requiredField := range schema.Required {
+		if _, ok := v[requiredField]; !ok {
+			missingFields = append(missingFields, requiredField)
 		}
+	}
 
-		if len(missingFields) > 0 {
-			return spec.NewProtocolError(
-				spec.ErrorCodeInvalidParams,
-				fmt.Sprintf("missing required output fields: %v", strings.Join(missingFields, ",")),
-			)
+	if len(missingFields) > 0 {
+		return spec.NewProtocolErrorWithData(
+			spec.ErrorCodeInvalidParams,
+			fmt.Sprintf("missing required output fields: %v", strings.Join(missingFields, ",")),
+			map[string]any{"paths": missingFields, "rule": "required"},
+		)
+	}
+
+	for name, spec := range schema.Properties {
+		if _, ok := v[name]; !ok {
+			continue
 		}
 
-		for name, spec := range schema.Properties {
-			if _, ok := v[name]; !ok {
-				continue
-			}
-
-			if err := validateArgumentType(name, v[name], spec.Type); err != nil {
-				return err
-			}
-
-			// TODO: Handle nested objects and arrays
-			// if spec.Type == "array" {
-			// arrayVals := reflect.ValueOf(v[name])
-			// if arrayVals.Kind() == reflect.Slice && arrayVals.Kind() == reflect.Array {
-			// 	for i := 0; i < arrayVals.Len(); i++ {
-			// 		itemVal := arrayVals.Index(i).Interface()
-
-			// for _, arrayItem := range spec.arrayItems.Properties {
-			// fmt.Printf("array item: %+v, %+v", arrayItem, v[name])
-			// }
-			// }
+		if err := validateArgumentType(name, v[name], spec.Type); err != nil {
+			return err
 		}
+
+		// TODO: Handle nested objects and arrays
+		// if spec.Type == "array" {
+		// arrayVals := reflect.ValueOf(v[name])
+		// if arrayVals.Kind() == reflect.Slice && arrayVals.Kind() == reflect.Array {
+		// 	for i := 0; i < arrayVals.Len(); i++ {
+		// 		itemVal := arrayVals.Index(i).Interface()
+
+		// for _, arrayItem := range spec.arrayItems.Properties {
+		// fmt.Printf("array item: %+v, %+v", arrayItem, v[name])
+		// }
+		// }
 	}
 
 	return nil
@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/makarski/mcp-robot/spec"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// checkValidationError checks that err is an invalid params error
+// violating rule at path, or that err is nil if rule is empty
+func checkValidationError(t *testing.T, err error, path, rule string) {
+	t.Helper()
+
+	if rule == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+
+	var pe *spec.ProtocolError
+	if !errors.As(err, &pe) || pe.Code != spec.ErrorCodeInvalidParams {
+		t.Fatalf("err = %v, want an invalid params error", err)
+	}
+
+	data, _ := pe.Data.(map[string]any)
+	if data["path"] != path || data["rule"] != rule {
+		t.Errorf("data = %v, want path %s and rule %s", pe.Data, path, rule)
+	}
+}
+
+func TestValidateArguments(t *testing.T) {
+	definition := ToolDefinition{
+		Name: "search",
+		InputSchema: ToolSchema{
+			Type: "object",
+			Properties: map[string]*ToolSchema{
+				"query":   {Type: "string"},
+				"limit":   {Type: "integer"},
+				"score":   {Type: "number"},
+				"exact":   {Type: "boolean"},
+				"tags":    {Type: "array", ArrayItems: &ToolSchema{Type: "string"}},
+				"filters": {Type: "object"},
+			},
+			Required: []string{"query"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		args map[string]any
+		path string
+		rule string
+	}{
+		{"required only", map[string]any{"query": "go"}, "", ""},
+		{"all types", map[string]any{
+			"query": "go",
+			"limit": json.Number("10"),
+			"score": json.Number("0.5"),
+			"exact": true,
+			"tags":  []any{"a", "b"},
+		}, "", ""},
+		{"float64 integer", map[string]any{"query": "go", "limit": float64(10)}, "", ""},
+		{"missing required", map[string]any{"limit": json.Number("10")}, "query", "required"},
+		{"unexpected", map[string]any{"query": "go", "page": json.Number("2")}, "page", "unexpected"},
+		{"not a string", map[string]any{"query": json.Number("1")}, "query", "string"},
+		{"not an integer", map[string]any{"query": "go", "limit": json.Number("1.5")}, "limit", "integer"},
+		{"string integer", map[string]any{"query": "go", "limit": "10"}, "limit", "integer"},
+		{"not a number", map[string]any{"query": "go", "score": "high"}, "score", "number"},
+		{"not a boolean", map[string]any{"query": "go", "exact": "true"}, "exact", "boolean"},
+		{"not an array", map[string]any{"query": "go", "tags": "a,b"}, "tags", "array"},
+		{"object", map[string]any{"query": "go", "filters": map[string]any{"lang": "go"}}, "filters", "unsupported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidationError(t, definition.ValidateArguments(tt.args), tt.path, tt.rule)
+		})
+	}
+}
+
+func TestValidateArgumentsWithoutProperties(t *testing.T) {
+	definition := ToolDefinition{
+		Name:        "echo",
+		InputSchema: ToolSchema{Type: "object", Required: []string{"text"}},
+	}
+
+	checkValidationError(t, definition.ValidateArguments(map[string]any{"text": "hi", "extra": true}), "", "")
+	checkValidationError(t, definition.ValidateArguments(map[string]any{}), "text", "required")
+}
+
+func TestValidateRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		arg    any
+		schema ToolSchema
+		rule   string
+	}{
+		{"no bounds", json.Number("-1e300"), ToolSchema{Type: "number"}, ""},
+		{"at minimum", json.Number("1"), ToolSchema{Type: "integer", Minimum: ptr(1.0)}, ""},
+		{"below minimum", json.Number("0"), ToolSchema{Type: "integer", Minimum: ptr(1.0)}, "minimum"},
+		{"fraction below minimum", json.Number("0.99"), ToolSchema{Type: "number", Minimum: ptr(1.0)}, "minimum"},
+		{"at maximum", json.Number("100"), ToolSchema{Type: "integer", Maximum: ptr(100.0)}, ""},
+		{"above maximum", json.Number("101"), ToolSchema{Type: "integer", Maximum: ptr(100.0)}, "maximum"},
+		{"fractional bounds", json.Number("0.5"), ToolSchema{Type: "number", Minimum: ptr(0.25), Maximum: ptr(0.75)}, ""},
+		{"negative bounds", json.Number("-5"), ToolSchema{Type: "integer", Minimum: ptr(-10.0), Maximum: ptr(-1.0)}, ""},
+		{"float64 argument", float64(3), ToolSchema{Type: "number", Maximum: ptr(2.0)}, "maximum"},
+		{"not a number", "3", ToolSchema{Type: "number", Maximum: ptr(2.0)}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidationError(t, validateRange("value", tt.arg, &tt.schema), "value", tt.rule)
+		})
+	}
+}
+
+func TestValidateRangeMessage(t *testing.T) {
+	err := validateRange("limit", json.Number("0.5"), &ToolSchema{Type: "number", Minimum: ptr(1.5)})
+
+	want := "argument 'limit' must be at least 1.5"
+	if err == nil || err.Error() != want {
+		t.Errorf("err = %v, want %q", err, want)
+	}
+}
@@ -1,22 +1,52 @@
 package tools
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
 
 	"github.com/makarski/mcp-robot/handler"
 	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/session"
 	"github.com/makarski/mcp-robot/spec"
 )
 
+// ErrTimeout is the cancellation cause of tool calls exceeding their timeout
+var ErrTimeout = errors.New("tool call timed out")
+
 type (
 	ToolFunc[TR ToolResult] func(params map[string]any) (TR, error)
 
+	// ToolContextFunc is a tool function receiving the request context.
+	// The context carries the client session (see session.FromContext)
+	// and is cancelled when the request is cancelled or the session ends
+	ToolContextFunc[TR ToolResult] func(ctx context.Context, params map[string]any) (TR, error)
+
 	ToolHandler interface {
 		MCPHandler(definition ToolDefinition) handler.MCPHandler
 	}
+
+	// PanicError is the value a tool function panicked with. The panic is raised again
+	// in the goroutine serving the request, so that middlewares and the server can recover it
+	PanicError struct {
+		Tool  string
+		Value any
+		Stack []byte
+	}
 )
 
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("tool '%s' panicked: %v", e.Tool, e.Value)
+}
+
 func (f ToolFunc[TR]) MCPHandler(definition ToolDefinition) handler.MCPHandler {
+	return ToolContextFunc[TR](func(_ context.Context, params map[string]any) (TR, error) {
+		return f(params)
+	}).MCPHandler(definition)
+}
+
+func (f ToolContextFunc[TR]) MCPHandler(definition ToolDefinition) handler.MCPHandler {
 	return handler.MCPHandlerFunc(func(w io.RPCResponseWriter, req *spec.Request[int]) {
 		rw := io.NewResponseWriter(w, req.ID)
 
@@ -26,25 +56,102 @@ func (f ToolFunc[TR]) MCPHandler(definition ToolDefinition) handler.MCPHandler {
 			args = make(map[string]any)
 		}
 
-		result, err := f(args)
+		result, completed, err := call(req.Context(), f, args)
+		if pe, ok := err.(*PanicError); ok {
+			pe.Tool = definition.Name
+			panic(pe)
+		}
+
+		if !completed {
+			if isTimeout(req.Context()) {
+				writeError(rw, fmt.Sprintf("tool '%s' timed out", definition.Name))
+			}
+			// a cancelled call is not answered, the client no longer waits for it
+			return
+		}
+
 		if err != nil {
 			switch e := err.(type) {
 			case *spec.ProtocolError:
-				rw.WriteError(e.Code, e.Message)
+				rw.WriteProtocolError(e)
 			default:
 				writeError(rw, fmt.Sprintf(errfmt, req.ID, err))
 			}
 			return
 		}
 
-		if err := validateOutput(definition, result); err != nil {
+		content, err := marshalResult(result)
+		if err != nil {
 			writeError(rw, fmt.Sprintf(errfmt, req.ID, err))
 			return
 		}
+		defer closeSources(content.Content)
 
-		if err := writeResult(rw, result); err != nil {
+		content, err = detectMimeTypes(definition, content)
+		if err != nil {
+			writeError(rw, err.Error())
+			return
+		}
+
+		content, err = limitResult(definition, content)
+		if err != nil {
+			writeError(rw, err.Error())
+			return
+		}
+
+		if err := validateOutput(definition, content); err != nil {
 			writeError(rw, fmt.Sprintf(errfmt, req.ID, err))
 			return
 		}
+
+		features := session.FeaturesFromContext(req.Context())
+		if err := writeResult(rw, content, features); err != nil {
+			// a response broken off while streaming can't be followed by another one
+			if !errors.Is(err, io.ErrIncompleteResponse) {
+				writeError(rw, fmt.Sprintf(errfmt, req.ID, err))
+			}
+			return
+		}
 	})
 }
+
+// call runs the tool function until it returns or ctx is done, reporting which came first.
+// A function ignoring ctx keeps running in the background, its result is discarded.
+// A panic of the function is returned as a *PanicError
+func call[TR ToolResult](ctx context.Context, f ToolContextFunc[TR], args map[string]any) (TR, bool, error) {
+	type outcome struct {
+		result TR
+		err    error
+	}
+
+	// the resources of the call are held until the function returns, also after a timeout
+	release := takeCallRelease(ctx)
+
+	done := make(chan outcome, 1)
+	go func() {
+		defer release()
+		defer func() {
+			if v := recover(); v != nil {
+				done <- outcome{err: &PanicError{Value: v, Stack: debug.Stack()}}
+			}
+		}()
+
+		result, err := f(ctx, args)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, true, o.err
+	case <-ctx.Done():
+		var zero TR
+		return zero, false, ctx.Err()
+	}
+}
+
+// isTimeout reports whether ctx ended because of a timeout
+// rather than a cancellation
+func isTimeout(ctx context.Context) bool {
+	cause := context.Cause(ctx)
+	return errors.Is(cause, ErrTimeout) || errors.Is(cause, context.DeadlineExceeded)
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/makarski/mcp-robot/resources"
+)
+
+// detectMimeTypes fills in the MIME type of the binary content blocks declared without one.
+// With CheckImageMimeTypes the data of images is checked against their declared MIME type
+func detectMimeTypes(definition ToolDefinition, content ToolResultContent) (ToolResultContent, error) {
+	var detected []ContentBlock
+
+	for i, block := range content.Content {
+		switch b := block.(type) {
+		case ToolResultMedia:
+			if b.MimeType != "" && !(definition.CheckImageMimeTypes && b.Type == "image") {
+				continue
+			}
+
+			data, err := sniffData(b.Data, b.source)
+			if err != nil {
+				return content, err
+			}
+
+			if b.MimeType != "" {
+				if err := resources.CheckImageMimeType(b.MimeType, data); err != nil {
+					return content, fmt.Errorf("tool '%s' returned a mislabelled image: %w", definition.Name, err)
+				}
+				continue
+			}
+
+			b.MimeType = resources.DetectMimeType(data)
+			block = b
+		case ToolResultEmbeddedResource[resources.ResourceBinary]:
+			if b.Resource.MimeType != "" {
+				continue
+			}
+
+			data, err := sniffData(b.Resource.Blob, b.source)
+			if err != nil {
+				return content, err
+			}
+
+			b.Resource.MimeType = resources.DetectMimeType(data, b.Resource.URI, b.Resource.Name)
+			block = b
+		default:
+			continue
+		}
+
+		if detected == nil {
+			detected = slices.Clone(content.Content)
+		}
+		detected[i] = block
+	}
+
+	if detected != nil {
+		content.Content = detected
+	}
+	return content, nil
+}
+
+// sniffData returns the data to detect the MIME type from,
+// the first bytes of the source for content read from a reader
+func sniffData(data []byte, source *binarySource) ([]byte, error) {
+	if source != nil {
+		return source.peek()
+	}
+	return data, nil
+}
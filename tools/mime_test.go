@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/makarski/mcp-robot/resources"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestToolResultMediaRoundTrip(t *testing.T) {
+	data := []byte{0x00, 0xff, 0x10, 0x80}
+	image := NewToolResultImage(data, "image/png")
+
+	encoded, err := json.Marshal(image)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `{"type":"image","data":"AP8QgA==","mimeType":"image/png"}`; string(encoded) != want {
+		t.Errorf("Marshal = %s, want %s", encoded, want)
+	}
+
+	var decoded ToolResultMedia
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(decoded.Data, data) || decoded.Type != "image" || decoded.MimeType != "image/png" {
+		t.Errorf("decoded %+v, want %+v", decoded, image)
+	}
+}
+
+func TestEmbeddedBinaryResourceRoundTrip(t *testing.T) {
+	data := []byte("%PDF-1.7 binary \x00\xff")
+	embedded := NewToolResultEmbeddedBinaryResource("file:///r.pdf", "r.pdf", "Report", "", data)
+
+	encoded, err := json.Marshal(embedded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded ToolResultEmbeddedResource[resources.ResourceBinary]
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(decoded.Resource.Blob, data) || decoded.Resource.MimeType != "application/pdf" {
+		t.Errorf("decoded %+v, want the blob and application/pdf", decoded.Resource)
+	}
+}
+
+func TestDetectMimeTypes(t *testing.T) {
+	content := ToolResultContent{Content: []ContentBlock{
+		NewToolResultText("chart"),
+		NewToolResultImage(testPNG, ""),
+		NewToolResultAudio([]byte("RIFF\x24\x00\x00\x00WAVEfmt "), ""),
+		NewToolResultImageReader(bytes.NewReader(testPNG), int64(len(testPNG)), ""),
+		NewToolResultEmbeddedBinaryResourceReader("db://blobs/1", "blob", "", "", bytes.NewReader(testPNG), int64(len(testPNG))),
+		NewToolResultEmbeddedBinaryResourceReader("file:///a.zip", "a.zip", "", "", strings.NewReader("unread"), 6),
+	}}
+
+	detected, err := detectMimeTypes(ToolDefinition{}, content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"", "image/png", "audio/wave", "image/png", "image/png", "application/zip"}
+	for i, block := range detected.Content {
+		var got string
+		switch b := block.(type) {
+		case ToolResultMedia:
+			got = b.MimeType
+		case ToolResultEmbeddedResource[resources.ResourceBinary]:
+			got = b.Resource.MimeType
+		}
+
+		if got != want[i] {
+			t.Errorf("block %d MIME type = %q, want %q", i, got, want[i])
+		}
+	}
+
+	if content.Content[1].(ToolResultMedia).MimeType != "" {
+		t.Error("the blocks of the original content were modified")
+	}
+}
+
+func TestDetectMimeTypesKeepsStreamedData(t *testing.T) {
+	data := append(bytes.Clone(testPNG), bytes.Repeat([]byte{7}, 2000)...)
+	image := NewToolResultImageReader(bytes.NewReader(data), int64(len(data)), "")
+
+	detected, err := detectMimeTypes(ToolDefinition{CheckImageMimeTypes: true}, ToolResultContent{Content: []ContentBlock{image}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := detected.Content[0].(ToolResultMedia).source.writeBase64(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded ToolResultMedia
+	json.Unmarshal([]byte(`{"data":"`+buf.String()+`"}`), &decoded)
+	if !bytes.Equal(decoded.Data, data) {
+		t.Error("the sniffed bytes are missing from the streamed data")
+	}
+}
+
+func TestCheckImageMimeTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		check   bool
+		block   ContentBlock
+		wantErr bool
+	}{
+		{"matching", true, NewToolResultImage(testPNG, "image/png"), false},
+		{"mismatch", true, NewToolResultImage(testPNG, "image/jpeg"), true},
+		{"mismatch unchecked", false, NewToolResultImage(testPNG, "image/jpeg"), false},
+		{"streamed mismatch", true, NewToolResultImageReader(bytes.NewReader(testPNG), int64(len(testPNG)), "image/gif"), true},
+		{"audio not checked", true, NewToolResultAudio(testPNG, "audio/mpeg"), false},
+		{"svg not sniffable", true, NewToolResultImage([]byte("<svg/>"), "image/svg+xml"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			definition := ToolDefinition{Name: "chart", CheckImageMimeTypes: tt.check}
+			_, err := detectMimeTypes(definition, ToolResultContent{Content: []ContentBlock{tt.block}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("detectMimeTypes() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMislabelledImageIsAToolError(t *testing.T) {
+	var buf bytes.Buffer
+	tool := ToolFunc[ToolResultMedia](func(map[string]any) (ToolResultMedia, error) {
+		return NewToolResultImage(testPNG, "image/jpeg"), nil
+	})
+	tool.MCPHandler(NewTool("chart").CheckImageMimeTypes().Build()).ServeRPC(&buf, newCallRequest())
+
+	var response struct {
+		Result struct {
+			IsError bool `json:"isError"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if !response.Result.IsError {
+		t.Errorf("response = %s, want a tool error", buf.String())
+	}
+}
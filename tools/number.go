@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxExponent bounds the exponent of the numbers that are parsed exactly
+const maxExponent = 400
+
+// numberValue returns the exact value of a number argument. Arguments decoded from
+// requests are json.Number, values built in Go, like structured results, any numeric type
+func numberValue(v any) (*big.Rat, bool) {
+	if n, ok := v.(json.Number); ok {
+		// exponents beyond the float64 range would make exact parsing expensive
+		if exp := strings.IndexAny(n.String(), "eE"); exp >= 0 {
+			if e, err := strconv.Atoi(n.String()[exp+1:]); err != nil || e > maxExponent || e < -maxExponent {
+				return nil, false
+			}
+		}
+		return new(big.Rat).SetString(n.String())
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Rat).SetInt64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Rat).SetUint64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		// NaN and infinities are not JSON numbers
+		r := new(big.Rat).SetFloat64(rv.Float())
+		return r, r != nil
+	default:
+		return nil, false
+	}
+}
+
+// integerValue returns the value of an integer argument that fits into an int64.
+// Numbers like 1e3 or 2.0 are integers too
+func integerValue(v any) (int64, bool) {
+	r, ok := numberValue(v)
+	if !ok || !r.IsInt() || !r.Num().IsInt64() {
+		return 0, false
+	}
+	return r.Num().Int64(), true
+}
@@ -0,0 +1,207 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/makarski/mcp-robot/spec"
+)
+
+const (
+	maxSafeInteger = 1<<53 - 1
+	// the literals of 2^53 and 2^53+1 both round to 2^53 as float64
+	pow53      = "9007199254740992"
+	pow53Plus1 = "9007199254740993"
+)
+
+func TestIntegerValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  int64
+		ok    bool
+	}{
+		{"2^53-1", json.Number("9007199254740991"), maxSafeInteger, true},
+		{"2^53", json.Number(pow53), 1 << 53, true},
+		{"2^53+1", json.Number(pow53Plus1), 1<<53 + 1, true},
+		{"-(2^53+1)", json.Number("-" + pow53Plus1), -(1<<53 + 1), true},
+		{"max int64", json.Number("9223372036854775807"), math.MaxInt64, true},
+		{"beyond int64", json.Number("9223372036854775808"), 0, false},
+		{"exponent", json.Number("1e3"), 1000, true},
+		{"exponent of 2^53+1", json.Number("9.007199254740993e15"), 1<<53 + 1, true},
+		{"integral fraction", json.Number("2.0"), 2, true},
+		{"fraction", json.Number("2.5"), 0, false},
+		{"fraction beyond float64 precision", json.Number(pow53Plus1 + ".5"), 0, false},
+		{"large exponent", json.Number("1e400"), 0, false},
+		{"exponent beyond bound", json.Number("1e401"), 0, false},
+		{"negative exponent beyond bound", json.Number("1e-401"), 0, false},
+		{"int", 42, 42, true},
+		{"uint64", uint64(1<<53 + 1), 1<<53 + 1, true},
+		{"float64", float64(1 << 53), 1 << 53, true},
+		{"NaN", math.NaN(), 0, false},
+		{"string", "1", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := integerValue(tt.value)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("integerValue(%v) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNumberValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+		ok    bool
+	}{
+		{"2^53-1", json.Number("9007199254740991"), "9007199254740991", true},
+		{"2^53", json.Number(pow53), pow53, true},
+		{"2^53+1", json.Number(pow53Plus1), pow53Plus1, true},
+		{"2^53+1 with fraction", json.Number(pow53Plus1 + ".25"), "36028797018963973/4", true},
+		{"large exponent", json.Number("1e308"), "1" + strings.Repeat("0", 308), true},
+		{"exponent beyond bound", json.Number("1E999999999"), "", false},
+		{"malformed exponent", json.Number("1e"), "", false},
+		{"infinity", math.Inf(1), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := numberValue(tt.value)
+			if ok != tt.ok {
+				t.Fatalf("numberValue(%v) ok = %v, want %v", tt.value, ok, tt.ok)
+			}
+			if ok && got.RatString() != tt.want {
+				t.Errorf("numberValue(%v) = %s, want %s", tt.value, got.RatString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateIntegerArguments(t *testing.T) {
+	maximum := float64(maxSafeInteger)
+	definition := ToolDefinition{
+		Name: "ids",
+		InputSchema: ToolSchema{
+			Type: "object",
+			Properties: map[string]*ToolSchema{
+				"id":      {Type: "integer"},
+				"bounded": {Type: "integer", Maximum: &maximum},
+				"ratio":   {Type: "number"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		args map[string]any
+		rule string
+	}{
+		{"2^53-1", map[string]any{"id": json.Number("9007199254740991")}, ""},
+		{"2^53", map[string]any{"id": json.Number(pow53)}, ""},
+		{"2^53+1", map[string]any{"id": json.Number(pow53Plus1)}, ""},
+		{"beyond int64", map[string]any{"id": json.Number("123456789012345678901234567890")}, ""},
+		{"integer exponent", map[string]any{"id": json.Number("1e20")}, ""},
+		{"fraction", map[string]any{"id": json.Number(pow53Plus1 + ".5")}, "integer"},
+		{"negative exponent", map[string]any{"id": json.Number("1e-3")}, "integer"},
+		{"large exponent", map[string]any{"id": json.Number("1e500")}, "integer"},
+		{"maximum", map[string]any{"bounded": json.Number("9007199254740991")}, ""},
+		{"above maximum by one", map[string]any{"bounded": json.Number(pow53)}, "maximum"},
+		{"number with large exponent", map[string]any{"ratio": json.Number("1.5e300")}, ""},
+		{"number beyond exponent bound", map[string]any{"ratio": json.Number("1.5e401")}, "number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := definition.ValidateArguments(tt.args)
+			if tt.rule == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var pe *spec.ProtocolError
+			if !errors.As(err, &pe) || pe.Code != spec.ErrorCodeInvalidParams {
+				t.Fatalf("err = %v, want an invalid params error", err)
+			}
+			if rule := pe.Data.(map[string]any)["rule"]; rule != tt.rule {
+				t.Errorf("rule = %v, want %s", rule, tt.rule)
+			}
+		})
+	}
+}
+
+func TestArgsInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		want    int
+		wantErr bool
+	}{
+		{"2^53-1", json.Number("9007199254740991"), maxSafeInteger, false},
+		{"2^53", json.Number(pow53), 1 << 53, false},
+		{"2^53+1", json.Number(pow53Plus1), 1<<53 + 1, false},
+		{"exponent", json.Number("9.007199254740993e15"), 1<<53 + 1, false},
+		{"fraction", json.Number("1.5"), 0, true},
+		{"beyond int64", json.Number("1e19"), 0, true},
+		{"large exponent", json.Number("1e400"), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewArgs(map[string]any{"n": tt.value}, ToolSchema{}).Int("n")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Int() = %d, %v, want %d, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestArgsDecodeKeepsPrecision(t *testing.T) {
+	args := NewArgs(map[string]any{
+		"safe":  json.Number("9007199254740991"),
+		"pow":   json.Number(pow53),
+		"above": json.Number(pow53Plus1),
+	}, ToolSchema{
+		Properties: map[string]*ToolSchema{
+			"fallback": {Type: "integer", Default: json.Number(pow53Plus1)},
+		},
+	})
+
+	var typed struct {
+		Safe     int64 `json:"safe"`
+		Pow      int64 `json:"pow"`
+		Above    int64 `json:"above"`
+		Fallback int64 `json:"fallback"`
+	}
+	if err := args.Decode(&typed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if typed.Safe != maxSafeInteger || typed.Pow != 1<<53 || typed.Above != 1<<53+1 || typed.Fallback != 1<<53+1 {
+		t.Errorf("decoded %+v, want exact integers", typed)
+	}
+
+	var untyped map[string]any
+	if err := args.Decode(&untyped); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n, ok := untyped["above"].(json.Number); !ok || n.String() != pow53Plus1 {
+		t.Errorf("above = %#v, want json.Number %s", untyped["above"], pow53Plus1)
+	}
+
+	var narrow struct {
+		Above int32 `json:"above"`
+	}
+	var pe *spec.ProtocolError
+	if err := args.Decode(&narrow); !errors.As(err, &pe) || pe.Code != spec.ErrorCodeInvalidParams {
+		t.Errorf("err = %v, want an invalid params error", err)
+	}
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/makarski/mcp-robot/auth"
+)
+
+type (
+	// Policy decides whether the caller, identified by the request context,
+	// may see and call a tool. A nil error allows access
+	Policy interface {
+		Allow(ctx context.Context, definition ToolDefinition) error
+	}
+
+	// PolicyFunc adapts a function to the Policy interface
+	PolicyFunc func(ctx context.Context, definition ToolDefinition) error
+
+	// PolicyError is returned by policies denying access to a tool
+	PolicyError struct {
+		Tool          string
+		Reason        string
+		MissingScopes []string
+	}
+
+	// AnnotationScopes maps the tool annotations to the scopes required to call the tool
+	AnnotationScopes struct {
+		// Write is required for tools that are not marked read-only
+		Write string
+		// Destructive is required for tools that may perform destructive updates
+		Destructive string
+	}
+)
+
+func (f PolicyFunc) Allow(ctx context.Context, definition ToolDefinition) error {
+	return f(ctx, definition)
+}
+
+func (e *PolicyError) Error() string {
+	if len(e.MissingScopes) > 0 {
+		return fmt.Sprintf("access to tool '%s' denied: %s (missing scopes: %s)", e.Tool, e.Reason, strings.Join(e.MissingScopes, " "))
+	}
+	return fmt.Sprintf("access to tool '%s' denied: %s", e.Tool, e.Reason)
+}
+
+// ScopePolicy enforces the scopes declared with ToolBuilder.RequireScopes.
+// Tools requiring scopes can only be called by authenticated callers
+func ScopePolicy() Policy {
+	return PolicyFunc(func(ctx context.Context, definition ToolDefinition) error {
+		return requireScopes(ctx, definition.Name, definition.RequiredScopes)
+	})
+}
+
+// AnnotationPolicy derives the required scopes from the tool annotations.
+// Following the defaults of the MCP specification, a tool without readOnlyHint
+// is treated as writing and a writing tool without destructiveHint as destructive.
+// Empty scopes in the mapping are not required
+func AnnotationPolicy(scopes AnnotationScopes) Policy {
+	return PolicyFunc(func(ctx context.Context, definition ToolDefinition) error {
+		if definition.IsReadOnly() {
+			return nil
+		}
+
+		required := make([]string, 0, 2)
+		if scopes.Write != "" {
+			required = append(required, scopes.Write)
+		}
+
+		if definition.IsDestructive() && scopes.Destructive != "" {
+			required = append(required, scopes.Destructive)
+		}
+
+		return requireScopes(ctx, definition.Name, required)
+	})
+}
+
+func requireScopes(ctx context.Context, tool string, scopes []string) error {
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	info, ok := auth.FromContext(ctx)
+	if !ok {
+		return &PolicyError{
+			Tool:          tool,
+			Reason:        "authentication required",
+			MissingScopes: scopes,
+		}
+	}
+
+	var missing []string
+	for _, scope := range scopes {
+		if !info.HasScope(scope) {
+			missing = append(missing, scope)
+		}
+	}
+
+	if len(missing) > 0 {
+		return &PolicyError{
+			Tool:          tool,
+			Reason:        "insufficient scope",
+			MissingScopes: missing,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/makarski/mcp-robot/auth"
+)
+
+// checkPolicyError checks that err denies access for the reason and the missing scopes,
+// or that err is nil if reason is empty
+func checkPolicyError(t *testing.T, err error, reason string, missing []string) {
+	t.Helper()
+
+	if reason == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+
+	var pe *PolicyError
+	if !errors.As(err, &pe) {
+		t.Fatalf("err = %v, want a policy error", err)
+	}
+	if pe.Reason != reason {
+		t.Errorf("reason = %q, want %q", pe.Reason, reason)
+	}
+	if !slices.Equal(pe.MissingScopes, missing) {
+		t.Errorf("missing scopes = %q, want %q", pe.MissingScopes, missing)
+	}
+}
+
+func callerContext(scopes ...string) context.Context {
+	if scopes == nil {
+		return context.Background()
+	}
+	return auth.NewContext(context.Background(), &auth.TokenInfo{Subject: "user", Scopes: scopes})
+}
+
+func TestScopePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		required []string
+		scopes   []string
+		reason   string
+		missing  []string
+	}{
+		{"no scopes required", nil, nil, "", nil},
+		{"anonymous caller", []string{"read", "write"}, nil, "authentication required", []string{"read", "write"}},
+		{"all scopes", []string{"read", "write"}, []string{"write", "read", "admin"}, "", nil},
+		{"missing scope", []string{"read", "write"}, []string{"read"}, "insufficient scope", []string{"write"}},
+		{"no scope", []string{"read"}, []string{}, "insufficient scope", []string{"read"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			definition := NewTool("lookup").RequireScopes(tt.required...).Build()
+			err := ScopePolicy().Allow(callerContext(tt.scopes...), definition)
+			checkPolicyError(t, err, tt.reason, tt.missing)
+		})
+	}
+}
+
+func TestAnnotationPolicy(t *testing.T) {
+	scopes := AnnotationScopes{Write: "write", Destructive: "delete"}
+
+	tests := []struct {
+		name    string
+		tool    *ToolBuilder
+		scopes  AnnotationScopes
+		caller  []string
+		reason  string
+		missing []string
+	}{
+		{"read-only for anonymous callers", NewTool("t").MarkReadOnly(true), scopes, nil, "", nil},
+		{"destructive by default", NewTool("t"), scopes, []string{"read"}, "insufficient scope", []string{"write", "delete"}},
+		{"destructive for anonymous callers", NewTool("t"), scopes, nil, "authentication required", []string{"write", "delete"}},
+		{"destructive with scopes", NewTool("t"), scopes, []string{"write", "delete"}, "", nil},
+		{"not destructive", NewTool("t").MarkAsDestructive(false), scopes, []string{"write"}, "", nil},
+		{"not destructive without write", NewTool("t").MarkAsDestructive(false), scopes, []string{"delete"}, "insufficient scope", []string{"write"}},
+		{"marked destructive", NewTool("t").MarkReadOnly(false).MarkAsDestructive(true), scopes, []string{"write"}, "insufficient scope", []string{"delete"}},
+		{"empty write scope", NewTool("t"), AnnotationScopes{Destructive: "delete"}, []string{"delete"}, "", nil},
+		{"empty scopes", NewTool("t"), AnnotationScopes{}, nil, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := AnnotationPolicy(tt.scopes).Allow(callerContext(tt.caller...), tt.tool.Build())
+			checkPolicyError(t, err, tt.reason, tt.missing)
+		})
+	}
+}
+
+func TestPolicyErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *PolicyError
+		want string
+	}{
+		{"with scopes", &PolicyError{Tool: "drop", Reason: "insufficient scope", MissingScopes: []string{"write", "delete"}}, "access to tool 'drop' denied: insufficient scope (missing scopes: write delete)"},
+		{"without scopes", &PolicyError{Tool: "drop", Reason: "outside business hours"}, "access to tool 'drop' denied: outside business hours"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("error = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package tools
+
+// Redacted replaces the values of sensitive arguments
+const Redacted = "[REDACTED]"
+
+// RedactArguments returns a copy of the arguments with the values
+// of the properties marked as sensitive replaced by Redacted.
+// Nested objects and arrays of objects are redacted as well
+func (d ToolDefinition) RedactArguments(args map[string]any) map[string]any {
+	return redactObject(&d.InputSchema, args)
+}
+
+func redactObject(schema *ToolSchema, object map[string]any) map[string]any {
+	if object == nil {
+		return nil
+	}
+
+	redacted := make(map[string]any, len(object))
+	for name, value := range object {
+		redacted[name] = redactValue(schema.Properties[name], value)
+	}
+	return redacted
+}
+
+func redactValue(schema *ToolSchema, value any) any {
+	if schema == nil {
+		return value
+	}
+
+	if schema.Sensitive {
+		return Redacted
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		return redactObject(schema, v)
+	case []any:
+		if schema.ArrayItems == nil {
+			return v
+		}
+
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = redactValue(schema.ArrayItems, item)
+		}
+		return items
+	default:
+		return value
+	}
+}
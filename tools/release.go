@@ -0,0 +1,47 @@
+package tools
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type (
+	// CallRelease releases the resources held for a tool call, like rate limit permits,
+	// once its tool function has returned. The function may outlive the call: after a timeout
+	// the call is answered while the function keeps running. The handlers of ToolFunc
+	// and ToolContextFunc take the release over and run it when the function returns
+	CallRelease struct {
+		release func()
+		taken   atomic.Bool
+	}
+
+	callReleaseKey struct{}
+)
+
+// NewCallRelease creates a CallRelease running release
+func NewCallRelease(release func()) *CallRelease {
+	return &CallRelease{release: release}
+}
+
+// WithCallRelease returns a copy of ctx carrying the release of the tool call
+func WithCallRelease(ctx context.Context, r *CallRelease) context.Context {
+	return context.WithValue(ctx, callReleaseKey{}, r)
+}
+
+// Release runs the release unless a handler has taken it over.
+// It is called once the handler of the call has returned
+func (r *CallRelease) Release() {
+	if !r.taken.Load() {
+		r.release()
+	}
+}
+
+// takeCallRelease takes over the release of the tool call of ctx,
+// the returned function is a no-op if there is none
+func takeCallRelease(ctx context.Context) func() {
+	r, ok := ctx.Value(callReleaseKey{}).(*CallRelease)
+	if !ok || !r.taken.CompareAndSwap(false, true) {
+		return func() {}
+	}
+	return r.release
+}
@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCallReleaseAfterTimeout(t *testing.T) {
+	var released atomic.Int32
+	release := NewCallRelease(func() { released.Add(1) })
+
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 10*time.Millisecond, ErrTimeout)
+	defer cancel()
+	ctx = WithCallRelease(ctx, release)
+
+	unblock := make(chan struct{})
+	returned := make(chan struct{})
+	h := ToolFunc[ToolResultText](func(map[string]any) (ToolResultText, error) {
+		defer close(returned)
+		<-unblock
+		return NewToolResultText("late"), nil
+	})
+
+	var buf bytes.Buffer
+	h.MCPHandler(ToolDefinition{Name: "slow"}).ServeRPC(&buf, newCallRequest().WithContext(ctx))
+	release.Release()
+
+	if !bytes.Contains(buf.Bytes(), []byte("timed out")) {
+		t.Fatalf("response = %s, want a timeout error", buf.Bytes())
+	}
+	if n := released.Load(); n != 0 {
+		t.Fatalf("released %d times while the function runs, want 0", n)
+	}
+
+	close(unblock)
+	<-returned
+
+	deadline := time.Now().Add(time.Second)
+	for released.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := released.Load(); n != 1 {
+		t.Errorf("released %d times, want once after the function returned", n)
+	}
+}
+
+func TestCallReleaseWithoutHandler(t *testing.T) {
+	var released atomic.Int32
+	release := NewCallRelease(func() { released.Add(1) })
+
+	// a handler not taking the release over leaves it to the caller
+	release.Release()
+
+	if n := released.Load(); n != 1 {
+		t.Errorf("released %d times, want once", n)
+	}
+}
@@ -1,49 +1,59 @@
 package tools
 
 import (
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
+	"time"
 
 	"github.com/makarski/mcp-robot/io"
 	"github.com/makarski/mcp-robot/resources"
+	"github.com/makarski/mcp-robot/spec"
 )
 
 type (
-	ToolResult interface {
-		ToolResultText |
-			ToolResultMedia |
-			[]ToolResultText |
-			[]ToolResultMedia |
-			ToolResultStructured |
-			resources.ResourceLink |
-			ToolResultEmbeddedResource[resources.ResourceText] |
-			ToolResultEmbeddedResource[resources.ResourceBinary] |
-			[]ToolResultEmbeddedResource[resources.ResourceText] |
-			[]ToolResultEmbeddedResource[resources.ResourceBinary] |
-			ToolResultUnion
-	}
+	// ToolResult constrains the results of tool functions: implementations of Content,
+	// resources.ResourceLink and slices of the built-in content blocks, like []ToolResultText.
+	// Other types are rejected when the tool is called
+	ToolResult any
 
 	ToolResultMedia struct {
-		Type     string `json:"type"`
-		Data     string `json:"data"`
-		MimeType string `json:"mimeType"`
+		Type string `json:"type"`
+		// Data is the binary data, base64 encoded in JSON
+		Data        spec.Blob         `json:"data"`
+		MimeType    string            `json:"mimeType"`
+		Annotations *spec.Annotations `json:"annotations,omitempty"`
+		Meta        map[string]any    `json:"_meta,omitempty"`
+
+		source *binarySource
 	}
 
 	ToolResultText struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
+		Type        string            `json:"type"`
+		Text        string            `json:"text"`
+		Annotations *spec.Annotations `json:"annotations,omitempty"`
+		Meta        map[string]any    `json:"_meta,omitempty"`
 	}
 
 	ToolResultStructured map[string]any
 
 	ToolResultEmbeddedResource[R resources.Resource] struct {
-		Type     resources.ResourceType `json:"type"`
-		Resource R                      `json:"resource"`
+		Type        resources.ResourceType `json:"type"`
+		Resource    R                      `json:"resource"`
+		Annotations *spec.Annotations      `json:"annotations,omitempty"`
+		Meta        map[string]any         `json:"_meta,omitempty"`
+
+		source *binarySource
 	}
 
+	// ToolResultUnion combines content of different types in one result.
+	// ForAudience, Priority, LastModified and Meta act on the content added last,
+	// ResultMeta on the result
 	ToolResultUnion struct {
 		items []toolResultUnionItem
+		meta  map[string]any
+
+		structured    ToolResultStructured
+		structuredErr error
+		fallback      TextFormatter
+		fallbackSet   bool
 	}
 
 	toolResultUnionItem struct {
@@ -114,8 +124,100 @@ func (u *ToolResultUnion) AddResourceLink(uri, name, description, mimeType strin
 	return u
 }
 
-func (u *ToolResultUnion) toArray() []any {
-	result := make([]any, len(u.items))
+// ForAudience sets who the content added last is intended for
+func (u *ToolResultUnion) ForAudience(roles ...spec.Role) *ToolResultUnion {
+	if a := u.lastAnnotations(); a != nil {
+		a.Audience = roles
+	}
+	return u
+}
+
+// Priority sets the importance of the content added last,
+// from 0 (optional) to 1 (required)
+func (u *ToolResultUnion) Priority(priority float64) *ToolResultUnion {
+	if a := u.lastAnnotations(); a != nil {
+		a.Priority = &priority
+	}
+	return u
+}
+
+// LastModified sets the time the content added last was modified
+func (u *ToolResultUnion) LastModified(t time.Time) *ToolResultUnion {
+	if a := u.lastAnnotations(); a != nil {
+		a.LastModified = t.Format(time.RFC3339)
+	}
+	return u
+}
+
+// Meta adds a _meta entry to the content added last
+func (u *ToolResultUnion) Meta(key string, value any) *ToolResultUnion {
+	if len(u.items) == 0 {
+		return u
+	}
+
+	meta := u.items[len(u.items)-1].meta()
+	if *meta == nil {
+		*meta = make(map[string]any)
+	}
+	(*meta)[key] = value
+	return u
+}
+
+// ResultMeta adds a _meta entry to the result
+func (u *ToolResultUnion) ResultMeta(key string, value any) *ToolResultUnion {
+	if u.meta == nil {
+		u.meta = make(map[string]any)
+	}
+	u.meta[key] = value
+	return u
+}
+
+// lastAnnotations returns the annotations of the content added last,
+// nil if the union is empty
+func (u *ToolResultUnion) lastAnnotations() *spec.Annotations {
+	if len(u.items) == 0 {
+		return nil
+	}
+
+	annotations := u.items[len(u.items)-1].annotations()
+	if *annotations == nil {
+		*annotations = &spec.Annotations{}
+	}
+	return *annotations
+}
+
+func (item toolResultUnionItem) annotations() **spec.Annotations {
+	switch {
+	case item.text != nil:
+		return &item.text.Annotations
+	case item.media != nil:
+		return &item.media.Annotations
+	case item.embeddedTextResource != nil:
+		return &item.embeddedTextResource.Annotations
+	case item.embeddedBinaryResource != nil:
+		return &item.embeddedBinaryResource.Annotations
+	default:
+		return &item.resourceLink.Annotations
+	}
+}
+
+func (item toolResultUnionItem) meta() *map[string]any {
+	switch {
+	case item.text != nil:
+		return &item.text.Meta
+	case item.media != nil:
+		return &item.media.Meta
+	case item.embeddedTextResource != nil:
+		return &item.embeddedTextResource.Meta
+	case item.embeddedBinaryResource != nil:
+		return &item.embeddedBinaryResource.Meta
+	default:
+		return &item.resourceLink.Meta
+	}
+}
+
+func (u *ToolResultUnion) toArray() []ContentBlock {
+	result := make([]ContentBlock, len(u.items))
 
 	for i, item := range u.items {
 		switch {
@@ -142,22 +244,20 @@ func NewToolResultText(text string) ToolResultText {
 	}
 }
 
+// NewToolResultImage returns an image, an empty mimeType is detected from the data
 func NewToolResultImage(b []byte, mimeType string) ToolResultMedia {
-	data := base64.StdEncoding.EncodeToString(b)
-
 	return ToolResultMedia{
 		Type:     "image",
-		Data:     data,
+		Data:     b,
 		MimeType: mimeType,
 	}
 }
 
+// NewToolResultAudio returns audio, an empty mimeType is detected from the data
 func NewToolResultAudio(b []byte, mimeType string) ToolResultMedia {
-	data := base64.StdEncoding.EncodeToString(b)
-
 	return ToolResultMedia{
 		Type:     "audio",
-		Data:     data,
+		Data:     b,
 		MimeType: mimeType,
 	}
 }
@@ -184,6 +284,8 @@ func NewToolResultEmbeddedTextResource(
 	}
 }
 
+// NewToolResultEmbeddedBinaryResource returns a binary resource, an empty mimeType
+// is detected from the extension of uri or name, or else from the data
 func NewToolResultEmbeddedBinaryResource(
 	uri string,
 	name string,
@@ -197,54 +299,31 @@ func NewToolResultEmbeddedBinaryResource(
 	}
 }
 
-func writeResult(rw *io.ResponseWriter, result any) error {
-	var (
-		resultArray      []any
-		structuredResult *ToolResultStructured
-	)
-
-	switch v := result.(type) {
-	case ToolResultStructured:
-		txt, err := json.Marshal(v)
-		if err != nil {
-			return fmt.Errorf("failed to marshal structured tool result: %w", err)
-		}
-
-		resultArray = []any{NewToolResultText(string(txt))}
-		structuredResult = &v
-	case []any:
-		resultArray = v
-	case ToolResultMedia,
-		ToolResultText,
-		resources.ResourceLink,
-		ToolResultEmbeddedResource[resources.ResourceBinary],
-		ToolResultEmbeddedResource[resources.ResourceText]:
-		resultArray = []any{v}
-	case []ToolResultMedia:
-		resultArray = make([]any, len(v))
-		for i, item := range v {
-			resultArray[i] = item
-		}
-	case []ToolResultText:
-		resultArray = make([]any, len(v))
-		for i, item := range v {
-			resultArray[i] = item
-		}
-	case ToolResultUnion:
-		resultArray = v.toArray()
-	default:
-		return fmt.Errorf("invalid tool result type: %T", v)
+func writeResult(rw *io.ResponseWriter, content ToolResultContent, features spec.ProtocolFeatures) error {
+	blocks, streams, err := streamBlocks(content.Content)
+	if err != nil {
+		return err
+	}
+	if blocks == nil {
+		blocks = []ContentBlock{}
 	}
 
 	completeResult := map[string]any{
-		"content": resultArray,
+		"content": blocks,
 		"isError": false,
 	}
 
-	if structuredResult != nil {
-		completeResult["structuredContent"] = structuredResult
+	if content.Structured != nil && features.StructuredContent {
+		completeResult["structuredContent"] = content.Structured
 	}
 
+	if len(content.Meta) > 0 {
+		completeResult["_meta"] = content.Meta
+	}
+
+	if len(streams) > 0 {
+		return writeStreamedResult(rw, completeResult, streams)
+	}
 	return rw.WriteResult(completeResult)
 }
 
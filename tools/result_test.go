@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/makarski/mcp-robot/spec"
+)
+
+func TestContentAnnotationsAndMeta(t *testing.T) {
+	modified := time.Date(2025, 6, 18, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	tests := []struct {
+		name    string
+		union   *ToolResultUnion
+		content string
+		meta    string
+	}{
+		{
+			"no annotations",
+			NewToolResultUnion().AddText("plain"),
+			`[{"type":"text","text":"plain"}]`,
+			`null`,
+		},
+		{
+			"text annotations",
+			NewToolResultUnion().AddText("summary").ForAudience(spec.RoleUser, spec.RoleAssistant).Priority(0.8).LastModified(modified),
+			`[{"type":"text","text":"summary","annotations":{"audience":["user","assistant"],"priority":0.8,"lastModified":"2025-06-18T12:00:00+02:00"}}]`,
+			`null`,
+		},
+		{
+			"zero priority is kept",
+			NewToolResultUnion().AddText("optional").Priority(0),
+			`[{"type":"text","text":"optional","annotations":{"priority":0}}]`,
+			`null`,
+		},
+		{
+			"block meta",
+			NewToolResultUnion().AddImage([]byte("png"), "image/png").Meta("width", 640).Meta("height", 480),
+			`[{"type":"image","data":"cG5n","mimeType":"image/png","_meta":{"height":480,"width":640}}]`,
+			`null`,
+		},
+		{
+			"annotations of the last block",
+			NewToolResultUnion().
+				AddText("for the model").ForAudience(spec.RoleAssistant).
+				AddResourceLink("file:///report.pdf", "report", "", "application/pdf").Priority(1).Meta("pages", 3).
+				AddEmbeddedTextResource("file:///notes.txt", "notes", "", "text/plain", "hi").ForAudience(spec.RoleUser),
+			`[{"type":"text","text":"for the model","annotations":{"audience":["assistant"]}},` +
+				`{"type":"resource_link","uri":"file:///report.pdf","name":"report","mimeType":"application/pdf","_meta":{"pages":3},"annotations":{"priority":1}},` +
+				`{"type":"resource","resource":{"uri":"file:///notes.txt","name":"notes","mimeType":"text/plain","text":"hi"},"annotations":{"audience":["user"]}}]`,
+			`null`,
+		},
+		{
+			"result meta",
+			NewToolResultUnion().AddText("traced").ResultMeta("traceId", "abc"),
+			`[{"type":"text","text":"traced"}]`,
+			`{"traceId":"abc"}`,
+		},
+		{
+			"empty union",
+			NewToolResultUnion().ForAudience(spec.RoleUser).Priority(1).Meta("k", "v"),
+			`[]`,
+			`null`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := tt.union.MarshalContent()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			blocks, _ := json.Marshal(content.Content)
+			if string(blocks) != tt.content {
+				t.Errorf("content =\n%s\nwant\n%s", blocks, tt.content)
+			}
+
+			meta, _ := json.Marshal(content.Meta)
+			if string(meta) != tt.meta {
+				t.Errorf("meta = %s, want %s", meta, tt.meta)
+			}
+		})
+	}
+}
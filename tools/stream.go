@@ -0,0 +1,327 @@
+package tools
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	stdio "io"
+	"slices"
+
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/resources"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+type (
+	// binarySource is binary content read from a reader once the result is written.
+	// head holds the first bytes already read to detect the MIME type
+	binarySource struct {
+		r    stdio.Reader
+		size int64
+		head []byte
+	}
+
+	// stream is a source written into the response in place of its placeholder
+	stream struct {
+		placeholder []byte
+		source      *binarySource
+	}
+)
+
+// NewToolResultImageReader returns an image read from r when the result is written.
+// The data is base64 encoded straight into the response, r has to provide size bytes.
+// r is read once and closed afterwards if it is an io.Closer.
+// An empty mimeType is detected from the first bytes read
+func NewToolResultImageReader(r stdio.Reader, size int64, mimeType string) ToolResultMedia {
+	return ToolResultMedia{
+		Type:     "image",
+		MimeType: mimeType,
+		source:   &binarySource{r: r, size: size},
+	}
+}
+
+// NewToolResultAudioReader returns audio read from r when the result is written,
+// see NewToolResultImageReader
+func NewToolResultAudioReader(r stdio.Reader, size int64, mimeType string) ToolResultMedia {
+	return ToolResultMedia{
+		Type:     "audio",
+		MimeType: mimeType,
+		source:   &binarySource{r: r, size: size},
+	}
+}
+
+// NewToolResultEmbeddedBinaryResourceReader returns a binary resource read from r
+// when the result is written, see NewToolResultImageReader. An empty mimeType is detected
+// from the extension of uri or name, or else from the first bytes read
+func NewToolResultEmbeddedBinaryResourceReader(
+	uri string,
+	name string,
+	description string,
+	mimeType string,
+	r stdio.Reader,
+	size int64,
+) ToolResultEmbeddedResource[resources.ResourceBinary] {
+	resource := resources.NewResourceBinary(uri, name, "", description, mimeType, nil)
+	resource.Size = size
+	// the data is sniffed once the result is written
+	resource.MimeType = cmp.Or(mimeType, resources.MimeTypeByExtension(uri, name))
+
+	return ToolResultEmbeddedResource[resources.ResourceBinary]{
+		Type:     resources.ResourceItemType,
+		Resource: resource,
+		source:   &binarySource{r: r, size: size},
+	}
+}
+
+func (u *ToolResultUnion) AddImageReader(r stdio.Reader, size int64, mimeType string) *ToolResultUnion {
+	image := NewToolResultImageReader(r, size, mimeType)
+	u.items = append(u.items, toolResultUnionItem{
+		media: &image,
+	})
+	return u
+}
+
+func (u *ToolResultUnion) AddAudioReader(r stdio.Reader, size int64, mimeType string) *ToolResultUnion {
+	audio := NewToolResultAudioReader(r, size, mimeType)
+	u.items = append(u.items, toolResultUnionItem{
+		media: &audio,
+	})
+	return u
+}
+
+func (u *ToolResultUnion) AddEmbeddedBinaryResourceReader(uri, name, description, mimeType string, r stdio.Reader, size int64) *ToolResultUnion {
+	resource := NewToolResultEmbeddedBinaryResourceReader(uri, name, description, mimeType, r, size)
+	u.items = append(u.items, toolResultUnionItem{
+		embeddedBinaryResource: &resource,
+	})
+	return u
+}
+
+// limitResult enforces the MaxResultSize of the tool on the binary content of the result.
+// With LinkOversizedResources embedded binary resources are replaced by resource links,
+// the largest first, until the result fits
+func limitResult(definition ToolDefinition, content ToolResultContent) (ToolResultContent, error) {
+	limit := definition.MaxResultSize
+	if limit <= 0 {
+		return content, nil
+	}
+
+	var total int64
+	for _, block := range content.Content {
+		total += binarySize(block)
+	}
+
+	if total > limit && definition.LinkOversizedResources {
+		blocks := slices.Clone(content.Content)
+
+		var linkable []int
+		for i, block := range blocks {
+			if _, ok := block.(ToolResultEmbeddedResource[resources.ResourceBinary]); ok {
+				linkable = append(linkable, i)
+			}
+		}
+
+		slices.SortStableFunc(linkable, func(a, b int) int {
+			return cmp.Compare(binarySize(blocks[b]), binarySize(blocks[a]))
+		})
+
+		for _, i := range linkable {
+			if total <= limit {
+				break
+			}
+
+			total -= binarySize(blocks[i])
+			blocks[i] = resourceLink(blocks[i].(ToolResultEmbeddedResource[resources.ResourceBinary]))
+		}
+
+		content.Content = blocks
+	}
+
+	if total > limit {
+		return content, fmt.Errorf("tool result of %d bytes exceeds the limit of %d bytes", total, limit)
+	}
+	return content, nil
+}
+
+// binarySize returns the size of the binary data of a content block
+func binarySize(block ContentBlock) int64 {
+	switch b := block.(type) {
+	case ToolResultMedia:
+		if b.source != nil {
+			return b.source.size
+		}
+		return int64(len(b.Data))
+	case ToolResultEmbeddedResource[resources.ResourceBinary]:
+		if b.source != nil {
+			return b.source.size
+		}
+		return int64(len(b.Resource.Blob))
+	}
+	return 0
+}
+
+// resourceLink returns a link to the embedded resource in place of its content
+func resourceLink(embedded ToolResultEmbeddedResource[resources.ResourceBinary]) resources.ResourceLink {
+	r := embedded.Resource
+
+	link := resources.NewResourceLink(r.URI, r.Name, r.Description, r.MimeType)
+	link.Title = r.Title
+	link.Size = binarySize(embedded)
+	link.Meta = embedded.Meta
+	link.Annotations = embedded.Annotations
+	return link
+}
+
+// streamBlocks returns a copy of the blocks in which the data of the blocks read from readers
+// is a random placeholder, together with the sources to write in place of the placeholders.
+// The placeholder is encoded like any other blob, see spec.Blob
+func streamBlocks(blocks []ContentBlock) ([]ContentBlock, []stream, error) {
+	var (
+		streamed []ContentBlock
+		streams  []stream
+	)
+
+	for i, block := range blocks {
+		switch b := block.(type) {
+		case ToolResultMedia:
+			if b.source == nil {
+				continue
+			}
+
+			raw, placeholder, err := newPlaceholder()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			b.Data = raw
+			block = b
+			streams = append(streams, stream{placeholder, b.source})
+		case ToolResultEmbeddedResource[resources.ResourceBinary]:
+			if b.source == nil {
+				continue
+			}
+
+			raw, placeholder, err := newPlaceholder()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			b.Resource.Blob = raw
+			block = b
+			streams = append(streams, stream{placeholder, b.source})
+		default:
+			continue
+		}
+
+		if streamed == nil {
+			streamed = slices.Clone(blocks)
+		}
+		streamed[i] = block
+	}
+
+	if streamed == nil {
+		return blocks, nil, nil
+	}
+	return streamed, streams, nil
+}
+
+// newPlaceholder returns random bytes and their base64 encoding, which doesn't need padding
+func newPlaceholder() ([]byte, []byte, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to create placeholder: %w", err)
+	}
+
+	placeholder := make([]byte, spec.BlobEncoding.EncodedLen(len(raw)))
+	spec.BlobEncoding.Encode(placeholder, raw)
+	return raw, placeholder, nil
+}
+
+// writeStreamedResult writes the result with the placeholders replaced by the base64 encoded
+// data of the sources. The data is encoded from the readers straight into the response writer,
+// neither the raw bytes nor the encoded document are held in memory
+func writeStreamedResult(rw *io.ResponseWriter, result map[string]any, streams []stream) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tool result: %w", err)
+	}
+
+	// the document is split up front, so that nothing is written if a placeholder is missing
+	parts := make([][]byte, 0, len(streams)+1)
+	rest := encoded
+	for _, s := range streams {
+		i := bytes.Index(rest, s.placeholder)
+		if i < 0 {
+			return fmt.Errorf("failed to encode tool result: missing binary content")
+		}
+
+		parts = append(parts, rest[:i])
+		rest = rest[i+len(s.placeholder):]
+	}
+	parts = append(parts, rest)
+
+	return rw.WriteResultFunc(func(w stdio.Writer) error {
+		for i, s := range streams {
+			if _, err := w.Write(parts[i]); err != nil {
+				return err
+			}
+			if err := s.source.writeBase64(w); err != nil {
+				return err
+			}
+		}
+
+		_, err := w.Write(parts[len(streams)])
+		return err
+	})
+}
+
+// peek returns the first bytes of the source, up to resources.SniffLen.
+// They are read once and written before the rest of the source
+func (s *binarySource) peek() ([]byte, error) {
+	if s.head != nil {
+		return s.head, nil
+	}
+
+	head := make([]byte, min(s.size, resources.SniffLen))
+	if _, err := stdio.ReadFull(s.r, head); err != nil {
+		return nil, fmt.Errorf("failed to read binary content of %d bytes: %w", s.size, err)
+	}
+
+	s.head = head
+	return head, nil
+}
+
+// writeBase64 base64 encodes size bytes of the source into w
+func (s *binarySource) writeBase64(w stdio.Writer) error {
+	encoder := spec.NewBlobEncoder(w)
+	if _, err := encoder.Write(s.head); err != nil {
+		return err
+	}
+
+	if _, err := stdio.CopyN(encoder, s.r, s.size-int64(len(s.head))); err != nil {
+		return fmt.Errorf("failed to read binary content of %d bytes: %w", s.size, err)
+	}
+	return encoder.Close()
+}
+
+// closeSources closes the readers of the blocks that are io.Closers
+func closeSources(blocks []ContentBlock) {
+	for _, block := range blocks {
+		var source *binarySource
+		switch b := block.(type) {
+		case ToolResultMedia:
+			source = b.source
+		case ToolResultEmbeddedResource[resources.ResourceBinary]:
+			source = b.source
+		}
+
+		if source == nil {
+			continue
+		}
+		if c, ok := source.r.(stdio.Closer); ok {
+			c.Close()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	stdio "io"
+	"testing"
+
+	"github.com/makarski/mcp-robot/io"
+	"github.com/makarski/mcp-robot/spec"
+)
+
+// chunkRecorder is a transport receiving streamed responses in chunks
+type chunkRecorder struct {
+	bytes.Buffer
+	writes   int
+	chunks   int
+	maxChunk int
+}
+
+func (r *chunkRecorder) Write(b []byte) (int, error) {
+	r.writes++
+	return r.Buffer.Write(b)
+}
+
+func (r *chunkRecorder) WriteResultStream(write func(w stdio.Writer) error) error {
+	cw := io.NewChunkWriter(func(chunk []byte) error {
+		r.chunks++
+		r.maxChunk = max(r.maxChunk, len(chunk))
+		_, err := r.Buffer.Write(chunk)
+		return err
+	})
+
+	err := write(cw)
+	if err == nil {
+		err = cw.Flush()
+	}
+	return cw.StreamError(err)
+}
+
+// failingReader fails after returning n bytes
+type failingReader struct {
+	n int
+}
+
+func (r *failingReader) Read(b []byte) (int, error) {
+	if r.n == 0 {
+		return 0, errors.New("disk failure")
+	}
+	n := min(len(b), r.n)
+	r.n -= n
+	return n, nil
+}
+
+func newCallRequest() *spec.Request[int] {
+	return &spec.Request[int]{Jsonrpc: spec.JsonRPC, ID: 1, Method: spec.MethodToolsCall}
+}
+
+func callTool(t *testing.T, w io.RPCResponseWriter, h ToolHandler) {
+	t.Helper()
+	h.MCPHandler(ToolDefinition{Name: "export"}).ServeRPC(w, newCallRequest())
+}
+
+func TestStreamedResultIsWrittenInChunks(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100_000)
+
+	rec := &chunkRecorder{}
+	callTool(t, rec, ToolFunc[ToolResultMedia](func(map[string]any) (ToolResultMedia, error) {
+		return NewToolResultImageReader(bytes.NewReader(data), int64(len(data)), "image/png"), nil
+	}))
+
+	if rec.writes != 0 {
+		t.Errorf("writes = %d, want the result streamed", rec.writes)
+	}
+	if rec.chunks < 2 || rec.maxChunk > io.ChunkSize {
+		t.Errorf("chunks = %d of at most %d bytes, want chunks of at most %d bytes", rec.chunks, rec.maxChunk, io.ChunkSize)
+	}
+
+	var response struct {
+		Result struct {
+			Content []ToolResultMedia `json:"content"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(response.Result.Content) != 1 || !bytes.Equal(response.Result.Content[0].Data, data) {
+		t.Errorf("streamed data doesn't match the source")
+	}
+}
+
+func TestStreamedResultFallsBackToOneWrite(t *testing.T) {
+	data := []byte("binary content")
+
+	var buf bytes.Buffer
+	callTool(t, &buf, ToolFunc[ToolResultMedia](func(map[string]any) (ToolResultMedia, error) {
+		return NewToolResultAudioReader(bytes.NewReader(data), int64(len(data)), "audio/wav"), nil
+	}))
+
+	var response struct {
+		Result struct {
+			Content []ToolResultMedia `json:"content"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if !bytes.Equal(response.Result.Content[0].Data, data) {
+		t.Errorf("data = %q, want %q", response.Result.Content[0].Data, data)
+	}
+}
+
+func TestBrokenStreamIsNotFollowedByAnError(t *testing.T) {
+	rec := &chunkRecorder{}
+	callTool(t, rec, ToolFunc[ToolResultMedia](func(map[string]any) (ToolResultMedia, error) {
+		return NewToolResultImageReader(&failingReader{n: 200_000}, 1_000_000, "image/png"), nil
+	}))
+
+	if rec.chunks == 0 {
+		t.Fatal("want the stream to have started")
+	}
+	if rec.writes != 0 {
+		t.Errorf("writes = %d, want no error response after the broken stream", rec.writes)
+	}
+}
@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// TextFormatter renders structured content as the text content
+// of a result, for clients not reading structuredContent
+type TextFormatter func(structured ToolResultStructured) (string, error)
+
+// JSONText renders structured content as compact JSON,
+// the text fallback of ToolResultStructured
+func JSONText(structured ToolResultStructured) (string, error) {
+	b, err := json.Marshal(structured)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal structured tool result: %w", err)
+	}
+	return string(b), nil
+}
+
+// PrettyJSONText renders structured content as indented JSON
+func PrettyJSONText(structured ToolResultStructured) (string, error) {
+	b, err := json.MarshalIndent(structured, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal structured tool result: %w", err)
+	}
+	return string(b), nil
+}
+
+// WithStructured sets the structuredContent of the result, sent next to the content blocks.
+// The value is a map or a struct encoding to a JSON object, it is validated against
+// the output schema of the tool. Unless set with WithTextFallback, the structured content
+// is rendered as JSON text only if the union has no other content
+func (u *ToolResultUnion) WithStructured(value any) *ToolResultUnion {
+	u.structured, u.structuredErr = toStructured(value)
+	return u
+}
+
+// WithTextFallback sets how the structured content is rendered as an additional text block.
+// A nil formatter adds no text block
+func (u *ToolResultUnion) WithTextFallback(format TextFormatter) *ToolResultUnion {
+	u.fallback = format
+	u.fallbackSet = true
+	return u
+}
+
+// textFallback returns the formatter rendering the structured content, nil if none applies
+func (u *ToolResultUnion) textFallback() TextFormatter {
+	switch {
+	case u.fallbackSet:
+		return u.fallback
+	case len(u.items) == 0:
+		return JSONText
+	default:
+		return nil
+	}
+}
+
+// toStructured converts a map or a struct into structured content.
+// Numbers of structs are decoded as json.Number to keep their precision
+func toStructured(value any) (ToolResultStructured, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case ToolResultStructured:
+		return v, nil
+	case map[string]any:
+		return ToolResultStructured(v), nil
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal structured tool result: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var structured ToolResultStructured
+	if err := decoder.Decode(&structured); err != nil {
+		return nil, fmt.Errorf("structured tool result must be a JSON object, got %T", value)
+	}
+	return structured, nil
+}
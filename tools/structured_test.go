@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStructuredContentNextToBlocks(t *testing.T) {
+	type forecast struct {
+		City string  `json:"city"`
+		Temp float64 `json:"temp"`
+	}
+
+	tests := []struct {
+		name       string
+		union      *ToolResultUnion
+		content    string
+		structured string
+		wantErr    bool
+	}{
+		{
+			"structured only",
+			NewToolResultUnion().WithStructured(map[string]any{"temp": 21}),
+			`[{"type":"text","text":"{\"temp\":21}"}]`,
+			`{"temp":21}`,
+			false,
+		},
+		{
+			"structured next to text",
+			NewToolResultUnion().AddText("Sunny in Berlin").WithStructured(forecast{"Berlin", 21.5}),
+			`[{"type":"text","text":"Sunny in Berlin"}]`,
+			`{"city":"Berlin","temp":21.5}`,
+			false,
+		},
+		{
+			"structured next to an image",
+			NewToolResultUnion().AddImage([]byte("png"), "image/png").WithStructured(forecast{"Berlin", 21.5}),
+			`[{"type":"image","data":"cG5n","mimeType":"image/png"}]`,
+			`{"city":"Berlin","temp":21.5}`,
+			false,
+		},
+		{
+			"pretty text fallback",
+			NewToolResultUnion().AddText("Sunny").WithStructured(map[string]any{"temp": 21}).WithTextFallback(PrettyJSONText),
+			`[{"type":"text","text":"Sunny"},{"type":"text","text":"{\n  \"temp\": 21\n}"}]`,
+			`{"temp":21}`,
+			false,
+		},
+		{
+			"custom text fallback",
+			NewToolResultUnion().WithStructured(forecast{"Berlin", 21.5}).WithTextFallback(func(s ToolResultStructured) (string, error) {
+				return s["city"].(string) + ": " + s["temp"].(json.Number).String(), nil
+			}),
+			`[{"type":"text","text":"Berlin: 21.5"}]`,
+			`{"city":"Berlin","temp":21.5}`,
+			false,
+		},
+		{
+			"no text fallback",
+			NewToolResultUnion().WithStructured(map[string]any{"temp": 21}).WithTextFallback(nil),
+			`[]`,
+			`{"temp":21}`,
+			false,
+		},
+		{
+			"not an object",
+			NewToolResultUnion().AddText("list").WithStructured([]int{1, 2}),
+			``,
+			``,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := tt.union.MarshalContent()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			blocks, _ := json.Marshal(content.Content)
+			if string(blocks) != tt.content {
+				t.Errorf("content =\n%s\nwant\n%s", blocks, tt.content)
+			}
+
+			structured, _ := json.Marshal(content.Structured)
+			if string(structured) != tt.structured {
+				t.Errorf("structured = %s, want %s", structured, tt.structured)
+			}
+		})
+	}
+}